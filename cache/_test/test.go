@@ -2,8 +2,10 @@
 package _test
 
 import (
+	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pierrre/compare"
 	"github.com/pierrre/imageserver"
@@ -48,6 +50,93 @@ func TestGetMiss(t *testing.T, cache imageserver_cache.Cache) {
 	}
 }
 
+// TestExpire is a helper to test the expiration of imageserver/cache.EntryCache.
+//
+// The Cache must be configured with an expiration of 1 minute and a stale duration of 1 minute.
+// advance must advance the current time used by the Cache.
+func TestExpire(t *testing.T, cache imageserver_cache.EntryCache, advance func(time.Duration)) {
+	ctx := context.Background()
+	params := imageserver.Params{}
+	err := cache.Set(KeyValid, testdata.Medium, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(30 * time.Second)
+	testExpectHit(t, cache, KeyValid, params, true)
+	advance(40 * time.Second)
+	testExpectHit(t, cache, KeyValid, params, false)
+	e, err := cache.GetEntry(ctx, KeyValid, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil {
+		t.Fatal("no stale entry")
+	}
+	if !e.Expired(e.Expires) {
+		t.Fatal("entry not expired")
+	}
+	advance(60 * time.Second)
+	e, err = cache.GetEntry(ctx, KeyValid, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Fatal("stale entry not removed")
+	}
+
+	params = imageserver.Params{imageserver_cache.TTLParam: 0}
+	err = cache.Set(KeyValid, testdata.Medium, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(24 * time.Hour)
+	testExpectHit(t, cache, KeyValid, params, true)
+
+	params = imageserver.Params{imageserver_cache.TTLParam: "foo"}
+	err = cache.Set(KeyValid, testdata.Medium, params)
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ParamError{})
+	}
+}
+
+// TestSetEntry is a helper to test imageserver/cache.EntrySetter.SetEntry().
+//
+// The expiration of the Entry must be kept, and the TTL param ignored.
+func TestSetEntry(t *testing.T, cache interface {
+	imageserver_cache.EntryCache
+	imageserver_cache.EntrySetter
+}) {
+	ctx := context.Background()
+	params := imageserver.Params{imageserver_cache.TTLParam: 60}
+	expires := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	err := cache.SetEntry(ctx, KeyValid, &imageserver_cache.Entry{Image: testdata.Medium, Expires: expires}, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := cache.GetEntry(ctx, KeyValid, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil {
+		t.Fatal("no entry")
+	}
+	if !e.Expires.Equal(expires) {
+		t.Fatalf("unexpected expiration: got %s, want %s", e.Expires, expires)
+	}
+	testExpectHit(t, cache, KeyValid, params, true)
+}
+
+func testExpectHit(t *testing.T, cache imageserver_cache.Cache, key string, params imageserver.Params, hit bool) {
+	t.Helper()
+	im, err := cache.Get(key, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (im != nil) != hit {
+		t.Fatalf("unexpected result: got hit %t, want %t", im != nil, hit)
+	}
+}
+
 // MapCache is a simple imageserver/cache.Cache implementation (it wraps a map) for tests.
 type MapCache struct {
 	mutex sync.RWMutex
@@ -2,6 +2,8 @@
 package cache
 
 import (
+	"context"
+
 	"github.com/pierrre/imageserver"
 )
 
@@ -16,14 +18,62 @@ type Cache interface {
 	Set(key string, image *imageserver.Image, params imageserver.Params) error
 }
 
+// ContextCache is a Cache that supports a context.Context.
+type ContextCache interface {
+	Cache
+
+	// GetContext is like Get with a context.Context.
+	GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error)
+
+	// SetContext is like Set with a context.Context.
+	SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error
+}
+
+// GetContext gets the Image from the Cache with a context.Context.
+//
+// If the Cache implements ContextCache, it calls GetContext().
+// Otherwise it returns the context error if the context is done, or calls Get().
+func GetContext(ctx context.Context, c Cache, key string, params imageserver.Params) (*imageserver.Image, error) {
+	if c, ok := c.(ContextCache); ok {
+		return c.GetContext(ctx, key, params)
+	}
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(key, params)
+}
+
+// SetContext sets the Image to the Cache with a context.Context.
+//
+// If the Cache implements ContextCache, it calls SetContext().
+// Otherwise it returns the context error if the context is done, or calls Set().
+func SetContext(ctx context.Context, c Cache, key string, image *imageserver.Image, params imageserver.Params) error {
+	if c, ok := c.(ContextCache); ok {
+		return c.SetContext(ctx, key, image, params)
+	}
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	return c.Set(key, image, params)
+}
+
 // IgnoreError is a Cache implementation that ignores error from the underlying Cache.
+//
+// It implements ContextCache.
 type IgnoreError struct {
 	Cache
 }
 
 // Get implements Cache.
 func (c *IgnoreError) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
-	im, err := c.Cache.Get(key, params)
+	return c.GetContext(context.Background(), key, params)
+}
+
+// GetContext implements ContextCache.
+func (c *IgnoreError) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	im, err := GetContext(ctx, c.Cache, key, params)
 	if err != nil {
 		return nil, nil
 	}
@@ -32,21 +82,38 @@ func (c *IgnoreError) Get(key string, params imageserver.Params) (*imageserver.I
 
 // Set implements Cache.
 func (c *IgnoreError) Set(key string, image *imageserver.Image, params imageserver.Params) error {
-	_ = c.Cache.Set(key, image, params)
+	return c.SetContext(context.Background(), key, image, params)
+}
+
+// SetContext implements ContextCache.
+func (c *IgnoreError) SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+	_ = SetContext(ctx, c.Cache, key, image, params)
 	return nil
 }
 
 // Async is an asynchronous Cache implementation.
 //
 // The Images are set from a new goroutine.
+// It implements ContextCache, but the context cancellation is not propagated to the goroutine.
 type Async struct {
 	Cache
 }
 
+// GetContext implements ContextCache.
+func (a *Async) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	return GetContext(ctx, a.Cache, key, params)
+}
+
 // Set implements Cache.
 func (a *Async) Set(key string, image *imageserver.Image, params imageserver.Params) error {
+	return a.SetContext(context.Background(), key, image, params)
+}
+
+// SetContext implements ContextCache.
+func (a *Async) SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+	ctx = context.WithoutCancel(ctx)
 	go func() {
-		_ = a.Cache.Set(key, image, params)
+		_ = SetContext(ctx, a.Cache, key, image, params)
 	}()
 	return nil
 }
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+// TTLParam is the param used to override the default expiration of a Cache (in seconds, int).
+//
+// 0 means that the Image never expires.
+// As all Params, it is included in the cache key.
+const TTLParam = "cache_ttl"
+
+// GetTTL returns the expiration duration from TTLParam, or the default value if it is not set.
+func GetTTL(params imageserver.Params, defaultTTL time.Duration) (time.Duration, error) {
+	if !params.Has(TTLParam) {
+		return defaultTTL, nil
+	}
+	ttl, err := params.GetInt(TTLParam)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, &imageserver.ParamError{Param: TTLParam, Message: "must be greater than or equal to 0"}
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// Entry is an Image stored in a Cache with its expiration.
+//
+// It is encoded as an Image, with Created and Expires stored in the Image's metadata (see imageserver.ImageMetadata).
+// They are removed from the metadata of the decoded Image.
+// An Image without these metadata is decoded as an Entry without expiration, so the entries written before the expiration support are still readable.
+type Entry struct {
+	Image *imageserver.Image
+
+	// Created is the time when the Entry was written.
+	Created time.Time
+
+	// Expires is the time when the Entry expires.
+	// A zero time means that it never expires.
+	Expires time.Time
+}
+
+// NewEntry returns a new Entry for the Image.
+//
+// The expiration is given by TTLParam, or defaultTTL if it is not set.
+func NewEntry(im *imageserver.Image, params imageserver.Params, defaultTTL time.Duration, now time.Time) (*Entry, error) {
+	ttl, err := GetTTL(params, defaultTTL)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{
+		Image:   im,
+		Created: now,
+	}
+	if ttl > 0 {
+		e.Expires = now.Add(ttl)
+	}
+	return e, nil
+}
+
+// Expired returns true if the Entry is expired at the given time.
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// StaleExpired returns true if the Entry is expired, and the stale duration is elapsed at the given time.
+// The Entry must not be served anymore.
+func (e *Entry) StaleExpired(now time.Time, stale time.Duration) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires.Add(stale))
+}
+
+// Retention returns the duration during which the Entry must be kept by a Cache from the given time,
+// including the stale duration.
+// 0 means forever.
+func (e *Entry) Retention(now time.Time, stale time.Duration) time.Duration {
+	if e.Expires.IsZero() {
+		return 0
+	}
+	d := e.Expires.Add(stale).Sub(now)
+	if d <= 0 {
+		// Not 0, that means forever.
+		return time.Nanosecond
+	}
+	return d
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *Entry) MarshalBinary() ([]byte, error) {
+	im := *e.Image
+	im.Metadata.Created = e.Created
+	im.Metadata.Expires = e.Expires
+	return im.MarshalBinary()
+}
+
+// UnmarshalBinaryNoCopy is like encoding.BinaryUnmarshaler but does no copy.
+//
+// The caller must not reuse data after that.
+func (e *Entry) UnmarshalBinaryNoCopy(data []byte) error {
+	*e = Entry{}
+	im := new(imageserver.Image)
+	err := im.UnmarshalBinaryNoCopy(data)
+	if err != nil {
+		return err
+	}
+	e.Image = im
+	e.Created = im.Metadata.Created
+	e.Expires = im.Metadata.Expires
+	im.Metadata.Created = time.Time{}
+	im.Metadata.Expires = time.Time{}
+	return nil
+}
+
+// EntryCache is a Cache that supports the expiration.
+//
+// Get must not return an expired Image.
+type EntryCache interface {
+	Cache
+
+	// GetEntry returns the Entry associated to the key, or nil if not found.
+	// It can return an expired Entry, if it is not stale expired.
+	GetEntry(ctx context.Context, key string, params imageserver.Params) (*Entry, error)
+}
+
+// GetEntry gets the Entry from the Cache.
+//
+// If the Cache implements EntryCache, it calls GetEntry().
+// Otherwise it calls GetContext() and returns an Entry without expiration.
+func GetEntry(ctx context.Context, c Cache, key string, params imageserver.Params) (*Entry, error) {
+	if c, ok := c.(EntryCache); ok {
+		return c.GetEntry(ctx, key, params)
+	}
+	im, err := GetContext(ctx, c, key, params)
+	if err != nil || im == nil {
+		return nil, err
+	}
+	return &Entry{Image: im}, nil
+}
+
+// EntrySetter is a Cache that can store an Entry with its expiration.
+//
+// It is used to copy an Entry from another Cache (e.g. the promotion of Tiered) without resetting its expiration.
+type EntrySetter interface {
+	Cache
+
+	// SetEntry sets the Entry associated to the key.
+	// The expiration of the Entry is kept, and the TTL params are ignored.
+	SetEntry(ctx context.Context, key string, e *Entry, params imageserver.Params) error
+}
+
+// SetEntry sets the Entry to the Cache.
+//
+// If the Cache implements EntrySetter, it calls SetEntry(), so the expiration is kept.
+// Otherwise, if the Entry is not expired, it calls SetContext() with the Image.
+// An expired Entry is not given to a Cache that can't store its expiration.
+func SetEntry(ctx context.Context, c Cache, key string, e *Entry, params imageserver.Params) error {
+	if c, ok := c.(EntrySetter); ok {
+		return c.SetEntry(ctx, key, e, params)
+	}
+	if e.Expired(time.Now()) {
+		return nil
+	}
+	return SetContext(ctx, c, key, e.Image, params)
+}
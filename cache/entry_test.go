@@ -0,0 +1,166 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+	. "github.com/pierrre/imageserver/cache"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestGetTTL(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expected           time.Duration
+		expectedParamError string
+	}{
+		{
+			name:     "Default",
+			params:   imageserver.Params{},
+			expected: time.Hour,
+		},
+		{
+			name:     "Param",
+			params:   imageserver.Params{TTLParam: 60},
+			expected: time.Minute,
+		},
+		{
+			name:     "Zero",
+			params:   imageserver.Params{TTLParam: 0},
+			expected: 0,
+		},
+		{
+			name:               "Invalid",
+			params:             imageserver.Params{TTLParam: "foo"},
+			expectedParamError: TTLParam,
+		},
+		{
+			name:               "Negative",
+			params:             imageserver.Params{TTLParam: -1},
+			expectedParamError: TTLParam,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, err := GetTTL(tc.params, time.Hour)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if ttl != tc.expected {
+				t.Fatalf("unexpected TTL: got %s, want %s", ttl, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEntryMarshal(t *testing.T) {
+	now := time.Unix(1000, 0)
+	for _, e := range []*Entry{
+		{Image: testdata.Medium},
+		{Image: testdata.Medium, Created: now, Expires: now.Add(time.Minute)},
+	} {
+		data, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := new(Entry)
+		err = res.UnmarshalBinaryNoCopy(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Created.Equal(e.Created) || !res.Expires.Equal(e.Expires) {
+			t.Fatalf("unexpected times: got %s/%s, want %s/%s", res.Created, res.Expires, e.Created, e.Expires)
+		}
+		diff := compare.Compare(res.Image, e.Image)
+		if len(diff) != 0 {
+			t.Fatalf("images not equal, diff:\n%+v", diff)
+		}
+	}
+}
+
+func TestEntryUnmarshalLegacy(t *testing.T) {
+	data, err := testdata.Medium.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := new(Entry)
+	err = e.UnmarshalBinaryNoCopy(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Expires.IsZero() {
+		t.Fatal("legacy entry expires")
+	}
+	diff := compare.Compare(e.Image, testdata.Medium)
+	if len(diff) != 0 {
+		t.Fatalf("images not equal, diff:\n%+v", diff)
+	}
+}
+
+func TestEntryUnmarshalError(t *testing.T) {
+	e := &Entry{Image: testdata.Medium}
+	data, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Truncated", data: data[:10]},
+		{name: "Version", data: append([]byte("ISIM\xff"), data[5:]...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := new(Entry).UnmarshalBinaryNoCopy(tc.data)
+			if _, ok := err.(*imageserver.ImageError); !ok {
+				t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+			}
+		})
+	}
+}
+
+func TestEntryExpired(t *testing.T) {
+	now := time.Now()
+	e := &Entry{Expires: now.Add(time.Minute)}
+	if e.Expired(now) {
+		t.Fatal("expired")
+	}
+	if !e.Expired(now.Add(time.Minute)) {
+		t.Fatal("not expired")
+	}
+	if e.StaleExpired(now.Add(90*time.Second), time.Minute) {
+		t.Fatal("stale expired")
+	}
+	if !e.StaleExpired(now.Add(2*time.Minute), time.Minute) {
+		t.Fatal("not stale expired")
+	}
+	if d := e.Retention(now, time.Minute); d != 2*time.Minute {
+		t.Fatalf("unexpected retention: got %s, want %s", d, 2*time.Minute)
+	}
+	if d := (&Entry{}).Retention(now, time.Minute); d != 0 {
+		t.Fatalf("unexpected retention: got %s, want %s", d, time.Duration(0))
+	}
+}
+
+func TestGetEntryNotEntryCache(t *testing.T) {
+	c := &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return testdata.Medium, nil
+		},
+	}
+	e, err := GetEntry(t.Context(), c, "foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Image != testdata.Medium || !e.Expires.IsZero() {
+		t.Fatal("unexpected entry")
+	}
+}
@@ -2,27 +2,103 @@
 package file
 
 import (
-	"fmt"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
 )
 
 // Cache is a implementation of disk based cache system.
+//
+// The files are written atomically (to a temporary file, then renamed), and the locking is per key.
+//
+// If Capacity is set, the least recently used files are evicted when the total size exceeds it.
+// The index is rebuilt by scanning the directory on first use, with the modification time as the last access time.
+// The modification time is updated on each hit, so the order is kept after a restart.
+//
+// It implements imageserver/cache.EntryCache and imageserver/cache.EntrySetter.
 type Cache struct {
+	// Path is the directory.
 	Path string
-	mu   sync.RWMutex
+
+	// Capacity is an optional maximum size (in bytes) of the files.
+	// 0 means unlimited.
+	Capacity int64
+
+	// ShardLevels is an optional number of subdirectory levels.
+	// Each level is named with 2 hexadecimal characters of the SHA-256 hash of the key.
+	// 0 means that all files are stored in Path.
+	// Changing it makes the existing files unreachable.
+	ShardLevels int
+
+	// Expire is an optional expiration duration.
+	// It can be overridden by imageserver/cache.TTLParam.
+	Expire time.Duration
+
+	// Stale is an optional duration during which an expired Image is kept, and returned by GetEntry().
+	// The file is removed when it is read after this duration.
+	Stale time.Duration
+
+	locksMu sync.Mutex
+	locks   map[string]*keyLock
+
+	initOnce sync.Once
+	initErr  error
+
+	indexMu sync.Mutex
+	index   map[string]*list.Element
+	lru     *list.List
+	size    int64
 }
 
+type keyLock struct {
+	sync.RWMutex
+	refs int
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+const tempFilePrefix = ".tmp-"
+
+var now = time.Now
+
+var errPathNotSet = errors.New("file cache: path is not set")
+
 // Get implements imageserver/cache.Cache.
 func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	e, err := cache.GetEntry(context.Background(), key, params)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.Expired(now()) {
+		return nil, nil
+	}
+	return e.Image, nil
+}
+
+// GetEntry implements imageserver/cache.EntryCache.
+func (cache *Cache) GetEntry(ctx context.Context, key string, params imageserver.Params) (*imageserver_cache.Entry, error) {
 	if cache.Path == "" {
-		return nil, fmt.Errorf("file cache path is not")
+		return nil, errPathNotSet
+	}
+	err := cache.init()
+	if err != nil {
+		return nil, err
 	}
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
 	data, err := cache.getData(key)
 	if err != nil {
 		return nil, err
@@ -30,35 +106,306 @@ func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Ima
 	if data == nil {
 		return nil, nil
 	}
-	im := new(imageserver.Image)
-	if err := im.UnmarshalBinaryNoCopy(data); err != nil {
+	e := new(imageserver_cache.Entry)
+	if err := e.UnmarshalBinaryNoCopy(data); err != nil {
 		return nil, err
 	}
-	return im, nil
+	if e.StaleExpired(now(), cache.Stale) {
+		cache.removeStale(key)
+		return nil, nil
+	}
+	return e, nil
+}
+
+// removeStale removes the file if it is still stale expired.
+func (cache *Cache) removeStale(key string) {
+	unlock := cache.lock(key, true)
+	defer unlock()
+	pth := cache.path(key)
+	data, err := os.ReadFile(pth)
+	if err != nil {
+		return
+	}
+	e := new(imageserver_cache.Entry)
+	if e.UnmarshalBinaryNoCopy(data) != nil || !e.StaleExpired(now(), cache.Stale) {
+		return
+	}
+	_ = os.Remove(pth)
+	cache.remove(key)
 }
 
 func (cache *Cache) getData(key string) ([]byte, error) {
-	item, err := os.ReadFile(filepath.Join(cache.Path, key))
+	unlock := cache.lock(key, false)
+	defer unlock()
+	pth := cache.path(key)
+	data, err := os.ReadFile(pth)
 	if os.IsNotExist(err) {
+		cache.remove(key)
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return item, nil
+	if cache.Capacity > 0 {
+		tm := time.Now()
+		_ = os.Chtimes(pth, tm, tm)
+		cache.touch(key, int64(len(data)))
+	}
+	return data, nil
 }
 
 // Set implements imageserver/cache.Cache.
 func (cache *Cache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
-	cache.mu.Lock()
-	defer cache.mu.Unlock()
-	data, err := im.MarshalBinary()
+	if cache.Path == "" {
+		return errPathNotSet
+	}
+	err := cache.init()
+	if err != nil {
+		return err
+	}
+	e, err := imageserver_cache.NewEntry(im, params, cache.Expire, now())
+	if err != nil {
+		return err
+	}
+	return cache.setEntry(key, e)
+}
+
+// SetEntry implements imageserver/cache.EntrySetter.
+func (cache *Cache) SetEntry(ctx context.Context, key string, e *imageserver_cache.Entry, params imageserver.Params) error {
+	if cache.Path == "" {
+		return errPathNotSet
+	}
+	err := cache.init()
 	if err != nil {
 		return err
 	}
-	return cache.setData(key, data)
+	return cache.setEntry(key, e)
+}
+
+func (cache *Cache) setEntry(key string, e *imageserver_cache.Entry) error {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = cache.setData(key, data)
+	if err != nil {
+		return err
+	}
+	cache.evict()
+	return nil
 }
 
 func (cache *Cache) setData(key string, data []byte) error {
-	return os.WriteFile(filepath.Join(cache.Path, key), data, 0644)
+	unlock := cache.lock(key, true)
+	defer unlock()
+	pth := cache.path(key)
+	dir := filepath.Dir(pth)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), pth)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if cache.Capacity > 0 {
+		cache.touch(key, int64(len(data)))
+	}
+	return nil
+}
+
+func (cache *Cache) path(key string) string {
+	if cache.ShardLevels <= 0 {
+		return filepath.Join(cache.Path, key)
+	}
+	h := sha256.Sum256([]byte(key))
+	hx := hex.EncodeToString(h[:])
+	elems := make([]string, 0, cache.ShardLevels+2)
+	elems = append(elems, cache.Path)
+	for i := 0; i < cache.ShardLevels && i < len(h); i++ {
+		elems = append(elems, hx[i*2:i*2+2])
+	}
+	elems = append(elems, key)
+	return filepath.Join(elems...)
+}
+
+// lock locks the key, and returns the unlock function.
+func (cache *Cache) lock(key string, write bool) (unlock func()) {
+	cache.locksMu.Lock()
+	if cache.locks == nil {
+		cache.locks = make(map[string]*keyLock)
+	}
+	l, ok := cache.locks[key]
+	if !ok {
+		l = &keyLock{}
+		cache.locks[key] = l
+	}
+	l.refs++
+	cache.locksMu.Unlock()
+	if write {
+		l.Lock()
+	} else {
+		l.RLock()
+	}
+	return func() {
+		if write {
+			l.Unlock()
+		} else {
+			l.RUnlock()
+		}
+		cache.locksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(cache.locks, key)
+		}
+		cache.locksMu.Unlock()
+	}
+}
+
+func (cache *Cache) init() error {
+	if cache.Capacity <= 0 {
+		return nil
+	}
+	cache.initOnce.Do(func() {
+		cache.index = make(map[string]*list.Element)
+		cache.lru = list.New()
+		cache.initErr = cache.scan()
+		if cache.initErr == nil {
+			cache.evict()
+		}
+	})
+	return cache.initErr
+}
+
+// scan rebuilds the index from the files in the directory.
+func (cache *Cache) scan() error {
+	type file struct {
+		entry
+		modTime time.Time
+	}
+	var files []file
+	err := filepath.WalkDir(cache.Path, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && pth == cache.Path {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), tempFilePrefix) {
+			_ = os.Remove(pth)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		files = append(files, file{
+			entry:   entry{key: d.Name(), size: info.Size()},
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(files, func(a, b file) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	cache.indexMu.Lock()
+	defer cache.indexMu.Unlock()
+	for _, f := range files {
+		cache.addLocked(f.key, f.size)
+	}
+	return nil
+}
+
+// touch marks the key as the most recently used.
+func (cache *Cache) touch(key string, size int64) {
+	cache.indexMu.Lock()
+	defer cache.indexMu.Unlock()
+	cache.addLocked(key, size)
+}
+
+func (cache *Cache) addLocked(key string, size int64) {
+	if el, ok := cache.index[key]; ok {
+		e := el.Value.(*entry)
+		cache.size += size - e.size
+		e.size = size
+		cache.lru.MoveToFront(el)
+		return
+	}
+	cache.index[key] = cache.lru.PushFront(&entry{key: key, size: size})
+	cache.size += size
+}
+
+func (cache *Cache) remove(key string) {
+	if cache.Capacity <= 0 {
+		return
+	}
+	cache.indexMu.Lock()
+	defer cache.indexMu.Unlock()
+	if el, ok := cache.index[key]; ok {
+		cache.removeLocked(el)
+	}
+}
+
+func (cache *Cache) removeLocked(el *list.Element) {
+	e := el.Value.(*entry)
+	cache.lru.Remove(el)
+	delete(cache.index, e.key)
+	cache.size -= e.size
+}
+
+// evict removes the least recently used files until the size is lower than the capacity.
+func (cache *Cache) evict() {
+	if cache.Capacity <= 0 {
+		return
+	}
+	var victims []string
+	cache.indexMu.Lock()
+	for cache.size > cache.Capacity {
+		el := cache.lru.Back()
+		if el == nil {
+			break
+		}
+		victims = append(victims, el.Value.(*entry).key)
+		cache.removeLocked(el)
+	}
+	cache.indexMu.Unlock()
+	for _, key := range victims {
+		cache.evictFile(key)
+	}
+}
+
+func (cache *Cache) evictFile(key string) {
+	unlock := cache.lock(key, true)
+	defer unlock()
+	cache.indexMu.Lock()
+	_, ok := cache.index[key]
+	cache.indexMu.Unlock()
+	if ok {
+		// The key was used again since it was selected.
+		return
+	}
+	_ = os.Remove(cache.path(key))
 }
@@ -1,10 +1,13 @@
 package file
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pierrre/imageserver"
 	imageserver_cache "github.com/pierrre/imageserver/cache"
@@ -12,7 +15,15 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver_cache.Cache = &Cache{}
+var _ imageserver_cache.EntryCache = &Cache{}
+
+var _ imageserver_cache.EntrySetter = &Cache{}
+
+func TestSetEntry(t *testing.T) {
+	cache := &Cache{Path: t.TempDir()}
+	cachetest.TestSetEntry(t, cache)
+}
+
 var testDirPath string
 
 func TestMain(m *testing.M) {
@@ -44,8 +55,12 @@ func TestGetMiss(t *testing.T) {
 func TestPathIsNotSet(t *testing.T) {
 	cache := &Cache{Path: ""}
 	_, err := cache.Get(cachetest.KeyValid, imageserver.Params{})
-	if err == nil {
-		t.Fatal("no error")
+	if err != errPathNotSet {
+		t.Fatalf("unexpected error: got %v, want %v", err, errPathNotSet)
+	}
+	err = cache.Set(cachetest.KeyValid, testdata.Medium, imageserver.Params{})
+	if err != errPathNotSet {
+		t.Fatalf("unexpected error: got %v, want %v", err, errPathNotSet)
 	}
 }
 
@@ -104,3 +119,168 @@ func newTestCache() *Cache {
 	cache := &Cache{Path: testDirPath}
 	return cache
 }
+
+func TestShardLevels(t *testing.T) {
+	dir := t.TempDir()
+	cache := &Cache{Path: dir, ShardLevels: 2}
+	cachetest.TestGetSet(t, cache)
+	pth := cache.path(cachetest.KeyValid)
+	rel, err := filepath.Rel(dir, pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Split(rel, string(filepath.Separator))); n != 3 {
+		t.Fatalf("unexpected path depth: got %d, want %d (%s)", n, 3, rel)
+	}
+	if _, err := os.Stat(pth); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetNoTempFile(t *testing.T) {
+	dir := t.TempDir()
+	cache := &Cache{Path: dir}
+	err := cache.Set(cachetest.KeyValid, testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != cachetest.KeyValid {
+		t.Fatalf("unexpected directory content: %v", entries)
+	}
+}
+
+func TestCapacityEviction(t *testing.T) {
+	size := testMarshaledSize(t, testdata.Small)
+	cache := &Cache{Path: t.TempDir(), Capacity: 2 * size, ShardLevels: 1}
+	for _, key := range []string{"a", "b"} {
+		err := cache.Set(key, testdata.Small, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "a" becomes the most recently used.
+	testExpectHit(t, cache, "a", true)
+	err := cache.Set("c", testdata.Small, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpectHit(t, cache, "a", true)
+	testExpectHit(t, cache, "b", false)
+	testExpectHit(t, cache, "c", true)
+	if _, err := os.Stat(cache.path("b")); !os.IsNotExist(err) {
+		t.Fatalf("file not removed: %v", err)
+	}
+	if cache.size != 2*size {
+		t.Fatalf("unexpected size: got %d, want %d", cache.size, 2*size)
+	}
+}
+
+func TestCapacityRebuild(t *testing.T) {
+	dir := t.TempDir()
+	size := testMarshaledSize(t, testdata.Small)
+	cache := &Cache{Path: dir, ShardLevels: 1}
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		err := cache.Set(key, testdata.Small, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm := now.Add(time.Duration(i) * time.Minute)
+		err = os.Chtimes(cache.path(key), tm, tm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(dir, tempFilePrefix+"foo"), []byte("foo"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Restart with a capacity: the oldest file is evicted.
+	cache = &Cache{Path: dir, Capacity: 2 * size, ShardLevels: 1}
+	testExpectHit(t, cache, "a", false)
+	testExpectHit(t, cache, "b", true)
+	testExpectHit(t, cache, "c", true)
+	if _, err := os.Stat(filepath.Join(dir, tempFilePrefix+"foo")); !os.IsNotExist(err) {
+		t.Fatalf("temporary file not removed: %v", err)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	size := testMarshaledSize(t, testdata.Small)
+	cache := &Cache{Path: t.TempDir(), Capacity: 5 * size, ShardLevels: 1}
+	wg := new(sync.WaitGroup)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				key := fmt.Sprint((i + j) % 8)
+				err := cache.Set(key, testdata.Small, imageserver.Params{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, err = cache.Get(key, imageserver.Params{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cache.size > cache.Capacity {
+		t.Fatalf("size exceeds capacity: %d > %d", cache.size, cache.Capacity)
+	}
+}
+
+func testMarshaledSize(t *testing.T, im *imageserver.Image) int64 {
+	// Set() writes the creation time.
+	data, err := (&imageserver_cache.Entry{Image: im, Created: time.Now()}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data))
+}
+
+func testExpectHit(t *testing.T, cache *Cache, key string, hit bool) {
+	t.Helper()
+	im, err := cache.Get(key, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (im != nil) != hit {
+		t.Fatalf("unexpected result for key %q: got hit %t, want %t", key, im != nil, hit)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	cache := &Cache{Path: t.TempDir(), Capacity: 1 << 30, Expire: 1 * time.Minute, Stale: 1 * time.Minute}
+	defer func() {
+		now = time.Now
+	}()
+	tm := time.Now()
+	now = func() time.Time {
+		return tm
+	}
+	cachetest.TestExpire(t, cache, func(d time.Duration) {
+		tm = tm.Add(d)
+	})
+}
+
+func TestGetLegacy(t *testing.T) {
+	cache := &Cache{Path: t.TempDir()}
+	data, err := testdata.Medium.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.setData(cachetest.KeyValid, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpectHit(t, cache, cachetest.KeyValid, true)
+}
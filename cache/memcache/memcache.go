@@ -2,19 +2,46 @@
 package memcache
 
 import (
+	"context"
+	"math"
+	"time"
+
 	memcache_impl "github.com/bradfitz/gomemcache/memcache"
 	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
 )
 
 // Cache is a Memcache imageserver/cache.Cache implementation.
 //
 // It uses https://github.com/bradfitz/gomemcache .
+//
+// It implements imageserver/cache.EntryCache and imageserver/cache.EntrySetter.
+// The Memcache item expires when the Entry is stale expired.
 type Cache struct {
 	Client *memcache_impl.Client
+
+	// Expire is an optional expiration duration.
+	// It can be overridden by imageserver/cache.TTLParam.
+	Expire time.Duration
+
+	// Stale is an optional duration during which an expired Image is kept, and returned by GetEntry().
+	Stale time.Duration
 }
 
 // Get implements imageserver/cache.Cache.
 func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	e, err := cache.GetEntry(context.Background(), key, params)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.Expired(time.Now()) {
+		return nil, nil
+	}
+	return e.Image, nil
+}
+
+// GetEntry implements imageserver/cache.EntryCache.
+func (cache *Cache) GetEntry(ctx context.Context, key string, params imageserver.Params) (*imageserver_cache.Entry, error) {
 	data, err := cache.getData(key)
 	if err != nil {
 		return nil, err
@@ -22,12 +49,12 @@ func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Ima
 	if data == nil {
 		return nil, nil
 	}
-	im := new(imageserver.Image)
-	err = im.UnmarshalBinaryNoCopy(data)
+	e := new(imageserver_cache.Entry)
+	err = e.UnmarshalBinaryNoCopy(data)
 	if err != nil {
 		return nil, err
 	}
-	return im, nil
+	return e, nil
 }
 
 func (cache *Cache) getData(key string) ([]byte, error) {
@@ -43,16 +70,52 @@ func (cache *Cache) getData(key string) ([]byte, error) {
 
 // Set implements imageserver/cache.Cache.
 func (cache *Cache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
-	data, err := im.MarshalBinary()
+	e, err := imageserver_cache.NewEntry(im, params, cache.Expire, time.Now())
+	if err != nil {
+		return err
+	}
+	return cache.SetEntry(context.Background(), key, e, params)
+}
+
+// SetEntry implements imageserver/cache.EntrySetter.
+func (cache *Cache) SetEntry(ctx context.Context, key string, e *imageserver_cache.Entry, params imageserver.Params) error {
+	data, err := e.MarshalBinary()
 	if err != nil {
 		return err
 	}
-	return cache.setData(key, data)
+	now := time.Now()
+	return cache.setData(key, data, getExpiration(now, e.Retention(now, cache.Stale)))
 }
 
-func (cache *Cache) setData(key string, data []byte) error {
+func (cache *Cache) setData(key string, data []byte, expiration int32) error {
 	return cache.Client.Set(&memcache_impl.Item{
-		Key:   key,
-		Value: data,
+		Key:        key,
+		Value:      data,
+		Expiration: expiration,
 	})
 }
+
+// maxRelativeExpiration is the maximum relative expiration (30 days) supported by Memcache.
+// Greater values are interpreted as a Unix time.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// getExpiration returns the Memcache expiration for the duration.
+//
+// It is relative (in seconds) up to 30 days, and a Unix time beyond.
+// If the Unix time doesn't fit in an int32 (after 2038), the maximum relative expiration is used instead.
+// It only shortens the retention, because the Entry expiration is checked by Get.
+func getExpiration(now time.Time, d time.Duration) int32 {
+	if d <= 0 {
+		return 0
+	}
+	// Round up to the second, because 0 means forever.
+	d = (d + time.Second - 1).Truncate(time.Second)
+	if d <= maxRelativeExpiration {
+		return int32(d / time.Second)
+	}
+	t := now.Unix() + int64(d/time.Second)
+	if t > math.MaxInt32 {
+		return int32(maxRelativeExpiration / time.Second)
+	}
+	return int32(t)
+}
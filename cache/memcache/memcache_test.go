@@ -3,6 +3,7 @@ package memcache
 import (
 	"strings"
 	"testing"
+	"time"
 
 	memcache_impl "github.com/bradfitz/gomemcache/memcache"
 	"github.com/pierrre/imageserver"
@@ -11,7 +12,14 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver_cache.Cache = &Cache{}
+var _ imageserver_cache.EntryCache = &Cache{}
+
+var _ imageserver_cache.EntrySetter = &Cache{}
+
+func TestSetEntry(t *testing.T) {
+	cache := newTestCache(t)
+	cachetest.TestSetEntry(t, cache)
+}
 
 func TestGetSet(t *testing.T) {
 	cache := newTestCache(t)
@@ -46,7 +54,7 @@ func TestGetErrorUnmarshal(t *testing.T) {
 		t.Fatal(err)
 	}
 	data = data[:len(data)-1]
-	err = cache.setData(cachetest.KeyValid, data)
+	err = cache.setData(cachetest.KeyValid, data, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,3 +110,32 @@ func checkTestCacheAvailable(tb testing.TB, cache *Cache) {
 		tb.Skip(err)
 	}
 }
+
+func TestGetExpiration(t *testing.T) {
+	now := time.Unix(1000000000, 0)
+	for _, tc := range []struct {
+		now      time.Time
+		d        time.Duration
+		expected int32
+	}{
+		{d: 0, expected: 0},
+		{d: time.Nanosecond, expected: 1},
+		{d: 1500 * time.Millisecond, expected: 2},
+		{d: time.Hour, expected: 3600},
+		{d: 30 * 24 * time.Hour, expected: 30 * 24 * 3600},
+		{d: 31 * 24 * time.Hour, expected: int32(now.Unix()) + 31*24*3600},
+		{d: 100 * 365 * 24 * time.Hour, expected: 30 * 24 * 3600},
+		{now: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), d: 31 * 24 * time.Hour, expected: 30 * 24 * 3600},
+	} {
+		t.Run(tc.d.String(), func(t *testing.T) {
+			n := now
+			if !tc.now.IsZero() {
+				n = tc.now
+			}
+			res := getExpiration(n, tc.d)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %d, want %d", res, tc.expected)
+			}
+		})
+	}
+}
@@ -2,15 +2,29 @@
 package memory
 
 import (
+	"context"
+	"time"
+
 	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
 	"github.com/pierrre/lrucache"
 )
 
 // Cache is an in-memory imageserver/cache.Cache implementation.
 //
 // It uses https://github.com/pierrre/lrucache (copy of https://github.com/youtube/vitess/tree/master/go/cache) .
+//
+// It implements imageserver/cache.EntryCache and imageserver/cache.EntrySetter.
 type Cache struct {
 	lru *lrucache.LRUCache
+
+	// Expire is an optional expiration duration.
+	// It can be overridden by imageserver/cache.TTLParam.
+	Expire time.Duration
+
+	// Stale is an optional duration during which an expired Image is kept, and returned by GetEntry().
+	// After it, the Image is not returned anymore, but it stays in the cache until it is evicted.
+	Stale time.Duration
 }
 
 // New creates a new Cache.
@@ -24,28 +38,55 @@ func New(capacity int64) *Cache {
 
 // Get implements imageserver/cache.Cache.
 func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	e, err := cache.GetEntry(context.Background(), key, params)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.Expired(now()) {
+		return nil, nil
+	}
+	return e.Image, nil
+}
+
+// GetEntry implements imageserver/cache.EntryCache.
+func (cache *Cache) GetEntry(ctx context.Context, key string, params imageserver.Params) (*imageserver_cache.Entry, error) {
 	value, ok := cache.lru.Get(key)
 	if !ok {
 		return nil, nil
 	}
 	item := value.(*item)
-	image := item.image
-	return image, nil
+	// The stale expired item is not deleted, because it could have been replaced concurrently by SetEntry().
+	// It is removed by the LRU eviction.
+	if item.entry.StaleExpired(now(), cache.Stale) {
+		return nil, nil
+	}
+	return item.entry, nil
 }
 
 // Set implements imageserver/cache.Cache.
 func (cache *Cache) Set(key string, image *imageserver.Image, params imageserver.Params) error {
+	e, err := imageserver_cache.NewEntry(image, params, cache.Expire, now())
+	if err != nil {
+		return err
+	}
+	return cache.SetEntry(context.Background(), key, e, params)
+}
+
+// SetEntry implements imageserver/cache.EntrySetter.
+func (cache *Cache) SetEntry(ctx context.Context, key string, e *imageserver_cache.Entry, params imageserver.Params) error {
 	item := &item{
-		image: image,
+		entry: e,
 	}
 	cache.lru.Set(key, item)
 	return nil
 }
 
+var now = time.Now
+
 type item struct {
-	image *imageserver.Image
+	entry *imageserver_cache.Entry
 }
 
 func (item *item) Size() int {
-	return len(item.image.Data)
+	return len(item.entry.Image.Data)
 }
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"testing"
+	"time"
 
 	imageserver_cache "github.com/pierrre/imageserver/cache"
 	cachetest "github.com/pierrre/imageserver/cache/_test"
@@ -22,3 +23,32 @@ func TestGetMiss(t *testing.T) {
 func newTestCache() *Cache {
 	return New(20 * 1024 * 1024)
 }
+
+var _ imageserver_cache.EntryCache = &Cache{}
+
+var _ imageserver_cache.EntrySetter = &Cache{}
+
+func TestSetEntry(t *testing.T) {
+	cache := newTestCache()
+	cachetest.TestSetEntry(t, cache)
+}
+
+func TestExpire(t *testing.T) {
+	cache := newTestCache()
+	cache.Expire = 1 * time.Minute
+	cache.Stale = 1 * time.Minute
+	testExpire(t, cache)
+}
+
+func testExpire(t *testing.T, cache *Cache) {
+	defer func() {
+		now = time.Now
+	}()
+	tm := time.Now()
+	now = func() time.Time {
+		return tm
+	}
+	cachetest.TestExpire(t, cache, func(d time.Duration) {
+		tm = tm.Add(d)
+	})
+}
@@ -2,24 +2,45 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
 )
 
 // Cache is a Redis imageserver/cache.Cache implementation.
 //
 // It uses https://github.com/go-redis/redis .
+//
+// It implements imageserver/cache.EntryCache and imageserver/cache.EntrySetter.
+// The Redis key expires when the Entry is stale expired.
 type Cache struct {
 	Client redis.UniversalClient
 
 	// Expire is an optional expiration duration.
+	// It can be overridden by imageserver/cache.TTLParam.
 	Expire time.Duration
+
+	// Stale is an optional duration during which an expired Image is kept, and returned by GetEntry().
+	Stale time.Duration
 }
 
 // Get implements imageserver/cache.Cache.
 func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	e, err := cache.GetEntry(context.Background(), key, params)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.Expired(time.Now()) {
+		return nil, nil
+	}
+	return e.Image, nil
+}
+
+// GetEntry implements imageserver/cache.EntryCache.
+func (cache *Cache) GetEntry(ctx context.Context, key string, params imageserver.Params) (*imageserver_cache.Entry, error) {
 	data, err := cache.getData(key)
 	if err != nil {
 		return nil, err
@@ -27,12 +48,12 @@ func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Ima
 	if data == nil {
 		return nil, nil
 	}
-	im := new(imageserver.Image)
-	err = im.UnmarshalBinaryNoCopy(data)
+	e := new(imageserver_cache.Entry)
+	err = e.UnmarshalBinaryNoCopy(data)
 	if err != nil {
 		return nil, err
 	}
-	return im, nil
+	return e, nil
 }
 
 func (cache *Cache) getData(key string) ([]byte, error) {
@@ -48,13 +69,22 @@ func (cache *Cache) getData(key string) ([]byte, error) {
 
 // Set implements imageserver/cache.Cache.
 func (cache *Cache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
-	data, err := im.MarshalBinary()
+	e, err := imageserver_cache.NewEntry(im, params, cache.Expire, time.Now())
+	if err != nil {
+		return err
+	}
+	return cache.SetEntry(context.Background(), key, e, params)
+}
+
+// SetEntry implements imageserver/cache.EntrySetter.
+func (cache *Cache) SetEntry(ctx context.Context, key string, e *imageserver_cache.Entry, params imageserver.Params) error {
+	data, err := e.MarshalBinary()
 	if err != nil {
 		return err
 	}
-	return cache.setData(key, data)
+	return cache.setData(key, data, e.Retention(time.Now(), cache.Stale))
 }
 
-func (cache *Cache) setData(key string, data []byte) error {
-	return cache.Client.Set(key, data, cache.Expire).Err()
+func (cache *Cache) setData(key string, data []byte, expiration time.Duration) error {
+	return cache.Client.Set(key, data, expiration).Err()
 }
@@ -12,7 +12,17 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver_cache.Cache = &Cache{}
+var _ imageserver_cache.EntryCache = &Cache{}
+
+var _ imageserver_cache.EntrySetter = &Cache{}
+
+func TestSetEntry(t *testing.T) {
+	cache := newTestCache(t)
+	defer func() {
+		_ = cache.Client.Close()
+	}()
+	cachetest.TestSetEntry(t, cache)
+}
 
 func TestGetSet(t *testing.T) {
 	cache := newTestCache(t)
@@ -65,7 +75,7 @@ func TestGetErrorUnmarshal(t *testing.T) {
 		t.Fatal(err)
 	}
 	data = data[:len(data)-1]
-	err = cache.setData(cachetest.KeyValid, data)
+	err = cache.setData(cachetest.KeyValid, data, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,10 +1,13 @@
 package cache
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"hash"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
 )
@@ -17,33 +20,172 @@ import (
 //   - Get the Image from the Server.
 //   - Set the Image to the Cache.
 //   - Return the Image.
+//
+// If StaleWhileRevalidate is enabled, an expired Image returned by EntryCache.GetEntry() is returned,
+// and it is refreshed from a new goroutine.
+//
+// It implements imageserver.ContextServer and imageserver.StreamServer.
+// If the Image is not found in the Cache, GetStream() forwards to the Server, so an unchanged Image is streamed without being loaded first.
+// The Stream data is set to the Cache when the Stream is read entirely and closed.
 type Server struct {
 	imageserver.Server
 	Cache        Cache
 	KeyGenerator KeyGenerator
+
+	// StaleWhileRevalidate enables the serving of expired Images while they are refreshed in the background.
+	// Only one refresh per key is running at a time.
+	StaleWhileRevalidate bool
+
+	// ErrorFunc is an optional function that is called if a background refresh fails.
+	ErrorFunc func(err error, params imageserver.Params)
+
+	refreshMu  sync.Mutex
+	refreshing map[string]struct{}
 }
 
 // Get implements imageserver.Server.
 func (s *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (s *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
 	key := s.KeyGenerator.GetKey(params)
-	im, err := s.Cache.Get(key, params)
+	im, err := s.getCache(ctx, key, params)
 	if err != nil {
 		return nil, err
 	}
 	if im != nil {
 		return im, nil
 	}
-	im, err = s.Server.Get(params)
+	return s.getServer(ctx, key, params)
+}
+
+// GetStream implements imageserver.StreamServer.
+func (s *Server) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	key := s.KeyGenerator.GetKey(params)
+	im, err := s.getCache(ctx, key, params)
 	if err != nil {
 		return nil, err
 	}
-	err = s.Cache.Set(key, im, params)
+	if im != nil {
+		return imageserver.NewImageStream(im), nil
+	}
+	st, err := imageserver.GetStream(ctx, s.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	if st.Size > imageserver.ImageDataMaxLen {
+		return st, nil
+	}
+	format := st.Format
+	rc := &setReadCloser{
+		ReadCloser: st.Body,
+		set: func(data []byte) error {
+			im := &imageserver.Image{
+				Format: format,
+				Data:   data,
+			}
+			return SetContext(context.WithoutCancel(ctx), s.Cache, key, im, params)
+		},
+	}
+	if st.Size > 0 {
+		rc.buf.Grow(int(st.Size))
+	}
+	st.Body = rc
+	return st, nil
+}
+
+func (s *Server) getCache(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	if !s.StaleWhileRevalidate {
+		return GetContext(ctx, s.Cache, key, params)
+	}
+	e, err := GetEntry(ctx, s.Cache, key, params)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if e.Expired(time.Now()) {
+		s.refresh(ctx, key, params)
+	}
+	return e.Image, nil
+}
+
+func (s *Server) getServer(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	im, err := imageserver.GetContext(ctx, s.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	// The Image is already computed, so it is stored even if the context is canceled.
+	err = SetContext(context.WithoutCancel(ctx), s.Cache, key, im, params)
 	if err != nil {
 		return nil, err
 	}
 	return im, nil
 }
 
+func (s *Server) refresh(ctx context.Context, key string, params imageserver.Params) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	if _, ok := s.refreshing[key]; ok {
+		return
+	}
+	if s.refreshing == nil {
+		s.refreshing = make(map[string]struct{})
+	}
+	s.refreshing[key] = struct{}{}
+	ctx = context.WithoutCancel(ctx)
+	params = params.Copy()
+	go func() {
+		defer func() {
+			s.refreshMu.Lock()
+			delete(s.refreshing, key)
+			s.refreshMu.Unlock()
+		}()
+		_, err := s.getServer(ctx, key, params)
+		if err != nil && s.ErrorFunc != nil {
+			s.ErrorFunc(err, params)
+		}
+	}()
+}
+
+// setReadCloser is a io.ReadCloser that keeps the read data, and calls set with it when it is closed after reading all data.
+type setReadCloser struct {
+	io.ReadCloser
+	set     func(data []byte) error
+	buf     bytes.Buffer
+	eof     bool
+	tooLong bool
+}
+
+func (rc *setReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if n > 0 && !rc.tooLong {
+		if rc.buf.Len()+n > imageserver.ImageDataMaxLen {
+			rc.tooLong = true
+			rc.buf = bytes.Buffer{}
+		} else {
+			rc.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		rc.eof = true
+	}
+	return n, err
+}
+
+func (rc *setReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if err != nil {
+		return err
+	}
+	if !rc.eof || rc.tooLong || rc.set == nil {
+		return nil
+	}
+	set := rc.set
+	rc.set = nil
+	return set(rc.buf.Bytes())
+}
+
 // KeyGenerator represents a Cache key generator.
 type KeyGenerator interface {
 	GetKey(imageserver.Params) string
@@ -1,9 +1,12 @@
 package cache_test
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/pierrre/compare"
 	"github.com/pierrre/imageserver"
@@ -14,6 +17,8 @@ import (
 
 var _ imageserver.Server = &Server{}
 
+var _ imageserver.StreamServer = &Server{}
+
 func TestServer(t *testing.T) {
 	s := &Server{
 		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
@@ -94,6 +99,119 @@ func TestServerErrorCacheSet(t *testing.T) {
 	}
 }
 
+func TestServerGetStream(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		readAll     bool
+		expectedSet bool
+	}{
+		{
+			name:        "ReadAll",
+			readAll:     true,
+			expectedSet: true,
+		},
+		{
+			name: "Partial",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := cachetest.NewMapCache()
+			srv := &testStreamServer{}
+			s := &Server{
+				Server: srv,
+				Cache:  cache,
+				KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+					return "test"
+				}),
+			}
+			st, err := s.GetStream(t.Context(), imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !srv.called {
+				t.Fatal("GetStream not forwarded")
+			}
+			if tc.readAll {
+				_, err = io.ReadAll(st.Body)
+			} else {
+				_, err = st.Body.Read(make([]byte, 1))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = st.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			im, err := cache.Get("test", imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.expectedSet {
+				if im != nil {
+					t.Fatal("image set")
+				}
+				return
+			}
+			diff := compare.Compare(im, testdata.Medium)
+			if len(diff) != 0 {
+				t.Fatalf("images not equal, diff:\n%+v", diff)
+			}
+			srv.called = false
+			st, err = s.GetStream(t.Context(), imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = st.Body.Close()
+			if srv.called {
+				t.Fatal("GetStream forwarded")
+			}
+		})
+	}
+}
+
+func TestServerGetStreamErrorCacheSet(t *testing.T) {
+	s := &Server{
+		Server: &testStreamServer{},
+		Cache: &Func{
+			GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+				return nil, nil
+			},
+			SetFunc: func(key string, image *imageserver.Image, params imageserver.Params) error {
+				return fmt.Errorf("error")
+			},
+		},
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+	}
+	st, err := s.GetStream(t.Context(), imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(st.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Body.Close()
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type testStreamServer struct {
+	called bool
+}
+
+func (srv *testStreamServer) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return nil, fmt.Errorf("not called")
+}
+
+func (srv *testStreamServer) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	srv.called = true
+	return imageserver.NewImageStream(testdata.Medium), nil
+}
+
 var _ KeyGenerator = KeyGeneratorFunc(nil)
 
 func TestNewParamsHashKeyGenerator(t *testing.T) {
@@ -116,3 +234,99 @@ func TestPrefixKeyGenerator(t *testing.T) {
 		t.Fatal("not equal")
 	}
 }
+
+func TestServerStaleWhileRevalidate(t *testing.T) {
+	c := &testEntryCache{
+		entry: &Entry{
+			Image:   testdata.Small,
+			Expires: time.Now().Add(-time.Minute),
+		},
+		setCh: make(chan *imageserver.Image, 1),
+	}
+	serverCalled := make(chan struct{}, 2)
+	s := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			serverCalled <- struct{}{}
+			return testdata.Medium, nil
+		}),
+		Cache: c,
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+		StaleWhileRevalidate: true,
+	}
+	im, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Small {
+		t.Fatal("stale image not returned")
+	}
+	<-serverCalled
+	im = <-c.setCh
+	if im != testdata.Medium {
+		t.Fatal("image not refreshed")
+	}
+	c.entry = &Entry{Image: testdata.Medium}
+	im, err = s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("fresh image not returned")
+	}
+	select {
+	case <-serverCalled:
+		t.Fatal("server called for a fresh image")
+	default:
+	}
+}
+
+func TestServerStaleWhileRevalidateError(t *testing.T) {
+	errCh := make(chan error, 1)
+	s := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			return nil, fmt.Errorf("error")
+		}),
+		Cache: &testEntryCache{
+			entry: &Entry{
+				Image:   testdata.Small,
+				Expires: time.Now().Add(-time.Minute),
+			},
+		},
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+		StaleWhileRevalidate: true,
+		ErrorFunc: func(err error, params imageserver.Params) {
+			errCh <- err
+		},
+	}
+	_, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type testEntryCache struct {
+	entry *Entry
+	setCh chan *imageserver.Image
+}
+
+func (c *testEntryCache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	panic("not implemented")
+}
+
+func (c *testEntryCache) GetEntry(ctx context.Context, key string, params imageserver.Params) (*Entry, error) {
+	return c.entry, nil
+}
+
+func (c *testEntryCache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
+	if c.setCh != nil {
+		c.setCh <- im
+	}
+	return nil
+}
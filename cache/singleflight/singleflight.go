@@ -0,0 +1,116 @@
+// Package singleflight provides a imageserver.Server implementation that coalesces duplicate concurrent calls.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+)
+
+// Server is a imageserver.Server implementation that coalesces duplicate concurrent calls.
+//
+// Calls with the same key (generated by KeyGenerator) share a single call to the underlying Server,
+// and the result is returned to all callers.
+// The returned Image is shared and must not be modified.
+//
+// The result is forgotten as soon as the call returns, so errors are not cached.
+// If the underlying Server panics, the panic is recovered and returned as an error to all callers.
+//
+// It implements imageserver.ContextServer.
+// A caller stops waiting if its context is done, and the underlying call is canceled only if there is no caller left.
+// The underlying call receives the values of the first caller's context.
+type Server struct {
+	imageserver.Server
+	KeyGenerator imageserver_cache.KeyGenerator
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	im      *imageserver.Image
+	err     error
+}
+
+// Get implements imageserver.Server.
+func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	key := srv.KeyGenerator.GetKey(params)
+	c := srv.join(ctx, key, params)
+	select {
+	case <-c.done:
+		return c.im, c.err
+	case <-ctx.Done():
+		srv.leave(key, c)
+		return nil, ctx.Err()
+	}
+}
+
+func (srv *Server) join(ctx context.Context, key string, params imageserver.Params) *call {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	c, ok := srv.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		if srv.calls == nil {
+			srv.calls = make(map[string]*call)
+		}
+		srv.calls[key] = c
+		go srv.do(callCtx, key, c, params)
+	}
+	c.waiters++
+	return c
+}
+
+func (srv *Server) leave(key string, c *call) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	c.cancel()
+	srv.forget(key, c)
+}
+
+func (srv *Server) do(ctx context.Context, key string, c *call, params imageserver.Params) {
+	c.im, c.err = srv.get(ctx, params)
+	srv.mu.Lock()
+	srv.forget(key, c)
+	srv.mu.Unlock()
+	c.cancel()
+	close(c.done)
+}
+
+// get calls the underlying Server, and converts a panic to an error.
+//
+// The call runs in its own goroutine, so a panic would crash the program and block the callers.
+func (srv *Server) get(ctx context.Context, params imageserver.Params) (im *imageserver.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			im, err = nil, fmt.Errorf("singleflight: panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return imageserver.GetContext(ctx, srv.Server, params)
+}
+
+func (srv *Server) forget(key string, c *call) {
+	if srv.calls[key] == c {
+		delete(srv.calls, key)
+	}
+}
@@ -0,0 +1,222 @@
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver.ContextServer = &Server{}
+
+var testKeyGenerator = imageserver_cache.KeyGeneratorFunc(func(params imageserver.Params) string {
+	return params.String()
+})
+
+func TestServer(t *testing.T) {
+	var count int32
+	startCh := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			atomic.AddInt32(&count, 1)
+			<-startCh
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			im, err := srv.Get(imageserver.Params{"foo": "bar"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if im != testdata.Medium {
+				t.Error("unexpected image")
+			}
+		}()
+	}
+	testWaitWaiters(t, srv, "map[foo:bar]", n)
+	close(startCh)
+	wg.Wait()
+	if count != 1 {
+		t.Fatalf("unexpected call count: got %d, want 1", count)
+	}
+}
+
+func TestServerDifferentKeys(t *testing.T) {
+	var count int32
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			atomic.AddInt32(&count, 1)
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	for i := 0; i < 3; i++ {
+		_, err := srv.Get(imageserver.Params{"foo": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 3 {
+		t.Fatalf("unexpected call count: got %d, want 3", count)
+	}
+}
+
+func TestServerErrorNotCached(t *testing.T) {
+	var count int32
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				return nil, fmt.Errorf("error")
+			}
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	_, err := srv.Get(imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	_, err = srv.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	startCh := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			<-startCh
+			panic("test")
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			im, err := srv.Get(imageserver.Params{})
+			if err == nil || !strings.Contains(err.Error(), "panic: test") {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if im != nil {
+				t.Error("unexpected image")
+			}
+		}()
+	}
+	testWaitWaiters(t, srv, "map[]", n)
+	close(startCh)
+	wg.Wait()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.calls) != 0 {
+		t.Fatalf("unexpected calls: %v", srv.calls)
+	}
+}
+
+func TestServerContextCanceledWaiter(t *testing.T) {
+	startCh := make(chan struct{})
+	canceledCh := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			select {
+			case <-startCh:
+				return testdata.Medium, nil
+			case <-ctx.Done():
+				close(canceledCh)
+				return nil, ctx.Err()
+			}
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := srv.GetContext(ctx, imageserver.Params{})
+		errCh <- err
+	}()
+	resCh := make(chan error, 1)
+	go func() {
+		_, err := srv.Get(imageserver.Params{})
+		resCh <- err
+	}()
+	testWaitWaiters(t, srv, "map[]", 2)
+	cancel()
+	err := <-errCh
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(startCh)
+	err = <-resCh
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-canceledCh:
+		t.Fatal("underlying call canceled")
+	default:
+	}
+}
+
+func TestServerContextCanceledAllWaiters(t *testing.T) {
+	canceledCh := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			<-ctx.Done()
+			close(canceledCh)
+			return nil, ctx.Err()
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := srv.GetContext(ctx, imageserver.Params{})
+		errCh <- err
+	}()
+	testWaitWaiters(t, srv, "map[]", 1)
+	cancel()
+	err := <-errCh
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-canceledCh:
+	case <-time.After(1 * time.Second):
+		t.Fatal("underlying call not canceled")
+	}
+}
+
+func testWaitWaiters(tb testing.TB, srv *Server, key string, n int) {
+	deadline := time.Now().Add(1 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.mu.Lock()
+		c, ok := srv.calls[key]
+		waiters := 0
+		if ok {
+			waiters = c.waiters
+		}
+		srv.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	tb.Fatalf("timeout while waiting for %d waiters", n)
+}
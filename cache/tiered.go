@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+// WritePolicy is the write policy of a Tier.
+type WritePolicy int
+
+const (
+	// WriteThrough writes the Image to the Tier synchronously.
+	WriteThrough WritePolicy = iota
+	// WriteBack writes the Image to the Tier asynchronously, from a new goroutine.
+	// The errors are not returned, and are reported to Tiered.ErrorFunc.
+	WriteBack
+)
+
+// Tier is a tier of a Tiered Cache.
+type Tier struct {
+	Cache
+
+	// WritePolicy is the write policy used by Set and the promotion.
+	WritePolicy WritePolicy
+
+	// IgnoreGetError ignores the errors returned by Get.
+	// The next Tier is checked as if it was a miss.
+	IgnoreGetError bool
+
+	// IgnoreSetError ignores the errors returned by Set.
+	// The next Tiers are still written.
+	IgnoreSetError bool
+}
+
+// Tiered is a Cache implementation that combines several tiers (e.g. memory, file and remote).
+//
+// Get checks the Tiers in order, and returns the first hit.
+// An expired Entry (see EntryCache) is not a hit for Get, and the next Tiers are checked.
+// A hit in a lower Tier is promoted: the Entry is written to the upper Tiers with their WritePolicy (see SetEntry).
+// The expiration of the Entry is kept, so a promoted Image doesn't live longer than in the lower Tier.
+// A promotion error never fails Get, it is reported to ErrorFunc.
+//
+// GetEntry is like Get, but returns an expired Entry (the first one) if no Tier has a hit,
+// so it supports the StaleWhileRevalidate option of Server.
+//
+// Set writes the Image to all Tiers with their WritePolicy.
+//
+// It implements ContextCache, EntryCache and EntrySetter.
+type Tiered struct {
+	// Tiers are the tiers, from the fastest (L1) to the slowest.
+	Tiers []Tier
+
+	// ErrorFunc is an optional function that is called for the errors that are ignored or not returned.
+	// The index of the Tier is given.
+	ErrorFunc func(err error, tier int)
+}
+
+// Get implements Cache.
+func (c *Tiered) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	return c.GetContext(context.Background(), key, params)
+}
+
+// GetContext implements ContextCache.
+func (c *Tiered) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	e, err := c.getEntry(ctx, key, params, false)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.Image, nil
+}
+
+// GetEntry implements EntryCache.
+func (c *Tiered) GetEntry(ctx context.Context, key string, params imageserver.Params) (*Entry, error) {
+	return c.getEntry(ctx, key, params, true)
+}
+
+func (c *Tiered) getEntry(ctx context.Context, key string, params imageserver.Params, expired bool) (*Entry, error) {
+	now := time.Now()
+	var stale *Entry
+	staleTier := -1
+	for i, t := range c.Tiers {
+		e, err := GetEntry(ctx, t.Cache, key, params)
+		if err != nil {
+			if !t.IgnoreGetError || ctx.Err() != nil {
+				return nil, err
+			}
+			c.onError(err, i)
+			continue
+		}
+		if e == nil {
+			continue
+		}
+		if e.Expired(now) {
+			if stale == nil {
+				stale, staleTier = e, i
+			}
+			continue
+		}
+		c.promote(ctx, i, key, e, params)
+		return e, nil
+	}
+	if expired && stale != nil {
+		c.promote(ctx, staleTier, key, stale, params)
+		return stale, nil
+	}
+	return nil, nil
+}
+
+func (c *Tiered) promote(ctx context.Context, tier int, key string, e *Entry, params imageserver.Params) {
+	ctx = context.WithoutCancel(ctx)
+	for i := range tier {
+		err := c.setTier(ctx, i, func(ctx context.Context, t Cache) error {
+			return SetEntry(ctx, t, key, e, params)
+		})
+		if err != nil {
+			c.onError(err, i)
+		}
+	}
+}
+
+// Set implements Cache.
+func (c *Tiered) Set(key string, im *imageserver.Image, params imageserver.Params) error {
+	return c.SetContext(context.Background(), key, im, params)
+}
+
+// SetContext implements ContextCache.
+func (c *Tiered) SetContext(ctx context.Context, key string, im *imageserver.Image, params imageserver.Params) error {
+	return c.set(ctx, func(ctx context.Context, t Cache) error {
+		return SetContext(ctx, t, key, im, params)
+	})
+}
+
+// SetEntry implements EntrySetter.
+func (c *Tiered) SetEntry(ctx context.Context, key string, e *Entry, params imageserver.Params) error {
+	return c.set(ctx, func(ctx context.Context, t Cache) error {
+		return SetEntry(ctx, t, key, e, params)
+	})
+}
+
+func (c *Tiered) set(ctx context.Context, set func(ctx context.Context, t Cache) error) error {
+	for i, t := range c.Tiers {
+		err := c.setTier(ctx, i, set)
+		if err != nil {
+			if !t.IgnoreSetError {
+				return err
+			}
+			c.onError(err, i)
+		}
+	}
+	return nil
+}
+
+func (c *Tiered) setTier(ctx context.Context, i int, set func(ctx context.Context, t Cache) error) error {
+	t := c.Tiers[i]
+	if t.WritePolicy == WriteBack {
+		ctx = context.WithoutCancel(ctx)
+		go func() {
+			err := set(ctx, t.Cache)
+			if err != nil {
+				c.onError(err, i)
+			}
+		}()
+		return nil
+	}
+	return set(ctx, t.Cache)
+}
+
+func (c *Tiered) onError(err error, tier int) {
+	if c.ErrorFunc != nil {
+		c.ErrorFunc(err, tier)
+	}
+}
@@ -0,0 +1,345 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	. "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	imageserver_cache_memory "github.com/pierrre/imageserver/cache/memory"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ ContextCache = &Tiered{}
+
+var _ EntryCache = &Tiered{}
+
+var _ EntrySetter = &Tiered{}
+
+func TestTieredGetSet(t *testing.T) {
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: cachetest.NewMapCache()},
+			{Cache: cachetest.NewMapCache()},
+		},
+	}
+	cachetest.TestGetSet(t, c)
+}
+
+func TestTieredGetMiss(t *testing.T) {
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: cachetest.NewMapCache()},
+			{Cache: cachetest.NewMapCache()},
+		},
+	}
+	cachetest.TestGetMiss(t, c)
+}
+
+func TestTieredPromotion(t *testing.T) {
+	l1 := cachetest.NewMapCache()
+	l2 := cachetest.NewMapCache()
+	l3 := cachetest.NewMapCache()
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l1},
+			{Cache: l2},
+			{Cache: l3},
+		},
+	}
+	err := l3.Set("foo", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := c.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("not equal")
+	}
+	for i, tc := range []Cache{l1, l2} {
+		im, err = tc.Get("foo", imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if im != testdata.Medium {
+			t.Fatalf("not promoted to tier %d", i)
+		}
+	}
+}
+
+func TestTieredWriteBack(t *testing.T) {
+	l1 := cachetest.NewMapCache()
+	setCallCh := make(chan struct{})
+	l2 := &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return nil, nil
+		},
+		SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+			setCallCh <- struct{}{}
+			return fmt.Errorf("error")
+		},
+	}
+	errCh := make(chan int, 1)
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l1},
+			{Cache: l2, WritePolicy: WriteBack},
+		},
+		ErrorFunc: func(err error, tier int) {
+			errCh <- tier
+		},
+	}
+	err := c.Set("foo", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-setCallCh
+	if tier := <-errCh; tier != 1 {
+		t.Fatalf("unexpected tier: got %d, want %d", tier, 1)
+	}
+	im, err := l1.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("no image")
+	}
+}
+
+func TestTieredError(t *testing.T) {
+	errorCache := &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return nil, fmt.Errorf("error")
+		},
+		SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+			return fmt.Errorf("error")
+		},
+	}
+	for _, tc := range []struct {
+		name           string
+		ignoreGetError bool
+		ignoreSetError bool
+		expectedGetErr bool
+		expectedSetErr bool
+		expectedErrors int
+	}{
+		{
+			name:           "NotIgnored",
+			expectedGetErr: true,
+			expectedSetErr: true,
+		},
+		{
+			name:           "Ignored",
+			ignoreGetError: true,
+			ignoreSetError: true,
+			expectedErrors: 3, // Set, Get and promotion.
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l2 := cachetest.NewMapCache()
+			errorCount := 0
+			c := &Tiered{
+				Tiers: []Tier{
+					{
+						Cache:          errorCache,
+						IgnoreGetError: tc.ignoreGetError,
+						IgnoreSetError: tc.ignoreSetError,
+					},
+					{Cache: l2},
+				},
+				ErrorFunc: func(err error, tier int) {
+					errorCount++
+				},
+			}
+			err := c.Set("foo", testdata.Medium, imageserver.Params{})
+			if (err != nil) != tc.expectedSetErr {
+				t.Fatalf("unexpected Set error: %v", err)
+			}
+			err = l2.Set("foo", testdata.Medium, imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			im, err := c.Get("foo", imageserver.Params{})
+			if (err != nil) != tc.expectedGetErr {
+				t.Fatalf("unexpected Get error: %v", err)
+			}
+			if !tc.expectedGetErr && im == nil {
+				t.Fatal("no image")
+			}
+			if errorCount != tc.expectedErrors {
+				t.Fatalf("unexpected error count: got %d, want %d", errorCount, tc.expectedErrors)
+			}
+		})
+	}
+}
+
+func TestTieredPromotionKeepsExpiration(t *testing.T) {
+	l1 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l1.Expire = 24 * time.Hour
+	l2 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l1},
+			{Cache: l2},
+		},
+	}
+	ctx := context.Background()
+	expires := time.Now().Add(time.Minute)
+	err := l2.SetEntry(ctx, "foo", &Entry{Image: testdata.Medium, Expires: expires}, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := c.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("not equal")
+	}
+	e, err := l1.GetEntry(ctx, "foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil {
+		t.Fatal("not promoted")
+	}
+	if !e.Expires.Equal(expires) {
+		t.Fatalf("unexpected expiration: got %s, want %s", e.Expires, expires)
+	}
+}
+
+func TestTieredStale(t *testing.T) {
+	l1 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l1.Stale = time.Hour
+	l2 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l2.Stale = time.Hour
+	l3 := cachetest.NewMapCache()
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l3},
+			{Cache: l1},
+			{Cache: l2},
+		},
+	}
+	ctx := context.Background()
+	expires := time.Now().Add(-time.Minute)
+	err := l2.SetEntry(ctx, "foo", &Entry{Image: testdata.Medium, Expires: expires}, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := c.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != nil {
+		t.Fatal("expired image returned by Get")
+	}
+	e, err := c.GetEntry(ctx, "foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Image != testdata.Medium {
+		t.Fatal("stale entry not returned by GetEntry")
+	}
+	e, err = l1.GetEntry(ctx, "foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || !e.Expires.Equal(expires) {
+		t.Fatal("stale entry not promoted with its expiration")
+	}
+	im, err = l3.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != nil {
+		t.Fatal("stale entry promoted to a Cache without expiration")
+	}
+}
+
+func TestTieredStaleFreshLowerTier(t *testing.T) {
+	l1 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l1.Stale = time.Hour
+	l2 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l1},
+			{Cache: l2},
+		},
+	}
+	ctx := context.Background()
+	err := l1.SetEntry(ctx, "foo", &Entry{Image: testdata.Small, Expires: time.Now().Add(-time.Minute)}, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l2.Set("foo", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.GetEntry(ctx, "foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Image != testdata.Medium {
+		t.Fatal("fresh entry not returned")
+	}
+	im, err := l1.Get("foo", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("fresh entry not promoted")
+	}
+}
+
+func TestTieredServerStaleWhileRevalidate(t *testing.T) {
+	l1 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l2 := imageserver_cache_memory.New(10 * 1024 * 1024)
+	l2.Stale = time.Hour
+	c := &Tiered{
+		Tiers: []Tier{
+			{Cache: l1},
+			{Cache: l2},
+		},
+	}
+	err := l2.SetEntry(context.Background(), "test", &Entry{Image: testdata.Small, Expires: time.Now().Add(-time.Minute)}, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed := make(chan struct{})
+	s := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			defer close(refreshed)
+			return testdata.Medium, nil
+		}),
+		Cache: c,
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+		StaleWhileRevalidate: true,
+	}
+	im, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Small {
+		t.Fatal("stale image not returned")
+	}
+	<-refreshed
+	for range 100 {
+		im, err = c.Get("test", imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if im == testdata.Medium {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("image not refreshed")
+}
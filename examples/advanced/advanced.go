@@ -14,11 +14,16 @@ import (
 	"github.com/pierrre/imageserver"
 	imageserver_cache "github.com/pierrre/imageserver/cache"
 	imageserver_cache_memory "github.com/pierrre/imageserver/cache/memory"
+	imageserver_cache_singleflight "github.com/pierrre/imageserver/cache/singleflight"
 	imageserver_http "github.com/pierrre/imageserver/http"
 	imageserver_http_crop "github.com/pierrre/imageserver/http/crop"
 	imageserver_http_gamma "github.com/pierrre/imageserver/http/gamma"
 	imageserver_http_gift "github.com/pierrre/imageserver/http/gift"
 	imageserver_http_image "github.com/pierrre/imageserver/http/image"
+	imageserver_http_ops "github.com/pierrre/imageserver/http/ops"
+	imageserver_http_overlay "github.com/pierrre/imageserver/http/overlay"
+	imageserver_http_smartcrop "github.com/pierrre/imageserver/http/smartcrop"
+	imageserver_http_text "github.com/pierrre/imageserver/http/text"
 	imageserver_image "github.com/pierrre/imageserver/image"
 	_ "github.com/pierrre/imageserver/image/bmp"
 	imageserver_image_crop "github.com/pierrre/imageserver/image/crop"
@@ -26,9 +31,17 @@ import (
 	imageserver_image_gif "github.com/pierrre/imageserver/image/gif"
 	imageserver_image_gift "github.com/pierrre/imageserver/image/gift"
 	_ "github.com/pierrre/imageserver/image/jpeg"
+	imageserver_image_ops "github.com/pierrre/imageserver/image/ops"
+	imageserver_image_overlay "github.com/pierrre/imageserver/image/overlay"
 	_ "github.com/pierrre/imageserver/image/png"
+	imageserver_image_smartcrop "github.com/pierrre/imageserver/image/smartcrop"
+	imageserver_image_text "github.com/pierrre/imageserver/image/text"
 	_ "github.com/pierrre/imageserver/image/tiff"
+	imageserver_metrics "github.com/pierrre/imageserver/metrics"
 	imageserver_testdata "github.com/pierrre/imageserver/testdata"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
 )
 
 var (
@@ -37,6 +50,11 @@ var (
 	flagCache               = int64(128 * (1 << 20))
 )
 
+var metrics = imageserver_metrics.New("imageserver")
+
+// acceptFormats are the formats negotiated with the "Accept" header (see webp.go).
+var acceptFormats []string
+
 func main() {
 	parseFlags()
 	startHTTPServer()
@@ -60,6 +78,7 @@ func newHTTPHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/", http.StripPrefix("/", newImageHTTPHandler()))
 	mux.Handle("/favicon.ico", http.NotFoundHandler())
+	mux.Handle("/metrics", metrics)
 	if h := newGitHubWebhookHTTPHandler(); h != nil {
 		mux.Handle("/github_webhook", h)
 	}
@@ -87,15 +106,34 @@ func newImageHTTPHandler() http.Handler {
 		Parser: imageserver_http.ListParser([]imageserver_http.Parser{
 			&imageserver_http.SourcePathParser{},
 			&imageserver_http_crop.Parser{},
+			&imageserver_http_smartcrop.Parser{},
+			&imageserver_http_gift.AutoOrientParser{},
 			&imageserver_http_gift.RotateParser{},
-			&imageserver_http_gift.ResizeParser{},
-			&imageserver_http_image.FormatParser{},
+			&imageserver_http_gift.AdjustParser{},
+			&imageserver_http_ops.Parser{},
+			&imageserver_http_gift.ResizeParser{
+				ClientHints: true,
+				MaxWidth:    2048,
+			},
+			&imageserver_http_image.FormatParser{
+				AcceptFormats: acceptFormats,
+			},
+			&imageserver_http_overlay.Parser{},
+			&imageserver_http_text.Parser{},
 			&imageserver_http_image.QualityParser{},
+			&imageserver_http_image.LosslessParser{},
 			&imageserver_http_gamma.CorrectionParser{},
+			&imageserver_http_image.MetadataParser{},
+			&imageserver_http_image.InfoParser{},
 		}),
 		Server:   newServer(),
 		ETagFunc: imageserver_http.NewParamsHashETagFunc(sha256.New),
 	}
+	handler = &imageserver_metrics.HTTPHandler{
+		Handler: handler,
+		Metrics: metrics,
+		Name:    "image",
+	}
 	handler = &imageserver_http.ExpiresHandler{
 		Handler: handler,
 		Expires: 7 * 24 * time.Hour,
@@ -107,35 +145,71 @@ func newImageHTTPHandler() http.Handler {
 }
 
 func newServer() imageserver.Server {
-	srv := imageserver_testdata.Server
+	var srv imageserver.Server = &imageserver_metrics.Server{
+		Server:  imageserver_testdata.Server,
+		Metrics: metrics,
+		Name:    "source",
+	}
 	srv = newServerImage(srv)
+	srv = newServerInfo(srv)
 	srv = newServerLimit(srv)
+	srv = newServerSingleflight(srv)
 	srv = newServerCacheMemory(srv)
 	return srv
 }
 
 func newServerImage(srv imageserver.Server) imageserver.Server {
 	basicHdr := &imageserver_image.Handler{
-		Processor: imageserver_image_gamma.NewCorrectionProcessor(
-			imageserver_image.ListProcessor([]imageserver_image.Processor{
-				&imageserver_image_crop.Processor{},
-				&imageserver_image_gift.RotateProcessor{
-					DefaultInterpolation: gift.CubicInterpolation,
-				},
-				&imageserver_image_gift.ResizeProcessor{
-					DefaultResampling: gift.LanczosResampling,
-					MaxWidth:          2048,
-					MaxHeight:         2048,
-				},
-			}),
-			true,
-		),
+		Processor: imageserver_image.ListProcessor([]imageserver_image.Processor{
+			&imageserver_image_gift.AutoOrientProcessor{},
+			imageserver_image_gamma.NewCorrectionProcessor(
+				imageserver_image.ListProcessor([]imageserver_image.Processor{
+					&imageserver_image_crop.Processor{},
+					&imageserver_image_smartcrop.Processor{},
+					&imageserver_image_gift.RotateProcessor{
+						DefaultInterpolation: gift.CubicInterpolation,
+					},
+					&imageserver_image_gift.ResizeProcessor{
+						DefaultResampling: gift.LanczosResampling,
+						MaxWidth:          2048,
+						MaxHeight:         2048,
+					},
+					&imageserver_image_ops.Processor{
+						Processors: map[string]imageserver_image.Processor{
+							"crop": &imageserver_image_crop.Processor{},
+							"rotate": &imageserver_image_gift.RotateProcessor{
+								DefaultInterpolation: gift.CubicInterpolation,
+							},
+							"resize": &imageserver_image_gift.ResizeProcessor{
+								DefaultResampling: gift.LanczosResampling,
+								MaxWidth:          2048,
+								MaxHeight:         2048,
+							},
+						},
+						MaxWidth:  4096,
+						MaxHeight: 4096,
+					},
+				}),
+				true,
+			),
+			&imageserver_image_gift.AdjustProcessor{},
+			&imageserver_image_overlay.Processor{
+				Server:    imageserver_testdata.Server,
+				MinWidth:  400,
+				MinHeight: 400,
+			},
+			&imageserver_image_text.Processor{
+				Fonts:       newFonts(),
+				DefaultFont: "regular",
+			},
+		}),
 	}
 	gifHdr := &imageserver_image_gif.FallbackHandler{
 		Handler: &imageserver_image_gif.Handler{
 			Processor: &imageserver_image_gif.SimpleProcessor{
 				Processor: imageserver_image.ListProcessor([]imageserver_image.Processor{
 					&imageserver_image_crop.Processor{},
+					&imageserver_image_smartcrop.Processor{},
 					&imageserver_image_gift.RotateProcessor{
 						DefaultInterpolation: gift.NearestNeighborInterpolation,
 					},
@@ -149,9 +223,35 @@ func newServerImage(srv imageserver.Server) imageserver.Server {
 		},
 		Fallback: basicHdr,
 	}
+	return &imageserver.HandlerServer{
+		Server: srv,
+		Handler: &imageserver_metrics.Handler{
+			Handler: gifHdr,
+			Metrics: metrics,
+			Name:    "image",
+		},
+	}
+}
+
+func newFonts() map[string]*opentype.Font {
+	fonts := make(map[string]*opentype.Font)
+	for name, data := range map[string][]byte{
+		"regular": goregular.TTF,
+		"bold":    gobold.TTF,
+	} {
+		f, err := opentype.Parse(data)
+		if err != nil {
+			panic(err)
+		}
+		fonts[name] = f
+	}
+	return fonts
+}
+
+func newServerInfo(srv imageserver.Server) imageserver.Server {
 	return &imageserver.HandlerServer{
 		Server:  srv,
-		Handler: gifHdr,
+		Handler: &imageserver_image.InfoHandler{},
 	}
 }
 
@@ -159,13 +259,24 @@ func newServerLimit(srv imageserver.Server) imageserver.Server {
 	return imageserver.NewLimitServer(srv, runtime.GOMAXPROCS(0)*2)
 }
 
+func newServerSingleflight(srv imageserver.Server) imageserver.Server {
+	return &imageserver_cache_singleflight.Server{
+		Server:       srv,
+		KeyGenerator: imageserver_cache.NewParamsHashKeyGenerator(sha256.New),
+	}
+}
+
 func newServerCacheMemory(srv imageserver.Server) imageserver.Server {
 	if flagCache <= 0 {
 		return srv
 	}
 	return &imageserver_cache.Server{
-		Server:       srv,
-		Cache:        imageserver_cache_memory.New(flagCache),
+		Server: srv,
+		Cache: &imageserver_metrics.Cache{
+			Cache:   imageserver_cache_memory.New(flagCache),
+			Metrics: metrics,
+			Name:    "memory",
+		},
 		KeyGenerator: imageserver_cache.NewParamsHashKeyGenerator(sha256.New),
 	}
 }
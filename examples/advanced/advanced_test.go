@@ -1,27 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"image"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	imageserver_image "github.com/pierrre/imageserver/image"
 	"github.com/pierrre/imageserver/testdata"
 )
 
-// nolint: gocyclo
 func Test(t *testing.T) {
-	h := newHTTPHandler()
-	for _, tc := range []struct {
-		name               string
-		path               string
-		query              url.Values
-		expectedStatusCode int
-		expectedFormat     string
-		expectedWidth      int
-		expectedHeight     int
-	}{
+	testHTTPHandler(t, []httpTestCase{
 		{
 			name:               "NoPath",
 			expectedStatusCode: http.StatusBadRequest,
@@ -92,6 +84,23 @@ func Test(t *testing.T) {
 			},
 			expectedFormat: "jpeg",
 		},
+		{
+			name: "StripInvalid",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"strip": {"invalid"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Strip",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"strip":    {"all"},
+				"keep_icc": {"true"},
+			},
+			expectedFormat: "jpeg",
+		},
 		{
 			name: "WidthInvalidNegative",
 			path: testdata.MediumFileName,
@@ -116,6 +125,37 @@ func Test(t *testing.T) {
 			},
 			expectedWidth: 100,
 		},
+		{
+			name: "DPR",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"width": {"100"},
+				"dpr":   {"2"},
+			},
+			expectedWidth: 200,
+		},
+		{
+			name: "DPRInvalid",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"width": {"100"},
+				"dpr":   {"10"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "FillFocus",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"width":   {"100"},
+				"height":  {"100"},
+				"mode":    {"fill"},
+				"focus_x": {"0.2"},
+				"focus_y": {"0.3"},
+			},
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
 		{
 			name: "HeightInvalidNegative",
 			path: testdata.MediumFileName,
@@ -140,6 +180,103 @@ func Test(t *testing.T) {
 			},
 			expectedHeight: 100,
 		},
+		{
+			name: "SmartCrop",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"smart_crop": {"1:1"},
+				"gravity":    {"attention"},
+			},
+			expectedWidth:  819,
+			expectedHeight: 819,
+		},
+		{
+			name: "SmartCropInvalidGravity",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"smart_crop": {"1:1"},
+				"gravity":    {"invalid"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Overlay",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"overlay":         {testdata.RandomFileName},
+				"overlay_gravity": {"south_east"},
+				"overlay_scale":   {"0.25"},
+				"overlay_opacity": {"0.5"},
+			},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name: "OverlayInvalidSource",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"overlay": {"invalid"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Text",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"text":         {"Hello world"},
+				"text_font":    {"bold"},
+				"text_size":    {"48"},
+				"text_gravity": {"south"},
+				"text_shadow":  {"2"},
+			},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name: "TextInvalidFont",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"text":      {"Hello world"},
+				"text_font": {"invalid"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Adjust",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"width":      {"100"},
+				"brightness": {"10"},
+				"grayscale":  {"true"},
+				"sharpen":    {"1"},
+			},
+			expectedWidth: 100,
+		},
+		{
+			name: "AdjustInvalidBlur",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"blur": {"100"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Ops",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"ops": {"crop:0,0,400,200|rotate:90|resize:100x0"},
+			},
+			expectedWidth:  100,
+			expectedHeight: 200,
+		},
+		{
+			name: "OpsInvalid",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"ops": {"unknown:1"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
 		{
 			name: "RotationInvalid",
 			path: testdata.MediumFileName,
@@ -166,7 +303,24 @@ func Test(t *testing.T) {
 			expectedWidth:  819,
 			expectedHeight: 1024,
 		},
-	} {
+	})
+}
+
+type httpTestCase struct {
+	name               string
+	path               string
+	query              url.Values
+	expectedStatusCode int
+	expectedFormat     string
+	expectedWidth      int
+	expectedHeight     int
+}
+
+// nolint: gocyclo
+func testHTTPHandler(t *testing.T, tcs []httpTestCase) {
+	t.Helper()
+	h := newHTTPHandler()
+	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
 			u := &url.URL{
 				Scheme:   "http",
@@ -206,3 +360,27 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestInfo(t *testing.T) {
+	h := newHTTPHandler()
+	req, err := http.NewRequest("GET", "http://localhost/"+testdata.MediumFileName+"?width=100&info=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("http status not OK: %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected Content-Type: %s", ct)
+	}
+	info := new(imageserver_image.Info)
+	err = json.Unmarshal(w.Body.Bytes(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 100 {
+		t.Fatalf("unexpected width: got %d, want %d", info.Width, 100)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build webp
+
+package main
+
+// WebP requires cgo (libwebp), so it is only enabled with the "webp" build tag.
+
+import (
+	_ "github.com/pierrre/imageserver/image/webp"
+)
+
+func init() {
+	acceptFormats = append(acceptFormats, "webp")
+}
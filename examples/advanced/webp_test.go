@@ -0,0 +1,33 @@
+//go:build webp
+
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestWebP(t *testing.T) {
+	testHTTPHandler(t, []httpTestCase{
+		{
+			name: "WebP",
+			path: testdata.MediumFileName,
+			query: url.Values{
+				"format":  {"webp"},
+				"quality": {"50"},
+			},
+			expectedFormat: "webp",
+		},
+		{
+			name: "WebPLossless",
+			path: testdata.SmallFileName,
+			query: url.Values{
+				"format":   {"webp"},
+				"lossless": {"true"},
+			},
+			expectedFormat: "webp",
+		},
+	})
+}
@@ -48,6 +48,14 @@ func newImageHTTPHandler() http.Handler {
 			Parser: &imageserver_http.SourcePathParser{},
 			Prefix: urlPrefix,
 		},
-		Server: &imageserver_source_http.Server{},
+		Server: &imageserver_source_http.Server{
+			Policy: &imageserver_source_http.Policy{
+				AllowedSchemes: []string{"https"},
+				AllowedHosts:   []string{"raw.githubusercontent.com"},
+				MaxBodySize:    32 << 20,
+				SniffContent:   true,
+			},
+		},
+		Stream: true,
 	}
 }
@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	github.com/bradfitz/gomemcache v0.0.0-20190329173943-551aad21a668
+	github.com/chai2010/webp v1.4.0
 	github.com/disintegration/gift v1.2.0
 	github.com/go-redis/redis v6.15.2+incompatible
 	github.com/golang/groupcache v0.0.0-20190129154638-5b532d6fd5ef
@@ -21,5 +22,6 @@ require (
 	github.com/onsi/gomega v1.5.0 // indirect
 	golang.org/x/net v0.55.0 // indirect
 	golang.org/x/sys v0.45.0 // indirect
+	golang.org/x/text v0.37.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -3,6 +3,7 @@ package graphicsmagick
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
 )
 
 const (
@@ -26,6 +28,7 @@ const (
 //
 // Params (see GraphicsMagick documentation for more information about arguments):
 //  - width / height: sizes for "-resize" argument (both optionals)
+//  - dpr: device pixel ratio (1 to 4), the width and height are multiplied by it
 //  - fill: "^" for "-resize" argument
 //  - ignore_ratio: "!" for "-resize" argument
 //  - only_shrink_larger: ">" for "-resize" argument
@@ -34,6 +37,9 @@ const (
 //  - extent: "-extent" param, uses width/height params and add "-gravity center" argument
 //  - format: "-format" param
 //  - quality: "-quality" param
+//
+// It implements imageserver.ContextHandler, and the process is killed if the context is done.
+// It implements imageserver.ChangeHandler.
 type Handler struct {
 	// Executable is the path to "gm" executable, usually "/usr/bin/gm".
 	Executable string
@@ -50,6 +56,11 @@ type Handler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	if !params.Has(param) {
 		return im, nil
 	}
@@ -60,7 +71,7 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	if params.Empty() {
 		return im, nil
 	}
-	im, err = hdr.handle(im, params)
+	im, err = hdr.handle(ctx, im, params)
 	if err != nil {
 		if err, ok := err.(*imageserver.ParamError); ok {
 			err.Param = param + "." + err.Param
@@ -70,8 +81,20 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	return im, nil
 }
 
+// Change implements imageserver.ChangeHandler.
+func (hdr *Handler) Change(format string, params imageserver.Params) bool {
+	if !params.Has(param) {
+		return false
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return true
+	}
+	return !params.Empty()
+}
+
 // nolint: gocyclo
-func (hdr *Handler) handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+func (hdr *Handler) handle(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	arguments := list.New()
 
 	width, height, err := hdr.buildArgumentsResize(arguments, params)
@@ -122,7 +145,7 @@ func (hdr *Handler) handle(im *imageserver.Image, params imageserver.Params) (*i
 
 	argumentSlice := convertArgumentsToSlice(arguments)
 	cmd := exec.Command(hdr.Executable, argumentSlice...)
-	err = hdr.runCommand(cmd)
+	err = hdr.runCommand(ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -152,6 +175,11 @@ func (hdr *Handler) buildArgumentsResize(arguments *list.List, params imageserve
 	if err != nil {
 		return 0, 0, err
 	}
+	dpr, err := imageserver_image.GetDPR(params)
+	if err != nil {
+		return 0, 0, err
+	}
+	width, height = imageserver_image.ScaleSize(width, height, dpr, 0, 0)
 	if width == 0 && height == 0 {
 		return 0, 0, nil
 	}
@@ -316,8 +344,12 @@ func convertArgumentsToSlice(arguments *list.List) []string {
 	return argumentSlice
 }
 
-func (hdr *Handler) runCommand(cmd *exec.Cmd) error {
-	err := cmd.Start()
+func (hdr *Handler) runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
 	if err != nil {
 		return err
 	}
@@ -334,6 +366,9 @@ func (hdr *Handler) runCommand(cmd *exec.Cmd) error {
 	case <-timeoutChan:
 		_ = cmd.Process.Kill()
 		err = fmt.Errorf("timeout after %s", hdr.Timeout)
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return ctx.Err()
 	}
 	if err != nil {
 		return &imageserver.ImageError{Message: fmt.Sprintf("GraphicsMagick command: %s", err)}
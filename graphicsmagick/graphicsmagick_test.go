@@ -1,7 +1,9 @@
 package graphicsmagick
 
 import (
+	"container/list"
 	"os/exec"
+	"slices"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 
 const testExecutable = "gm"
 
-var _ imageserver.Handler = &Handler{}
+var _ imageserver.ChangeHandler = &Handler{}
 
 func TestHandle(t *testing.T) {
 	testCheckAvailable(t)
@@ -57,3 +59,86 @@ func testCheckAvailable(tb testing.TB) {
 		tb.Skipf("GraphicsMagick is not available: %s", err)
 	}
 }
+
+func TestChange(t *testing.T) {
+	hdr := &Handler{}
+	for _, tc := range []struct {
+		name     string
+		params   imageserver.Params
+		expected bool
+	}{
+		{
+			name:   "NoParam",
+			params: imageserver.Params{},
+		},
+		{
+			name:   "Empty",
+			params: imageserver.Params{param: imageserver.Params{}},
+		},
+		{
+			name:     "Width",
+			params:   imageserver.Params{param: imageserver.Params{"width": 100}},
+			expected: true,
+		},
+		{
+			name:     "Invalid",
+			params:   imageserver.Params{param: "foo"},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := hdr.Change("jpeg", tc.params)
+			if c != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", c, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBuildArgumentsResizeDPR(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expected           []string
+		expectedParamError string
+	}{
+		{
+			name:     "Default",
+			params:   imageserver.Params{"width": 100},
+			expected: []string{"-resize", "100x"},
+		},
+		{
+			name:     "DPR",
+			params:   imageserver.Params{"width": 100, "height": 50, "dpr": 1.5},
+			expected: []string{"-resize", "150x75"},
+		},
+		{
+			name:               "DPRInvalidRange",
+			params:             imageserver.Params{"width": 100, "dpr": 5.0},
+			expectedParamError: "dpr",
+		},
+		{
+			name:               "DPRInvalidType",
+			params:             imageserver.Params{"width": 100, "dpr": "invalid"},
+			expectedParamError: "dpr",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			arguments := list.New()
+			_, _, err := (&Handler{}).buildArgumentsResize(arguments, tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			res := convertArgumentsToSlice(arguments)
+			if !slices.Equal(res, tc.expected) {
+				t.Fatalf("unexpected arguments: got %q, want %q", res, tc.expected)
+			}
+		})
+	}
+}
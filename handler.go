@@ -1,5 +1,9 @@
 package imageserver
 
+import (
+	"context"
+)
+
 // Handler handles an Image and returns an Image.
 type Handler interface {
 	Handle(*Image, Params) (*Image, error)
@@ -13,7 +17,57 @@ func (f HandlerFunc) Handle(im *Image, params Params) (*Image, error) {
 	return f(im, params)
 }
 
+// ContextHandler is a Handler that supports a context.Context.
+//
+// The context can be used to cancel the execution, set a deadline or carry request scoped values.
+type ContextHandler interface {
+	Handler
+	HandleContext(context.Context, *Image, Params) (*Image, error)
+}
+
+// ContextHandlerFunc is a ContextHandler func.
+type ContextHandlerFunc func(context.Context, *Image, Params) (*Image, error)
+
+// Handle implements Handler.
+//
+// It uses context.Background().
+func (f ContextHandlerFunc) Handle(im *Image, params Params) (*Image, error) {
+	return f(context.Background(), im, params)
+}
+
+// HandleContext implements ContextHandler.
+func (f ContextHandlerFunc) HandleContext(ctx context.Context, im *Image, params Params) (*Image, error) {
+	return f(ctx, im, params)
+}
+
+// HandleContext handles the Image with the Handler and a context.Context.
+//
+// If the Handler implements ContextHandler, it calls HandleContext().
+// Otherwise it returns the context error if the context is done, or calls Handle().
+func HandleContext(ctx context.Context, hdr Handler, im *Image, params Params) (*Image, error) {
+	if hdr, ok := hdr.(ContextHandler); ok {
+		return hdr.HandleContext(ctx, im, params)
+	}
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return hdr.Handle(im, params)
+}
+
+// ChangeHandler is a Handler that can tell if it could change an Image, without reading the Image data.
+type ChangeHandler interface {
+	Handler
+
+	// Change returns true if the Image with the given format could change for the given Params.
+	Change(format string, params Params) bool
+}
+
 // HandlerServer is a Server implementation that calls a Handler.
+//
+// It implements ContextServer and StreamServer.
+// If the Handler implements ChangeHandler and doesn't change the Image, the Stream is returned without being read.
+// Otherwise, the Stream is read and the resulting Image is handled.
 type HandlerServer struct {
 	Server
 	Handler Handler
@@ -21,13 +75,38 @@ type HandlerServer struct {
 
 // Get implements Server.
 func (srv *HandlerServer) Get(params Params) (*Image, error) {
-	im, err := srv.Server.Get(params)
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (srv *HandlerServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	im, err := GetContext(ctx, srv.Server, params)
 	if err != nil {
 		return nil, err
 	}
-	im, err = srv.Handler.Handle(im, params)
+	im, err = HandleContext(ctx, srv.Handler, im, params)
 	if err != nil {
 		return nil, err
 	}
 	return im, nil
 }
+
+// GetStream implements StreamServer.
+func (srv *HandlerServer) GetStream(ctx context.Context, params Params) (*Stream, error) {
+	st, err := GetStream(ctx, srv.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	if hdr, ok := srv.Handler.(ChangeHandler); ok && !hdr.Change(st.Format, params) {
+		return st, nil
+	}
+	im, err := st.ReadImage()
+	if err != nil {
+		return nil, err
+	}
+	im, err = HandleContext(ctx, srv.Handler, im, params)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageStream(im), nil
+}
@@ -1,6 +1,7 @@
 package imageserver
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -19,7 +20,7 @@ func TestHandlerFunc(t *testing.T) {
 	}
 }
 
-var _ Server = &HandlerServer{}
+var _ ContextServer = &HandlerServer{}
 
 func TestHandlerServer(t *testing.T) {
 	srv := &HandlerServer{
@@ -62,3 +63,41 @@ func TestHandlerServerErrorHandler(t *testing.T) {
 		t.Fatal("no error")
 	}
 }
+
+var _ ContextHandler = ContextHandlerFunc(nil)
+
+func TestHandleContextCanceled(t *testing.T) {
+	hdr := HandlerFunc(func(im *Image, params Params) (*Image, error) {
+		t.Fatal("called")
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := HandleContext(ctx, hdr, &Image{}, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHandlerServerContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+	srv := &HandlerServer{
+		Server: ContextServerFunc(func(ctx context.Context, params Params) (*Image, error) {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded to Server")
+			}
+			return &Image{}, nil
+		}),
+		Handler: ContextHandlerFunc(func(ctx context.Context, im *Image, params Params) (*Image, error) {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded to Handler")
+			}
+			return im, nil
+		}),
+	}
+	_, err := srv.GetContext(ctx, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
+)
+
+// Client Hints limits for the "dpr" param.
+const (
+	clientHintsMinDPR = 1
+	clientHintsMaxDPR = 4
+)
+
+// ParseClientHints takes the "dpr" and "width" params from the Client Hints headers, if they are not already set in the Params.
+//
+// Headers (the legacy names without the "Sec-CH-" prefix are also supported):
+//   - Sec-CH-DPR: "dpr" param, clamped between 1 and 4
+//   - Sec-CH-Width: "width" param, converted to CSS pixels with the DPR
+//   - Sec-CH-Viewport-Width: "width" param, if Sec-CH-Width is missing
+//
+// The Client Hints only complete a resize requested by the query, so nothing is done if the Params are empty.
+// The params of the query are never overridden, and the width is not set if the "width" or "height" param is set.
+// The width is limited to maxWidth (if greater than 0), so it is accepted by a Processor with the same limit.
+// Nothing is done if the request is signed (see WithoutClientHints).
+// The invalid header values are ignored.
+// The headers are added to the "Vary" header (see AddVary).
+// The server must request the Client Hints with the "Accept-CH" response header.
+func ParseClientHints(req *http.Request, params imageserver.Params, maxWidth int) {
+	if params.Empty() || !clientHintsEnabled(req) {
+		return
+	}
+	dpr := 1.0
+	if params.Has("dpr") {
+		if f, err := params.GetFloat("dpr"); err == nil {
+			dpr = f
+		}
+	} else {
+		addVaryClientHint(req, "DPR")
+		if f, ok := getClientHintFloat(req, "DPR"); ok {
+			dpr = math.Min(math.Max(f, clientHintsMinDPR), clientHintsMaxDPR)
+			params.Set("dpr", dpr)
+		}
+	}
+	if params.Has("width") || params.Has("height") {
+		return
+	}
+	addVaryClientHint(req, "Width")
+	if f, ok := getClientHintFloat(req, "Width"); ok && f >= 1 && dpr > 0 {
+		setClientHintWidth(params, f/dpr, maxWidth)
+		return
+	}
+	addVaryClientHint(req, "Viewport-Width")
+	if f, ok := getClientHintFloat(req, "Viewport-Width"); ok && f >= 1 {
+		setClientHintWidth(params, f, maxWidth)
+	}
+}
+
+func setClientHintWidth(params imageserver.Params, f float64, maxWidth int) {
+	if maxWidth > 0 {
+		f = math.Min(f, float64(maxWidth))
+	}
+	params.Set("width", int(math.Ceil(f)))
+}
+
+type noClientHintsContextKey struct{}
+
+// WithoutClientHints returns a request for which ParseClientHints does nothing.
+//
+// It should be used when the Params must only depend on the URL, e.g. if the URL is signed (see imageserver/http/signature).
+func WithoutClientHints(req *http.Request) *http.Request {
+	ctx := context.WithValue(req.Context(), noClientHintsContextKey{}, true)
+	return req.WithContext(ctx)
+}
+
+func clientHintsEnabled(req *http.Request) bool {
+	disabled, _ := req.Context().Value(noClientHintsContextKey{}).(bool)
+	return !disabled
+}
+
+func getClientHintFloat(req *http.Request, name string) (float64, bool) {
+	s := req.Header.Get("Sec-CH-" + name)
+	if s == "" {
+		s = req.Header.Get(name)
+	}
+	if s == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func addVaryClientHint(req *http.Request, name string) {
+	AddVary(req, "Sec-CH-"+name)
+	AddVary(req, name)
+}
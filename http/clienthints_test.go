@@ -0,0 +1,186 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+)
+
+func TestParseClientHints(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		header         http.Header
+		params         imageserver.Params
+		maxWidth       int
+		disabled       bool
+		expectedParams imageserver.Params
+		expectedVary   []string
+	}{
+		{
+			name:           "Empty",
+			params:         imageserver.Params{},
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name: "NoResize",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"2"},
+				"Sec-Ch-Width": {"300"},
+			},
+			params:         imageserver.Params{},
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name: "DPRWidth",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"2"},
+				"Sec-Ch-Width": {"301"},
+			},
+			params: imageserver.Params{"mode": "fit"},
+			expectedParams: imageserver.Params{
+				"mode":  "fit",
+				"dpr":   2.0,
+				"width": 151,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width"},
+		},
+		{
+			name: "Legacy",
+			header: http.Header{
+				"Dpr":   {"1.5"},
+				"Width": {"300"},
+			},
+			params: imageserver.Params{"mode": "fit"},
+			expectedParams: imageserver.Params{
+				"mode":  "fit",
+				"dpr":   1.5,
+				"width": 200,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width"},
+		},
+		{
+			name: "ViewportWidth",
+			header: http.Header{
+				"Sec-Ch-Viewport-Width": {"800"},
+			},
+			params: imageserver.Params{"mode": "fit"},
+			expectedParams: imageserver.Params{
+				"mode":  "fit",
+				"width": 800,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width", "Sec-Ch-Viewport-Width", "Viewport-Width"},
+		},
+		{
+			name: "MaxWidth",
+			header: http.Header{
+				"Sec-Ch-Viewport-Width": {"2560"},
+			},
+			params:   imageserver.Params{"mode": "fit"},
+			maxWidth: 2048,
+			expectedParams: imageserver.Params{
+				"mode":  "fit",
+				"width": 2048,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width", "Sec-Ch-Viewport-Width", "Viewport-Width"},
+		},
+		{
+			name: "MaxWidthDPR",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"2"},
+				"Sec-Ch-Width": {"5000"},
+			},
+			params:   imageserver.Params{"mode": "fit"},
+			maxWidth: 2048,
+			expectedParams: imageserver.Params{
+				"mode":  "fit",
+				"dpr":   2.0,
+				"width": 2048,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width"},
+		},
+		{
+			name: "DPRClamped",
+			header: http.Header{
+				"Sec-Ch-Dpr": {"10"},
+			},
+			params: imageserver.Params{"height": 100},
+			expectedParams: imageserver.Params{
+				"height": 100,
+				"dpr":    4.0,
+			},
+			expectedVary: []string{"Sec-Ch-Dpr", "Dpr"},
+		},
+		{
+			name: "ParamsSet",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"2"},
+				"Sec-Ch-Width": {"300"},
+			},
+			params: imageserver.Params{
+				"dpr":   3.0,
+				"width": 100,
+			},
+			expectedParams: imageserver.Params{
+				"dpr":   3.0,
+				"width": 100,
+			},
+		},
+		{
+			name: "WidthParamDPR",
+			header: http.Header{
+				"Sec-Ch-Width": {"300"},
+			},
+			params: imageserver.Params{
+				"dpr": 3.0,
+			},
+			expectedParams: imageserver.Params{
+				"dpr":   3.0,
+				"width": 100,
+			},
+			expectedVary: []string{"Sec-Ch-Width", "Width"},
+		},
+		{
+			name: "Invalid",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"invalid"},
+				"Sec-Ch-Width": {"0"},
+			},
+			params:         imageserver.Params{"mode": "fit"},
+			expectedParams: imageserver.Params{"mode": "fit"},
+			expectedVary:   []string{"Sec-Ch-Dpr", "Dpr", "Sec-Ch-Width", "Width", "Sec-Ch-Viewport-Width", "Viewport-Width"},
+		},
+		{
+			name: "Disabled",
+			header: http.Header{
+				"Sec-Ch-Dpr":   {"2"},
+				"Sec-Ch-Width": {"300"},
+			},
+			params:         imageserver.Params{"mode": "fit"},
+			disabled:       true,
+			expectedParams: imageserver.Params{"mode": "fit"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = tc.header
+			if tc.disabled {
+				req = WithoutClientHints(req)
+			}
+			req, v := withVary(req)
+			ParseClientHints(req, tc.params, tc.maxWidth)
+			diff := compare.Compare(tc.params, tc.expectedParams)
+			if len(diff) != 0 {
+				t.Fatalf("unexpected params:\ngot: %s\nwant: %s\ndiff:\n%+v", tc.params, tc.expectedParams, diff)
+			}
+			if !slices.Equal(v.headers, tc.expectedVary) {
+				t.Fatalf("unexpected Vary: got %q, want %q", v.headers, tc.expectedVary)
+			}
+		})
+	}
+}
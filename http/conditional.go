@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// checkPreconditions evaluates the conditional request headers, as described in RFC 9110 section 13.2.2.
+//
+// It returns the status code that must be returned instead of the Image (StatusNotModified/304 or StatusPreconditionFailed/412),
+// or 0 if the Image must be returned.
+// The "Range" and "If-Range" headers are not evaluated here.
+func checkPreconditions(req *http.Request, etag string, lastModified time.Time) int {
+	if im := req.Header.Get("If-Match"); im != "" {
+		if !matchETags(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius, ok := parseHTTPDate(req.Header.Get("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if truncateTime(lastModified).After(ius) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if matchETags(inm, etag, true) {
+			if req.Method == "GET" || req.Method == "HEAD" {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims, ok := parseHTTPDate(req.Header.Get("If-Modified-Since")); ok && !lastModified.IsZero() && (req.Method == "GET" || req.Method == "HEAD") {
+		if !truncateTime(lastModified).After(ims) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// matchETags returns true if the header value (a list of entity tags, or "*") matches the ETag.
+//
+// It uses the weak comparison if weak is true, otherwise the strong comparison.
+// The ETag must be enclosed in quotes.
+func matchETags(header string, etag string, weak bool) bool {
+	header = textproto.TrimString(header)
+	if header == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+		tag, rest, ok := scanETag(header)
+		if !ok {
+			return false
+		}
+		header = rest
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(tag, "W/") && !strings.HasPrefix(etag, "W/") && tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// scanETag scans the first entity tag of s, and returns it with the remaining string.
+func scanETag(s string) (tag string, rest string, ok bool) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s)-start < 2 || s[start] != '"' {
+		return "", "", false
+	}
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	end += start + 2
+	return s[:end], s[end:], true
+}
+
+func parseHTTPDate(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// truncateTime truncates the time to the second, because the HTTP dates don't have sub-second precision.
+func truncateTime(t time.Time) time.Time {
+	return t.Truncate(time.Second)
+}
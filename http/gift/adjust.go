@@ -0,0 +1,59 @@
+package gift
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const (
+	adjustParam = "gift_adjust"
+)
+
+// AdjustParser is a imageserver/http.Parser implementation for imageserver/image/gift.AdjustProcessor.
+//
+// It takes the params from the HTTP URL query and stores them in a Params.
+// This Params is added to the given Params at the key "gift_adjust".
+//
+// See imageserver/image/gift.AdjustProcessor for params list.
+type AdjustParser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *AdjustParser) Parse(req *http.Request, params imageserver.Params) error {
+	p := imageserver.Params{}
+	err := prs.parse(req, p)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = adjustParam + "." + err.Param
+		}
+		return err
+	}
+	if !p.Empty() {
+		params.Set(adjustParam, p)
+	}
+	return nil
+}
+
+func (prs *AdjustParser) parse(req *http.Request, params imageserver.Params) error {
+	for _, name := range []string{"brightness", "contrast", "saturation", "hue", "sepia", "blur", "sharpen", "sharpen_amount", "sharpen_threshold"} {
+		if err := imageserver_http.ParseQueryFloat(name, req, params); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"grayscale", "invert"} {
+		if err := imageserver_http.ParseQueryBool(name, req, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *AdjustParser) Resolve(param string) string {
+	if !strings.HasPrefix(param, adjustParam+".") {
+		return ""
+	}
+	return strings.TrimPrefix(param, adjustParam+".")
+}
@@ -0,0 +1,107 @@
+package gift
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &AdjustParser{}
+
+func TestAdjustParserParse(t *testing.T) {
+	prs := &AdjustParser{}
+	for _, tc := range []struct {
+		name               string
+		query              url.Values
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name: "All",
+			query: url.Values{
+				"brightness":        {"10"},
+				"contrast":          {"-10"},
+				"saturation":        {"50"},
+				"hue":               {"90"},
+				"grayscale":         {"true"},
+				"sepia":             {"20"},
+				"invert":            {"1"},
+				"blur":              {"1.5"},
+				"sharpen":           {"1"},
+				"sharpen_amount":    {"0.5"},
+				"sharpen_threshold": {"0.05"},
+			},
+			expectedParams: imageserver.Params{adjustParam: imageserver.Params{
+				"brightness":        10.0,
+				"contrast":          -10.0,
+				"saturation":        50.0,
+				"hue":               90.0,
+				"grayscale":         true,
+				"sepia":             20.0,
+				"invert":            true,
+				"blur":              1.5,
+				"sharpen":           1.0,
+				"sharpen_amount":    0.5,
+				"sharpen_threshold": 0.05,
+			}},
+		},
+		{
+			name:               "BlurInvalid",
+			query:              url.Values{"blur": {"invalid"}},
+			expectedParamError: adjustParam + ".blur",
+		},
+		{
+			name:               "GrayscaleInvalid",
+			query:              url.Values{"grayscale": {"invalid"}},
+			expectedParamError: adjustParam + ".grayscale",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{
+				Scheme:   "http",
+				Host:     "localhost",
+				RawQuery: tc.query.Encode(),
+			}
+			req, err := http.NewRequest("GET", u.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = prs.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if params.String() != tc.expectedParams.String() {
+				t.Fatalf("unexpected params: got %s, want %s", params, tc.expectedParams)
+			}
+		})
+	}
+}
+
+func TestAdjustParserResolve(t *testing.T) {
+	prs := &AdjustParser{}
+	httpParam := prs.Resolve(adjustParam + ".blur")
+	if httpParam != "blur" {
+		t.Fatal("not equal")
+	}
+}
+
+func TestAdjustParserResolveNoMatch(t *testing.T) {
+	prs := &AdjustParser{}
+	httpParam := prs.Resolve("foo")
+	if httpParam != "" {
+		t.Fatal("not equal")
+	}
+}
@@ -0,0 +1,30 @@
+package gift
+
+import (
+	"net/http"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const (
+	autoOrientParam = "auto_orient"
+)
+
+// AutoOrientParser is a imageserver/http.Parser implementation for imageserver/image/gift.AutoOrientProcessor.
+//
+// It takes the boolean "auto_orient" param from the HTTP URL query.
+type AutoOrientParser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *AutoOrientParser) Parse(req *http.Request, params imageserver.Params) error {
+	return imageserver_http.ParseQueryBool(autoOrientParam, req, params)
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *AutoOrientParser) Resolve(param string) string {
+	if param == autoOrientParam {
+		return autoOrientParam
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package gift
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &AutoOrientParser{}
+
+func TestAutoOrientParserParse(t *testing.T) {
+	prs := &AutoOrientParser{}
+	req, err := http.NewRequest("GET", "http://localhost?auto_orient=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := imageserver.Params{}
+	err = prs.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := params.GetBool(autoOrientParam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res {
+		t.Fatalf("unexpected result: got %t, want %t", res, true)
+	}
+}
+
+func TestAutoOrientParserParseError(t *testing.T) {
+	prs := &AutoOrientParser{}
+	req, err := http.NewRequest("GET", "http://localhost?auto_orient=invalid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = prs.Parse(req, imageserver.Params{})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAutoOrientParserResolve(t *testing.T) {
+	prs := &AutoOrientParser{}
+	res := prs.Resolve(autoOrientParam)
+	if res != autoOrientParam {
+		t.Fatalf("unexpected result: got %s, want %s", res, autoOrientParam)
+	}
+	res = prs.Resolve("foobar")
+	if res != "" {
+		t.Fatalf("unexpected result: got %s, want %s", res, "")
+	}
+}
@@ -18,7 +18,14 @@ const (
 // This Params is added to the given Params at the key "gift_resize".
 //
 // See imageserver/image/gift.ResizeProcessor for params list.
-type ResizeParser struct{}
+type ResizeParser struct {
+	// ClientHints enables the Client Hints headers (see imageserver/http.ParseClientHints).
+	ClientHints bool
+
+	// MaxWidth limits the width taken from the Client Hints (0 = no limit).
+	// It should be the same as the max width of the Processor.
+	MaxWidth int
+}
 
 // Parse implements imageserver/http.Parser.
 func (prs *ResizeParser) Parse(req *http.Request, params imageserver.Params) error {
@@ -30,6 +37,9 @@ func (prs *ResizeParser) Parse(req *http.Request, params imageserver.Params) err
 		}
 		return err
 	}
+	if prs.ClientHints {
+		imageserver_http.ParseClientHints(req, p, prs.MaxWidth)
+	}
 	if !p.Empty() {
 		params.Set(resizeParam, p)
 	}
@@ -43,6 +53,15 @@ func (prs *ResizeParser) parse(req *http.Request, params imageserver.Params) err
 	if err := imageserver_http.ParseQueryInt("height", req, params); err != nil {
 		return err
 	}
+	if err := imageserver_http.ParseQueryFloat("focus_x", req, params); err != nil {
+		return err
+	}
+	if err := imageserver_http.ParseQueryFloat("focus_y", req, params); err != nil {
+		return err
+	}
+	if err := imageserver_http.ParseQueryFloat("dpr", req, params); err != nil {
+		return err
+	}
 	imageserver_http.ParseQueryString("resampling", req, params)
 	imageserver_http.ParseQueryString("mode", req, params)
 	return nil
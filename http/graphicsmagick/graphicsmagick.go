@@ -19,7 +19,14 @@ const (
 // This Params is added to the given Params at the key "graphicsmagick".
 //
 // See imageserver/graphicsmagick.Handler for params list.
-type Parser struct{}
+type Parser struct {
+	// ClientHints enables the Client Hints headers (see imageserver/http.ParseClientHints).
+	ClientHints bool
+
+	// MaxWidth limits the width taken from the Client Hints (0 = no limit).
+	// It should be the same as the max width of the Processor.
+	MaxWidth int
+}
 
 // Parse implements imageserver/http.Parser.
 func (parser *Parser) Parse(req *http.Request, params imageserver.Params) error {
@@ -31,6 +38,9 @@ func (parser *Parser) Parse(req *http.Request, params imageserver.Params) error
 		}
 		return err
 	}
+	if parser.ClientHints {
+		imageserver_http.ParseClientHints(req, p, parser.MaxWidth)
+	}
 	if !p.Empty() {
 		params.Set(globalParam, p)
 	}
@@ -44,6 +54,9 @@ func (parser *Parser) parse(req *http.Request, params imageserver.Params) error
 	if err := imageserver_http.ParseQueryInt("height", req, params); err != nil {
 		return err
 	}
+	if err := imageserver_http.ParseQueryFloat("dpr", req, params); err != nil {
+		return err
+	}
 	if err := imageserver_http.ParseQueryBool("fill", req, params); err != nil {
 		return err
 	}
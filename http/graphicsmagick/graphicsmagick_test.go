@@ -36,6 +36,18 @@ func TestParse(t *testing.T) {
 				"height": 100,
 			}},
 		},
+		{
+			name:  "DPR",
+			query: url.Values{"dpr": {"1.5"}},
+			expectedParams: imageserver.Params{globalParam: imageserver.Params{
+				"dpr": 1.5,
+			}},
+		},
+		{
+			name:               "DPRInvalid",
+			query:              url.Values{"dpr": {"invalid"}},
+			expectedParamError: globalParam + ".dpr",
+		},
 		{
 			name:  "Fill",
 			query: url.Values{"fill": {"true"}},
@@ -173,3 +185,24 @@ func TestResolveNoMatch(t *testing.T) {
 		t.Fatal("not equal")
 	}
 }
+
+func TestParseClientHints(t *testing.T) {
+	prs := &Parser{ClientHints: true}
+	req, err := http.NewRequest("GET", "http://localhost?height=100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Sec-CH-DPR", "2")
+	params := imageserver.Params{}
+	err = prs.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := imageserver.Params{globalParam: imageserver.Params{
+		"height": 100,
+		"dpr":    2.0,
+	}}
+	if params.String() != expected.String() {
+		t.Fatalf("unexpected params: got %s, want %s", params, expected)
+	}
+}
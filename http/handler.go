@@ -2,6 +2,7 @@
 package http
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
 )
@@ -18,14 +20,21 @@ import (
 // Supported methods are: GET and HEAD.
 // Other method will return a StatusMethodNotAllowed/405 response.
 //
-// It supports ETag/If-None-Match headers and returns a StatusNotModified/304 response accordingly.
-// But it doesn't check if the Image really exists (the Server is not called).
+// It supports the conditional requests and range requests (RFC 9110 sections 13 and 14):
+//   - If-Match and If-Unmodified-Since return a StatusPreconditionFailed/412 response if the condition is false.
+//   - If-None-Match and If-Modified-Since return a StatusNotModified/304 response if the condition is false.
+//   - Range returns a StatusPartialContent/206 response, or StatusRequestedRangeNotSatisfiable/416 if the range is invalid.
+//   - If-Range ignores the Range header if the validator doesn't match.
+//
+// The entity tags are compared with the weak comparison for If-None-Match, and with the strong comparison otherwise.
+// The preconditions are evaluated before calling the Server, so it doesn't check if the Image really exists.
+// Range requests are not supported for a streamed response body that is not seekable, and a StatusOK/200 response is returned.
 //
 // Steps:
 //   - Parse the HTTP request, and fill the Params.
-//   - If the given If-None-Match header matches the ETag, return a StatusNotModified/304 response.
-//   - Call the Server and get the Image.
-//   - Return a StatusOK/200 response containing the Image.
+//   - Evaluate the preconditions with the ETag and Last-Modified values, and return a StatusNotModified/304 or StatusPreconditionFailed/412 response if needed.
+//   - Call the Server with the request context and get the Image.
+//   - Return a StatusOK/200 or StatusPartialContent/206 response containing the Image.
 //
 // Errors (returned by Parser or Server):
 //   - *imageserver/http.Error will return a response with the given status code and message.
@@ -34,9 +43,12 @@ import (
 //   - Other error will return a StatusInternalServerError/500 response, and ErrorFunc will be called.
 //
 // Returned headers:
-//   - Content-Type is set for StatusOK/200 response, and contains "image/{Image.Format}".
+//   - Content-Type is set for StatusOK/200 response, and contains "image/{Image.Format}" (or "application/json" for the "json" format).
 //   - Content-Length is set for StatusOK/200 response, and contains the Image size.
+//   - Accept-Ranges is set to "bytes" if range requests are supported.
 //   - ETag is set for StatusOK/200 and StatusNotModified/304 response, and contains the ETag value.
+//   - Last-Modified is set for StatusOK/200 and StatusNotModified/304 response, and contains the Last-Modified value.
+//   - Vary is set if the Parser calls AddVary(), and contains the request headers used to fill the Params.
 type Handler struct {
 	// Parser parses the HTTP request and fills the Params.
 	Parser Parser
@@ -49,8 +61,17 @@ type Handler struct {
 	// The returned value must not be enclosed in quotes (they are added automatically).
 	ETagFunc func(params imageserver.Params) string
 
+	// LastModifiedFunc is an optional function that returns the Last-Modified value for the given Params.
+	// A zero time means that the value is unknown.
+	LastModifiedFunc func(params imageserver.Params) time.Time
+
 	// ErrorFunc is an optional function that is called if there is an internal error.
 	ErrorFunc func(err error, req *http.Request)
+
+	// Stream enables the streaming of the response body.
+	// The Image is requested with imageserver.GetStream(), and copied to the response without being loaded in memory if the Server supports it.
+	// Content-Length is only set if the size is known.
+	Stream bool
 }
 
 // ServeHTTP implements net/http.Handler.
@@ -66,19 +87,32 @@ func (handler *Handler) serveHTTP(rw http.ResponseWriter, req *http.Request) err
 		return NewErrorDefaultText(http.StatusMethodNotAllowed)
 	}
 	params := imageserver.Params{}
+	req, vary := withVary(req)
 	err := handler.Parser.Parse(req, params)
+	for _, h := range vary.headers {
+		rw.Header().Add("Vary", h)
+	}
 	if err != nil {
 		return err
 	}
 	etag := handler.getETag(params)
-	if handler.checkNotModified(rw, req, etag) {
+	lastModified := handler.getLastModified(params)
+	if handler.checkPreconditions(rw, req, etag, lastModified) {
+		return nil
+	}
+	if handler.Stream {
+		st, err := imageserver.GetStream(req.Context(), handler.Server, params)
+		if err != nil {
+			return err
+		}
+		handler.sendStream(rw, req, st, etag, lastModified)
 		return nil
 	}
-	image, err := handler.Server.Get(params)
+	image, err := imageserver.GetContext(req.Context(), handler.Server, params)
 	if err != nil {
 		return err
 	}
-	handler.sendImage(rw, req, image, etag)
+	handler.sendImage(rw, req, image, etag, lastModified)
 	return nil
 }
 
@@ -89,34 +123,81 @@ func (handler *Handler) getETag(params imageserver.Params) string {
 	return ""
 }
 
-func (handler *Handler) checkNotModified(rw http.ResponseWriter, req *http.Request, etag string) bool {
-	if etag == "" {
-		return false
+func (handler *Handler) getLastModified(params imageserver.Params) time.Time {
+	if handler.LastModifiedFunc != nil {
+		return handler.LastModifiedFunc(params)
 	}
-	inm := req.Header.Get("If-None-Match")
-	if inm != etag {
-		return false
+	return time.Time{}
+}
+
+func (handler *Handler) checkPreconditions(rw http.ResponseWriter, req *http.Request, etag string, lastModified time.Time) bool {
+	code := checkPreconditions(req, etag, lastModified)
+	switch code {
+	case http.StatusNotModified:
+		handler.setImageHeaderCommon(rw, etag, lastModified)
+		rw.WriteHeader(http.StatusNotModified)
+		return true
+	case http.StatusPreconditionFailed:
+		http.Error(rw, http.StatusText(code), code)
+		return true
 	}
-	handler.setImageHeaderCommon(rw, etag)
-	rw.WriteHeader(http.StatusNotModified)
-	return true
+	return false
 }
 
-func (handler *Handler) sendImage(rw http.ResponseWriter, req *http.Request, image *imageserver.Image, etag string) {
-	handler.setImageHeaderCommon(rw, etag)
-	if image.Format != "" {
-		rw.Header().Set("Content-Type", "image/"+image.Format)
+func (handler *Handler) sendImage(rw http.ResponseWriter, req *http.Request, image *imageserver.Image, etag string, lastModified time.Time) {
+	handler.serveContent(rw, req, image.Format, bytes.NewReader(image.Data), etag, lastModified)
+}
+
+func (handler *Handler) sendStream(rw http.ResponseWriter, req *http.Request, st *imageserver.Stream, etag string, lastModified time.Time) {
+	defer func() {
+		_ = st.Body.Close()
+	}()
+	if rs, ok := st.Body.(io.ReadSeeker); ok && st.Size >= 0 {
+		handler.serveContent(rw, req, st.Format, rs, etag, lastModified)
+		return
+	}
+	handler.setImageHeaderCommon(rw, etag, lastModified)
+	handler.setContentType(rw, st.Format)
+	if st.Size >= 0 {
+		rw.Header().Set("Content-Length", strconv.FormatInt(st.Size, 10))
 	}
-	rw.Header().Set("Content-Length", strconv.Itoa(len(image.Data)))
 	if req.Method == "GET" {
-		_, _ = rw.Write(image.Data)
+		_, _ = io.Copy(rw, st.Body)
 	}
 }
 
-func (handler *Handler) setImageHeaderCommon(rw http.ResponseWriter, etag string) {
+// serveContent uses net/http.ServeContent(), that supports the range requests.
+func (handler *Handler) serveContent(rw http.ResponseWriter, req *http.Request, format string, content io.ReadSeeker, etag string, lastModified time.Time) {
 	if etag != "" {
 		rw.Header().Set("ETag", etag)
 	}
+	handler.setContentType(rw, format)
+	http.ServeContent(rw, req, "", lastModified, content)
+}
+
+// formatContentTypes contains the Content-Type of the formats that are not images.
+var formatContentTypes = map[string]string{
+	"json": "application/json",
+}
+
+func (handler *Handler) setContentType(rw http.ResponseWriter, format string) {
+	if ct, ok := formatContentTypes[format]; ok {
+		rw.Header().Set("Content-Type", ct)
+	} else if format != "" {
+		rw.Header().Set("Content-Type", "image/"+format)
+	} else {
+		// Prevent content sniffing by net/http.ServeContent().
+		rw.Header()["Content-Type"] = nil
+	}
+}
+
+func (handler *Handler) setImageHeaderCommon(rw http.ResponseWriter, etag string, lastModified time.Time) {
+	if etag != "" {
+		rw.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		rw.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
 }
 
 func (handler *Handler) sendError(rw http.ResponseWriter, req *http.Request, err error) {
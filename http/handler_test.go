@@ -1,11 +1,15 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pierrre/imageserver"
 	imageserver_source "github.com/pierrre/imageserver/source"
@@ -14,11 +18,19 @@ import (
 
 var _ http.Handler = &Handler{}
 
+var (
+	testHandlerETag = fmt.Sprintf("\"%s\"", NewParamsHashETagFunc(sha256.New)(imageserver.Params{
+		imageserver_source.Param: testdata.MediumFileName,
+	}))
+	testHandlerLastModified = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
 // nolint: gocyclo
 func TestHandler(t *testing.T) {
 	for _, tc := range []struct {
 		name                  string
 		hasETagFunc           bool
+		hasLastModifiedFunc   bool
 		server                imageserver.Server
 		method                string
 		url                   string
@@ -85,6 +97,166 @@ func TestHandler(t *testing.T) {
 			},
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:        "IfNoneMatchWeak",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-None-Match": "W/" + testHandlerETag,
+			},
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:        "IfNoneMatchList",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-None-Match": "\"foo\", " + testHandlerETag,
+			},
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:        "IfNoneMatchAny",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-None-Match": "*",
+			},
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:        "IfMatch",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Match": testHandlerETag,
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:        "IfMatchPreconditionFailed",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Match": "\"foobar\"",
+			},
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:        "IfMatchWeakPreconditionFailed",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Match": "W/" + testHandlerETag,
+			},
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                "LastModified",
+			hasLastModifiedFunc: true,
+			url:                 "http://localhost?source=medium.jpg",
+			expectedStatusCode:  http.StatusOK,
+			expectedHeader: map[string]string{
+				"Last-Modified": testHandlerLastModified.Format(http.TimeFormat),
+			},
+		},
+		{
+			name:                "IfModifiedSinceNotModified",
+			hasLastModifiedFunc: true,
+			url:                 "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Modified-Since": testHandlerLastModified.Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusNotModified,
+			expectedHeader: map[string]string{
+				"Last-Modified": testHandlerLastModified.Format(http.TimeFormat),
+			},
+		},
+		{
+			name:                "IfModifiedSinceModified",
+			hasLastModifiedFunc: true,
+			url:                 "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Modified-Since": testHandlerLastModified.Add(-time.Hour).Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:                "IfModifiedSinceIgnoredWithIfNoneMatch",
+			hasETagFunc:         true,
+			hasLastModifiedFunc: true,
+			url:                 "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-None-Match":     "\"foobar\"",
+				"If-Modified-Since": testHandlerLastModified.Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:                "IfUnmodifiedSincePreconditionFailed",
+			hasLastModifiedFunc: true,
+			url:                 "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"If-Unmodified-Since": testHandlerLastModified.Add(-time.Hour).Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name: "Range",
+			url:  "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"Range": "bytes=0-9",
+			},
+			expectedStatusCode: http.StatusPartialContent,
+			expectedHeader: map[string]string{
+				"Content-Type":   fmt.Sprintf("image/%s", testdata.Medium.Format),
+				"Content-Length": "10",
+				"Content-Range":  fmt.Sprintf("bytes 0-9/%d", len(testdata.Medium.Data)),
+				"Accept-Ranges":  "bytes",
+			},
+		},
+		{
+			name: "RangeNotSatisfiable",
+			url:  "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"Range": fmt.Sprintf("bytes=%d-", len(testdata.Medium.Data)),
+			},
+			expectedStatusCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:        "IfRangeMatch",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"Range":    "bytes=0-9",
+				"If-Range": testHandlerETag,
+			},
+			expectedStatusCode: http.StatusPartialContent,
+		},
+		{
+			name:        "IfRangeDifferent",
+			hasETagFunc: true,
+			url:         "http://localhost?source=medium.jpg",
+			header: map[string]string{
+				"Range":    "bytes=0-9",
+				"If-Range": "\"foobar\"",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Content-Length": fmt.Sprint(len(testdata.Medium.Data)),
+			},
+		},
+		{
+			name: "ContentTypeJSON",
+			url:  "http://localhost",
+			server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+				return &imageserver.Image{Format: "json", Data: []byte("{}")}, nil
+			}),
+			expectedStatusCode: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Content-Type": "application/json",
+			},
+		},
 		{
 			name:               "MethodUnsupported",
 			method:             "POST",
@@ -157,6 +329,11 @@ func TestHandler(t *testing.T) {
 			if tc.hasETagFunc {
 				h.ETagFunc = NewParamsHashETagFunc(sha256.New)
 			}
+			if tc.hasLastModifiedFunc {
+				h.LastModifiedFunc = func(params imageserver.Params) time.Time {
+					return testHandlerLastModified
+				}
+			}
 			rw := httptest.NewRecorder()
 			met := tc.method
 			if met == "" {
@@ -191,8 +368,265 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+func TestHandlerContext(t *testing.T) {
+	type ctxKey struct{}
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("request context not forwarded")
+			}
+			return testdata.Medium, nil
+		}),
+	}
+	req, err := http.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "foo"))
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusOK)
+	}
+}
+
 func TestNewParamsHashETagFunc(t *testing.T) {
 	NewParamsHashETagFunc(sha256.New)(imageserver.Params{
 		"foo": "bar",
 	})
 }
+
+func TestHandlerVary(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		parser       Parser
+		expectedVary []string
+	}{
+		{
+			name:   "None",
+			parser: &SourceParser{},
+		},
+		{
+			name: "Headers",
+			parser: ListParser{
+				&SourceParser{},
+				&testVaryParser{header: "accept"},
+				&testVaryParser{header: "Accept"},
+				&testVaryParser{header: "Width"},
+			},
+			expectedVary: []string{"Accept", "Width"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{
+				Parser: tc.parser,
+				Server: testdata.Server,
+			}
+			req, err := http.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+			vary := rw.Header().Values("Vary")
+			if len(vary) != len(tc.expectedVary) {
+				t.Fatalf("unexpected Vary header: got %q, want %q", vary, tc.expectedVary)
+			}
+			for i := range vary {
+				if vary[i] != tc.expectedVary[i] {
+					t.Fatalf("unexpected Vary header: got %q, want %q", vary, tc.expectedVary)
+				}
+			}
+		})
+	}
+}
+
+type testVaryParser struct {
+	header string
+}
+
+func (parser *testVaryParser) Parse(req *http.Request, params imageserver.Params) error {
+	AddVary(req, parser.header)
+	return nil
+}
+
+func (parser *testVaryParser) Resolve(param string) string {
+	return ""
+}
+
+func TestAddVaryNoHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddVary(req, "Accept")
+}
+
+func TestHandlerStream(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		method                string
+		server                imageserver.Server
+		expectedContentLength string
+		expectedBody          bool
+	}{
+		{
+			name:                  "Image",
+			server:                testdata.Server,
+			expectedContentLength: fmt.Sprint(len(testdata.Medium.Data)),
+			expectedBody:          true,
+		},
+		{
+			name: "StreamUnknownSize",
+			server: &testStreamServer{
+				stream: func() *imageserver.Stream {
+					return &imageserver.Stream{
+						Format: testdata.Medium.Format,
+						Body:   io.NopCloser(bytes.NewReader(testdata.Medium.Data)),
+						Size:   -1,
+					}
+				},
+			},
+			expectedBody: true,
+		},
+		{
+			name:   "Head",
+			method: "HEAD",
+			server: &testStreamServer{
+				stream: func() *imageserver.Stream {
+					return imageserver.NewImageStream(testdata.Medium)
+				},
+			},
+			expectedContentLength: fmt.Sprint(len(testdata.Medium.Data)),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{
+				Parser: &SourceParser{},
+				Server: tc.server,
+				Stream: true,
+			}
+			met := tc.method
+			if met == "" {
+				met = "GET"
+			}
+			req, err := http.NewRequest(met, "http://localhost?source=medium.jpg", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+			if rw.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusOK)
+			}
+			if cl := rw.Header().Get("Content-Length"); cl != tc.expectedContentLength {
+				t.Fatalf("unexpected Content-Length: got %q, want %q", cl, tc.expectedContentLength)
+			}
+			if ct := rw.Header().Get("Content-Type"); ct != "image/"+testdata.Medium.Format {
+				t.Fatalf("unexpected Content-Type: %q", ct)
+			}
+			if tc.expectedBody && !bytes.Equal(rw.Body.Bytes(), testdata.Medium.Data) {
+				t.Fatal("body not equal")
+			}
+			if !tc.expectedBody && rw.Body.Len() != 0 {
+				t.Fatal("body not empty")
+			}
+		})
+	}
+}
+
+func TestHandlerStreamError(t *testing.T) {
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			return nil, &imageserver.ImageError{Message: "error"}
+		}),
+		Stream: true,
+	}
+	req, err := http.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusBadRequest)
+	}
+}
+
+type testStreamServer struct {
+	imageserver.Server
+	stream func() *imageserver.Stream
+}
+
+func (srv *testStreamServer) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	return srv.stream(), nil
+}
+
+func TestMatchETags(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		etag     string
+		weak     bool
+		expected bool
+	}{
+		{header: `"foo"`, etag: `"foo"`, expected: true},
+		{header: `"foo"`, etag: `"bar"`},
+		{header: `"bar", "foo"`, etag: `"foo"`, expected: true},
+		{header: `W/"foo"`, etag: `"foo"`},
+		{header: `W/"foo"`, etag: `"foo"`, weak: true, expected: true},
+		{header: `"foo"`, etag: `W/"foo"`, weak: true, expected: true},
+		{header: `*`, etag: `"foo"`, expected: true},
+		{header: `*`, etag: ``},
+		{header: `"foo"`, etag: ``},
+		{header: `foo`, etag: `"foo"`},
+		{header: `"foo`, etag: `"foo"`},
+	} {
+		t.Run(fmt.Sprintf("%s|%s|%t", tc.header, tc.etag, tc.weak), func(t *testing.T) {
+			res := matchETags(tc.header, tc.etag, tc.weak)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHandlerStreamRange(t *testing.T) {
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: &testStreamServer{
+			stream: func() *imageserver.Stream {
+				return &imageserver.Stream{
+					Format: testdata.Medium.Format,
+					Body: &testReadSeekCloser{
+						ReadSeeker: bytes.NewReader(testdata.Medium.Data),
+					},
+					Size: int64(len(testdata.Medium.Data)),
+				}
+			},
+		},
+		Stream: true,
+	}
+	req, err := http.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=10-19")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusPartialContent)
+	}
+	if !bytes.Equal(rw.Body.Bytes(), testdata.Medium.Data[10:20]) {
+		t.Fatal("body not equal")
+	}
+}
+
+type testReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (rsc *testReadSeekCloser) Close() error {
+	return nil
+}
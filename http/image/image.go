@@ -3,6 +3,8 @@ package image
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/pierrre/imageserver"
 	imageserver_http "github.com/pierrre/imageserver/http"
@@ -11,12 +13,26 @@ import (
 // FormatParser is a imageserver/http.Parser implementation for imageserver/image.
 //
 // It takes the string "format" param from the HTTP URL query.
-type FormatParser struct{}
+//
+// If the "format" param is not in the HTTP URL query and AcceptFormats is set,
+// the format is negotiated with the "Accept" header, and "Accept" is added to the "Vary" header.
+// The negotiated format is set to the "format" param.
+type FormatParser struct {
+	// AcceptFormats is an optional list of formats that can be negotiated, by order of preference (e.g. "avif", "webp").
+	// Only the media types explicitly listed in the "Accept" header (e.g. "image/webp") are matched, wildcards are ignored.
+	// If several formats have the same quality value, the first one is used.
+	AcceptFormats []string
+
+	// AcceptDefaultFormat is an optional format used if no format can be negotiated (e.g. "jpeg").
+	// If it is empty, the "format" param is not set.
+	AcceptDefaultFormat string
+}
 
 // Parse implements imageserver/http.Parser.
 func (parser *FormatParser) Parse(req *http.Request, params imageserver.Params) error {
 	imageserver_http.ParseQueryString("format", req, params)
 	if !params.Has("format") {
+		parser.negotiate(req, params)
 		return nil
 	}
 	format, err := params.GetString("format")
@@ -30,6 +46,62 @@ func (parser *FormatParser) Parse(req *http.Request, params imageserver.Params)
 	return nil
 }
 
+func (parser *FormatParser) negotiate(req *http.Request, params imageserver.Params) {
+	if len(parser.AcceptFormats) == 0 {
+		return
+	}
+	imageserver_http.AddVary(req, "Accept")
+	format := negotiateFormat(req.Header.Values("Accept"), parser.AcceptFormats)
+	if format == "" {
+		format = parser.AcceptDefaultFormat
+	}
+	if format != "" {
+		params.Set("format", format)
+	}
+}
+
+func negotiateFormat(accept []string, formats []string) string {
+	qualities := parseAccept(accept)
+	best := ""
+	bestQuality := 0.0
+	for _, format := range formats {
+		q := qualities["image/"+format]
+		if q > bestQuality {
+			best = format
+			bestQuality = q
+		}
+	}
+	return best
+}
+
+// parseAccept returns the quality value for each media type listed in the "Accept" header values.
+func parseAccept(accept []string) map[string]float64 {
+	qualities := make(map[string]float64)
+	for _, value := range accept {
+		for _, mediaRange := range strings.Split(value, ",") {
+			parts := strings.Split(mediaRange, ";")
+			mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+			if mediaType == "" {
+				continue
+			}
+			q := 1.0
+			for _, p := range parts[1:] {
+				name, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+				if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+					continue
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || f < 0 || f > 1 {
+					f = 0
+				}
+				q = f
+			}
+			qualities[mediaType] = q
+		}
+	}
+	return qualities
+}
+
 // Resolve implements imageserver/http.Parser.
 func (parser *FormatParser) Resolve(param string) string {
 	if param == "format" {
@@ -55,3 +127,60 @@ func (parser *QualityParser) Resolve(param string) string {
 	}
 	return ""
 }
+
+// LosslessParser is a imageserver/http.Parser implementation for imageserver/image.
+//
+// It takes the boolean "lossless" param from the HTTP URL query.
+// It is used by the WebP Encoder.
+type LosslessParser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (parser *LosslessParser) Parse(req *http.Request, params imageserver.Params) error {
+	return imageserver_http.ParseQueryBool("lossless", req, params)
+}
+
+// Resolve implements imageserver/http.Parser.
+func (parser *LosslessParser) Resolve(param string) string {
+	if param == "lossless" {
+		return "lossless"
+	}
+	return ""
+}
+
+// InfoParser is a imageserver/http.Parser implementation for imageserver/image.InfoHandler.
+//
+// It takes the boolean "info" param from the HTTP URL query.
+type InfoParser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (parser *InfoParser) Parse(req *http.Request, params imageserver.Params) error {
+	return imageserver_http.ParseQueryBool("info", req, params)
+}
+
+// Resolve implements imageserver/http.Parser.
+func (parser *InfoParser) Resolve(param string) string {
+	if param == "info" {
+		return "info"
+	}
+	return ""
+}
+
+// MetadataParser is a imageserver/http.Parser implementation for imageserver/image.Handler.
+//
+// It takes the string "strip" param and the boolean "keep_icc" param from the HTTP URL query.
+type MetadataParser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (parser *MetadataParser) Parse(req *http.Request, params imageserver.Params) error {
+	imageserver_http.ParseQueryString("strip", req, params)
+	return imageserver_http.ParseQueryBool("keep_icc", req, params)
+}
+
+// Resolve implements imageserver/http.Parser.
+func (parser *MetadataParser) Resolve(param string) string {
+	switch param {
+	case "strip", "keep_icc":
+		return param
+	}
+	return ""
+}
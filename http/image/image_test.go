@@ -2,6 +2,7 @@ package image
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/pierrre/imageserver"
@@ -59,6 +60,128 @@ func TestFormatParserParseError(t *testing.T) {
 	}
 }
 
+func TestFormatParserParseAccept(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		url            string
+		accept         []string
+		parser         *FormatParser
+		expectedFormat string
+	}{
+		{
+			name:   "Disabled",
+			accept: []string{"image/webp"},
+			parser: &FormatParser{},
+		},
+		{
+			name:           "Match",
+			accept:         []string{"image/avif,image/webp,image/apng,image/*,*/*;q=0.8"},
+			parser:         &FormatParser{AcceptFormats: []string{"webp"}},
+			expectedFormat: "webp",
+		},
+		{
+			name:           "Preference",
+			accept:         []string{"image/avif,image/webp,*/*"},
+			parser:         &FormatParser{AcceptFormats: []string{"avif", "webp"}},
+			expectedFormat: "avif",
+		},
+		{
+			name:           "Quality",
+			accept:         []string{"image/avif;q=0.5,image/webp;q=0.9"},
+			parser:         &FormatParser{AcceptFormats: []string{"avif", "webp"}},
+			expectedFormat: "webp",
+		},
+		{
+			name:           "MultipleHeaders",
+			accept:         []string{"image/png", "image/webp"},
+			parser:         &FormatParser{AcceptFormats: []string{"webp"}},
+			expectedFormat: "webp",
+		},
+		{
+			name:   "QualityZero",
+			accept: []string{"image/webp;q=0"},
+			parser: &FormatParser{AcceptFormats: []string{"webp"}},
+		},
+		{
+			name:   "Wildcard",
+			accept: []string{"image/*,*/*"},
+			parser: &FormatParser{AcceptFormats: []string{"webp"}},
+		},
+		{
+			name:           "Default",
+			accept:         []string{"image/png"},
+			parser:         &FormatParser{AcceptFormats: []string{"webp"}, AcceptDefaultFormat: "jpeg"},
+			expectedFormat: "jpeg",
+		},
+		{
+			name:           "NoHeader",
+			parser:         &FormatParser{AcceptFormats: []string{"webp"}, AcceptDefaultFormat: "jpeg"},
+			expectedFormat: "jpeg",
+		},
+		{
+			name:           "QueryPriority",
+			url:            "http://localhost?format=png",
+			accept:         []string{"image/webp"},
+			parser:         &FormatParser{AcceptFormats: []string{"webp"}},
+			expectedFormat: "png",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := tc.url
+			if u == "" {
+				u = "http://localhost"
+			}
+			req, err := http.NewRequest("GET", u, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, a := range tc.accept {
+				req.Header.Add("Accept", a)
+			}
+			params := imageserver.Params{}
+			err = tc.parser.Parse(req, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectedFormat == "" {
+				if params.Has("format") {
+					t.Fatal("should not be set")
+				}
+				return
+			}
+			format, err := params.GetString("format")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tc.expectedFormat {
+				t.Fatalf("unexpected format: got %s, want %s", format, tc.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestFormatParserAcceptVary(t *testing.T) {
+	h := &imageserver_http.Handler{
+		Parser: &FormatParser{AcceptFormats: []string{"webp"}},
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			return &imageserver.Image{Format: "webp"}, nil
+		}),
+	}
+	req, err := http.NewRequest("GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "image/webp")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rw.Code)
+	}
+	if v := rw.Header().Get("Vary"); v != "Accept" {
+		t.Fatalf("unexpected Vary header: %q", v)
+	}
+}
+
 func TestFormatParserResolve(t *testing.T) {
 	parser := &FormatParser{}
 
@@ -127,3 +250,147 @@ func TestQualityParserResolve(t *testing.T) {
 		t.Fatal("not equals")
 	}
 }
+
+var _ imageserver_http.Parser = &LosslessParser{}
+
+func TestLosslessParserParse(t *testing.T) {
+	parser := &LosslessParser{}
+	req, err := http.NewRequest("GET", "http://localhost?lossless=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := imageserver.Params{}
+	err = parser.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lossless, err := params.GetBool("lossless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lossless {
+		t.Fatal("not equals")
+	}
+}
+
+func TestLosslessParserParseError(t *testing.T) {
+	parser := &LosslessParser{}
+	req, err := http.NewRequest("GET", "http://localhost?lossless=foobar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := imageserver.Params{}
+	err = parser.Parse(req, params)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if err, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatal("wrong error type")
+	} else {
+		param := err.Param
+		if param != "lossless" {
+			t.Fatal("wrong param")
+		}
+	}
+}
+
+func TestLosslessParserResolve(t *testing.T) {
+	parser := &LosslessParser{}
+	httpParam := parser.Resolve("lossless")
+	if httpParam != "lossless" {
+		t.Fatal("not equals")
+	}
+	httpParam = parser.Resolve("foobar")
+	if httpParam != "" {
+		t.Fatal("not equals")
+	}
+}
+
+var _ imageserver_http.Parser = &InfoParser{}
+
+func TestInfoParserParse(t *testing.T) {
+	parser := &InfoParser{}
+	req, err := http.NewRequest("GET", "http://localhost?info=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := imageserver.Params{}
+	err = parser.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := params.GetBool("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info {
+		t.Fatal("not equals")
+	}
+}
+
+func TestInfoParserResolve(t *testing.T) {
+	parser := &InfoParser{}
+	httpParam := parser.Resolve("info")
+	if httpParam != "info" {
+		t.Fatal("not equals")
+	}
+	httpParam = parser.Resolve("foobar")
+	if httpParam != "" {
+		t.Fatal("not equals")
+	}
+}
+
+var _ imageserver_http.Parser = &MetadataParser{}
+
+func TestMetadataParserParse(t *testing.T) {
+	parser := &MetadataParser{}
+	req, err := http.NewRequest("GET", "http://localhost?strip=all&keep_icc=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := imageserver.Params{}
+	err = parser.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strip, err := params.GetString("strip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strip != "all" {
+		t.Fatal("not equals")
+	}
+	keepICC, err := params.GetBool("keep_icc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keepICC {
+		t.Fatal("not equals")
+	}
+}
+
+func TestMetadataParserParseError(t *testing.T) {
+	parser := &MetadataParser{}
+	req, err := http.NewRequest("GET", "http://localhost?keep_icc=foobar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(req, imageserver.Params{})
+	if err, ok := err.(*imageserver.ParamError); !ok || err.Param != "keep_icc" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMetadataParserResolve(t *testing.T) {
+	parser := &MetadataParser{}
+	for _, param := range []string{"strip", "keep_icc"} {
+		httpParam := parser.Resolve(param)
+		if httpParam != param {
+			t.Fatal("not equals")
+		}
+	}
+	httpParam := parser.Resolve("foobar")
+	if httpParam != "" {
+		t.Fatal("not equals")
+	}
+}
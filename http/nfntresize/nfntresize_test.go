@@ -36,6 +36,18 @@ func TestParse(t *testing.T) {
 				"height": 100,
 			}},
 		},
+		{
+			name:  "DPR",
+			query: url.Values{"dpr": {"1.5"}},
+			expectedParams: imageserver.Params{globalParam: imageserver.Params{
+				"dpr": 1.5,
+			}},
+		},
+		{
+			name:               "DPRInvalid",
+			query:              url.Values{"dpr": {"invalid"}},
+			expectedParamError: globalParam + ".dpr",
+		},
 		{
 			name:  "Interpolation",
 			query: url.Values{"interpolation": {"lanczos3"}},
@@ -50,6 +62,24 @@ func TestParse(t *testing.T) {
 				"mode": "resize",
 			}},
 		},
+		{
+			name:  "Focus",
+			query: url.Values{"focus_x": {"0.25"}, "focus_y": {"0.75"}},
+			expectedParams: imageserver.Params{globalParam: imageserver.Params{
+				"focus_x": 0.25,
+				"focus_y": 0.75,
+			}},
+		},
+		{
+			name:               "FocusXInvalid",
+			query:              url.Values{"focus_x": {"invalid"}},
+			expectedParamError: globalParam + ".focus_x",
+		},
+		{
+			name:               "FocusYInvalid",
+			query:              url.Values{"focus_y": {"invalid"}},
+			expectedParamError: globalParam + ".focus_y",
+		},
 		{
 			name:               "WidthInvalid",
 			query:              url.Values{"width": {"invalid"}},
@@ -101,3 +131,24 @@ func TestResolveNoMatch(t *testing.T) {
 		t.Fatal("not equal")
 	}
 }
+
+func TestParseClientHints(t *testing.T) {
+	prs := &Parser{ClientHints: true}
+	req, err := http.NewRequest("GET", "http://localhost?height=100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Sec-CH-DPR", "2")
+	params := imageserver.Params{}
+	err = prs.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := imageserver.Params{globalParam: imageserver.Params{
+		"height": 100,
+		"dpr":    2.0,
+	}}
+	if params.String() != expected.String() {
+		t.Fatalf("unexpected params: got %s, want %s", params, expected)
+	}
+}
@@ -0,0 +1,163 @@
+// Package ops provides a imageserver/http.Parser implementation for imageserver/image/ops.Processor.
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+)
+
+const param = "ops"
+
+// DefaultMaxSteps is the default value for Parser.MaxSteps.
+const DefaultMaxSteps = 10
+
+// OpParser parses the arguments of an operation.
+//
+// It returns the Params given to the imageserver/image.Processor of the operation.
+type OpParser func(args string) (imageserver.Params, error)
+
+// DefaultOps are the default operations of Parser:
+//   - crop: see ParseCrop
+//   - rotate: see ParseRotate
+//   - resize: see NewResizeOpParser, for imageserver/image/gift.ResizeProcessor
+var DefaultOps = map[string]OpParser{
+	"crop":   ParseCrop,
+	"rotate": ParseRotate,
+	"resize": NewResizeOpParser("gift_resize"),
+}
+
+// Parser is a imageserver/http.Parser implementation for imageserver/image/ops.Processor.
+//
+// It uses the "ops" param in the query string, with the following format: <op>:<args>|<op>:<args>|...
+// The operations are applied in the given order.
+//
+// Example: "ops=crop:0,0,100,100|rotate:90|resize:200x0"
+//
+// The operation names must match the names of imageserver/image/ops.Processor.Processors.
+type Parser struct {
+	// Ops are the available operations, by name (DefaultOps if nil).
+	Ops map[string]OpParser
+
+	// MaxSteps is the maximum number of operations (DefaultMaxSteps if 0).
+	MaxSteps int
+}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	s := req.URL.Query().Get(param)
+	if s == "" {
+		return nil
+	}
+	p, err := prs.parse(s)
+	if err != nil {
+		return &imageserver.ParamError{Param: param, Message: err.Error()}
+	}
+	params.Set(param, p)
+	return nil
+}
+
+func (prs *Parser) parse(s string) (imageserver.Params, error) {
+	maxSteps := prs.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	if n := strings.Count(s, "|") + 1; n > maxSteps {
+		return nil, fmt.Errorf("must contain at most %d steps, got %d", maxSteps, n)
+	}
+	ops := prs.Ops
+	if ops == nil {
+		ops = DefaultOps
+	}
+	p := imageserver.Params{}
+	for i, step := range strings.Split(s, "|") {
+		name, args, _ := strings.Cut(step, ":")
+		opPrs, ok := ops[name]
+		if !ok {
+			return nil, fmt.Errorf("step %d: unknown operation %q", i, name)
+		}
+		opParams, err := opPrs(args)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %s: %s", i, name, err)
+		}
+		p.Set(strconv.Itoa(i), imageserver.Params{
+			"op":     name,
+			"params": opParams,
+		})
+	}
+	return p, nil
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *Parser) Resolve(p string) string {
+	if p == param || strings.HasPrefix(p, param+".") {
+		return param
+	}
+	return ""
+}
+
+// ParseCrop is an OpParser for imageserver/image/crop.Processor.
+//
+// The format is: min_x,min_y,max_x,max_y
+func ParseCrop(args string) (imageserver.Params, error) {
+	const format = "expected format '<int>,<int>,<int>,<int>'"
+	fields := strings.Split(args, ",")
+	if len(fields) != 4 {
+		return nil, errors.New(format)
+	}
+	p := imageserver.Params{}
+	for i, name := range []string{"min_x", "min_y", "max_x", "max_y"} {
+		v, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", format, err)
+		}
+		p.Set(name, v)
+	}
+	return imageserver.Params{"crop": p}, nil
+}
+
+// ParseRotate is an OpParser for imageserver/image/gift.RotateProcessor.
+//
+// The format is: rotation
+func ParseRotate(args string) (imageserver.Params, error) {
+	rot, err := strconv.ParseFloat(args, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected format '<float>': %s", err)
+	}
+	return imageserver.Params{"gift_rotate": imageserver.Params{
+		"rotation": rot,
+	}}, nil
+}
+
+// NewResizeOpParser returns an OpParser for a resize processor, using the given node param (e.g. "gift_resize" or "nfntresize").
+//
+// The format is: <width>x<height>, 0 means that the dimension is not set.
+func NewResizeOpParser(nodeParam string) OpParser {
+	return func(args string) (imageserver.Params, error) {
+		w, h, ok := strings.Cut(args, "x")
+		if !ok {
+			return nil, errors.New("expected format '<int>x<int>'")
+		}
+		p := imageserver.Params{}
+		for _, d := range []struct {
+			name  string
+			value string
+		}{
+			{"width", w},
+			{"height", h},
+		} {
+			v, err := strconv.Atoi(d.value)
+			if err != nil {
+				return nil, fmt.Errorf("expected format '<int>x<int>': %s", err)
+			}
+			if v != 0 {
+				p.Set(d.name, v)
+			}
+		}
+		return imageserver.Params{nodeParam: p}, nil
+	}
+}
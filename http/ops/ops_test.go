@@ -0,0 +1,181 @@
+package ops
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		parser             *Parser
+		query              url.Values
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}{
+		{
+			name:           "Empty",
+			parser:         &Parser{},
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name:   "Default",
+			parser: &Parser{},
+			query:  url.Values{"ops": {"crop:0,0,100,100|rotate:90|resize:200x0"}},
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "crop", "params": imageserver.Params{"crop": imageserver.Params{
+					"min_x": 0,
+					"min_y": 0,
+					"max_x": 100,
+					"max_y": 100,
+				}}},
+				"1": imageserver.Params{"op": "rotate", "params": imageserver.Params{"gift_rotate": imageserver.Params{
+					"rotation": 90.0,
+				}}},
+				"2": imageserver.Params{"op": "resize", "params": imageserver.Params{"gift_resize": imageserver.Params{
+					"width": 200,
+				}}},
+			}},
+		},
+		{
+			name: "CustomOps",
+			parser: &Parser{
+				Ops: map[string]OpParser{
+					"nfnt": NewResizeOpParser("nfntresize"),
+				},
+			},
+			query: url.Values{"ops": {"nfnt:0x100"}},
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "nfnt", "params": imageserver.Params{"nfntresize": imageserver.Params{
+					"height": 100,
+				}}},
+			}},
+		},
+		{
+			name:               "ErrorMaxSteps",
+			parser:             &Parser{MaxSteps: 2},
+			query:              url.Values{"ops": {"rotate:90|rotate:90|rotate:90"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorMaxStepsDefault",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {strings.Repeat("rotate:90|", DefaultMaxSteps) + "rotate:90"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorUnknown",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"unknown:1"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorCrop",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"crop:invalid"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorCropTrailing",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"crop:0,0,100,100abc"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorCropFieldsLess",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"crop:0,0,100"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorCropFieldsMore",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"crop:0,0,100,100,5"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorCropSpace",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"crop:0, 0,100,100"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorRotate",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"rotate:invalid"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorResizeFormat",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"resize:100"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorResizeWidth",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"resize:ax100"}},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorResizeHeight",
+			parser:             &Parser{},
+			query:              url.Values{"ops": {"resize:100xa"}},
+			expectedParamError: param,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{
+				Scheme:   "http",
+				Host:     "localhost",
+				RawQuery: tc.query.Encode(),
+			}
+			req, err := http.NewRequest("GET", u.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = tc.parser.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatalf("no error, expected: %s", tc.expectedParamError)
+			}
+			diff := compare.Compare(params, tc.expectedParams)
+			if len(diff) != 0 {
+				t.Fatalf("diff:\n%+v", diff)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	prs := &Parser{}
+	for _, tc := range []struct {
+		param    string
+		expected string
+	}{
+		{param: param, expected: param},
+		{param: param + ".0.params.crop.min_x", expected: param},
+		{param: "foo", expected: ""},
+	} {
+		t.Run(tc.param, func(t *testing.T) {
+			res := prs.Resolve(tc.param)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %q, want %q", res, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package overlay provides a imageserver/http.Parser implementation for imageserver/image/overlay.Processor.
+package overlay
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const param = "overlay"
+
+// Parser is a imageserver/http.Parser implementation for imageserver/image/overlay.Processor.
+//
+// It uses the following params in the query string (see imageserver/image/overlay.Processor):
+//   - overlay: source
+//   - overlay_gravity: gravity
+//   - overlay_margin: margin
+//   - overlay_opacity: opacity
+//   - overlay_scale: scale
+//   - overlay_tile: tile
+//
+// The params are stored in a Params at the key "overlay".
+type Parser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	q := imageserver.Params{}
+	err := parse(req, q)
+	if err != nil {
+		return err
+	}
+	p := imageserver.Params{}
+	for k, v := range q {
+		p.Set(queryToParam(k), v)
+	}
+	if !p.Empty() {
+		params.Set(param, p)
+	}
+	return nil
+}
+
+func parse(req *http.Request, params imageserver.Params) error {
+	imageserver_http.ParseQueryString(param, req, params)
+	imageserver_http.ParseQueryString(param+"_gravity", req, params)
+	if err := imageserver_http.ParseQueryInt(param+"_margin", req, params); err != nil {
+		return err
+	}
+	if err := imageserver_http.ParseQueryFloat(param+"_opacity", req, params); err != nil {
+		return err
+	}
+	if err := imageserver_http.ParseQueryFloat(param+"_scale", req, params); err != nil {
+		return err
+	}
+	return imageserver_http.ParseQueryBool(param+"_tile", req, params)
+}
+
+func queryToParam(q string) string {
+	if q == param {
+		return "source"
+	}
+	return strings.TrimPrefix(q, param+"_")
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *Parser) Resolve(p string) string {
+	if p == param {
+		return param
+	}
+	if !strings.HasPrefix(p, param+".") {
+		return ""
+	}
+	p = strings.TrimPrefix(p, param+".")
+	if p == "source" {
+		return param
+	}
+	return param + "_" + p
+}
@@ -0,0 +1,117 @@
+package overlay
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParse(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		name               string
+		url                string
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}{
+		{
+			name:           "Empty",
+			url:            "http://localhost",
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name: "Source",
+			url:  "http://localhost?overlay=logo.png",
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"source": "logo.png",
+			}},
+		},
+		{
+			name: "All",
+			url:  "http://localhost?overlay=logo.png&overlay_gravity=north&overlay_margin=10&overlay_opacity=0.5&overlay_scale=0.25&overlay_tile=true",
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"source":  "logo.png",
+				"gravity": "north",
+				"margin":  10,
+				"opacity": 0.5,
+				"scale":   0.25,
+				"tile":    true,
+			}},
+		},
+		{
+			name: "OptionsOnly",
+			url:  "http://localhost?overlay_opacity=0.5",
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"opacity": 0.5,
+			}},
+		},
+		{
+			name:               "InvalidMargin",
+			url:                "http://localhost?overlay_margin=invalid",
+			expectedParamError: "overlay_margin",
+		},
+		{
+			name:               "InvalidOpacity",
+			url:                "http://localhost?overlay_opacity=invalid",
+			expectedParamError: "overlay_opacity",
+		},
+		{
+			name:               "InvalidScale",
+			url:                "http://localhost?overlay_scale=invalid",
+			expectedParamError: "overlay_scale",
+		},
+		{
+			name:               "InvalidTile",
+			url:                "http://localhost?overlay_tile=invalid",
+			expectedParamError: "overlay_tile",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = ps.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatalf("no error, expected: %s", tc.expectedParamError)
+			}
+			diff := compare.Compare(params, tc.expectedParams)
+			if len(diff) != 0 {
+				t.Fatalf("diff:\n%+v", diff)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		param    string
+		expected string
+	}{
+		{param: param, expected: param},
+		{param: param + ".source", expected: param},
+		{param: param + ".gravity", expected: "overlay_gravity"},
+		{param: param + ".tile", expected: "overlay_tile"},
+		{param: "foo", expected: ""},
+	} {
+		t.Run(tc.param, func(t *testing.T) {
+			res := ps.Resolve(tc.param)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %q, want %q", res, tc.expected)
+			}
+		})
+	}
+}
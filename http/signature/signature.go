@@ -0,0 +1,146 @@
+// Package signature provides a imageserver/http.Parser implementation that verifies signed URLs.
+//
+// The signature is a HMAC of the canonical URL: the path, followed by "?" and the query without the "signature" param, with the keys sorted.
+// It is encoded with unpadded URL-safe base64 and stored in the "signature" param of the query.
+// The optional "expires" param of the query contains a Unix timestamp, and is covered by the signature.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const (
+	// SignatureParam is the name of the query param containing the signature.
+	SignatureParam = "signature"
+	// ExpiresParam is the name of the query param containing the expiration Unix timestamp.
+	ExpiresParam = "expires"
+)
+
+// Parser is a imageserver/http.Parser implementation that verifies the signature of the URL, then calls the underlying Parser.
+//
+// The path is the one seen by the Parser, so it doesn't contain the prefix removed by net/http.StripPrefix().
+//
+// It returns a StatusForbidden/403 *imageserver/http.Error if the signature is missing, invalid or expired.
+// The Client Hints are disabled for the underlying Parser (see imageserver/http.WithoutClientHints), because they are not signed.
+type Parser struct {
+	imageserver_http.Parser
+
+	// Keys are the HMAC keys.
+	// A signature is valid if it matches any key, which allows key rotation.
+	Keys [][]byte
+
+	// NewHash is an optional hash function used by HMAC.
+	// By default, it uses crypto/sha256.New.
+	NewHash func() hash.Hash
+
+	// Now is an optional function that returns the current time.
+	// By default, it uses time.Now.
+	Now func() time.Time
+}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	err := prs.verify(req.URL)
+	if err != nil {
+		return err
+	}
+	return prs.Parser.Parse(imageserver_http.WithoutClientHints(req), params)
+}
+
+func (prs *Parser) verify(u *url.URL) error {
+	query := u.Query()
+	sig, err := base64.RawURLEncoding.DecodeString(query.Get(SignatureParam))
+	if err != nil || len(sig) == 0 {
+		return newForbiddenError("missing or malformed signature")
+	}
+	err = prs.verifyExpires(query)
+	if err != nil {
+		return err
+	}
+	data := canonical(u.Path, query)
+	for _, key := range prs.Keys {
+		if hmac.Equal(sig, compute(key, prs.NewHash, data)) {
+			return nil
+		}
+	}
+	return newForbiddenError("invalid signature")
+}
+
+func (prs *Parser) verifyExpires(query url.Values) error {
+	s := query.Get(ExpiresParam)
+	if s == "" {
+		return nil
+	}
+	expires, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return newForbiddenError("malformed expiration")
+	}
+	now := time.Now
+	if prs.Now != nil {
+		now = prs.Now
+	}
+	if now().Unix() > expires {
+		return newForbiddenError("expired signature")
+	}
+	return nil
+}
+
+func newForbiddenError(msg string) *imageserver_http.Error {
+	return &imageserver_http.Error{Code: http.StatusForbidden, Text: msg}
+}
+
+// Signer signs URLs that are verified by Parser.
+type Signer struct {
+	// Key is the HMAC key.
+	Key []byte
+
+	// NewHash is an optional hash function used by HMAC.
+	// By default, it uses crypto/sha256.New.
+	NewHash func() hash.Hash
+}
+
+// Sign returns a copy of the URL with the "signature" param, and the "expires" param if expires is not zero.
+//
+// The URL path must be the one seen by Parser.
+func (sgn *Signer) Sign(u *url.URL, expires time.Time) *url.URL {
+	query := u.Query()
+	query.Del(SignatureParam)
+	query.Del(ExpiresParam)
+	if !expires.IsZero() {
+		query.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	}
+	sig := compute(sgn.Key, sgn.NewHash, canonical(u.Path, query))
+	query.Set(SignatureParam, base64.RawURLEncoding.EncodeToString(sig))
+	signed := *u
+	signed.RawQuery = query.Encode()
+	return &signed
+}
+
+func canonical(pth string, query url.Values) []byte {
+	q := make(url.Values, len(query))
+	for k, v := range query {
+		if k != SignatureParam {
+			q[k] = v
+		}
+	}
+	return []byte(pth + "?" + q.Encode())
+}
+
+func compute(key []byte, newHash func() hash.Hash, data []byte) []byte {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	mac := hmac.New(newHash, key)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil)
+}
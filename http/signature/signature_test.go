@@ -0,0 +1,252 @@
+package signature
+
+import (
+	"crypto/sha1"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_source "github.com/pierrre/imageserver/source"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+var (
+	testKey      = []byte("key")
+	testOtherKey = []byte("other")
+	testNow      = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestParser(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		url          string
+		signer       *Signer
+		expires      time.Time
+		modify       func(u *url.URL)
+		parser       *Parser
+		expectedCode int
+	}{
+		{
+			name:   "Valid",
+			url:    "http://localhost/medium.jpg?width=100&height=200",
+			signer: &Signer{Key: testKey},
+		},
+		{
+			name:   "ValidNoQuery",
+			url:    "http://localhost/medium.jpg",
+			signer: &Signer{Key: testKey},
+		},
+		{
+			name:   "ValidQueryOrder",
+			url:    "http://localhost/medium.jpg?width=100&height=200",
+			signer: &Signer{Key: testKey},
+			modify: func(u *url.URL) {
+				u.RawQuery = u.Query().Encode()
+			},
+		},
+		{
+			name:   "ValidKeyRotation",
+			url:    "http://localhost/medium.jpg?width=100",
+			signer: &Signer{Key: testOtherKey},
+		},
+		{
+			name:   "ValidHash",
+			url:    "http://localhost/medium.jpg?width=100",
+			signer: &Signer{Key: testKey, NewHash: sha1.New},
+			parser: &Parser{Keys: [][]byte{testKey}, NewHash: sha1.New},
+		},
+		{
+			name:    "ValidExpires",
+			url:     "http://localhost/medium.jpg?width=100",
+			signer:  &Signer{Key: testKey},
+			expires: testNow.Add(1 * time.Hour),
+		},
+		{
+			name:         "Missing",
+			url:          "http://localhost/medium.jpg?width=100",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Malformed",
+			url:          "http://localhost/medium.jpg?width=100&signature=%25%25",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "InvalidKey",
+			url:          "http://localhost/medium.jpg?width=100",
+			signer:       &Signer{Key: []byte("invalid")},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "InvalidModifiedQuery",
+			url:    "http://localhost/medium.jpg?width=100",
+			signer: &Signer{Key: testKey},
+			modify: func(u *url.URL) {
+				q := u.Query()
+				q.Set("width", "2000")
+				u.RawQuery = q.Encode()
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "InvalidModifiedPath",
+			url:    "http://localhost/medium.jpg?width=100",
+			signer: &Signer{Key: testKey},
+			modify: func(u *url.URL) {
+				u.Path = "/large.jpg"
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:    "InvalidModifiedExpires",
+			url:     "http://localhost/medium.jpg?width=100",
+			signer:  &Signer{Key: testKey},
+			expires: testNow.Add(1 * time.Hour),
+			modify: func(u *url.URL) {
+				q := u.Query()
+				q.Set(ExpiresParam, "9999999999")
+				u.RawQuery = q.Encode()
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Expired",
+			url:          "http://localhost/medium.jpg?width=100",
+			signer:       &Signer{Key: testKey},
+			expires:      testNow.Add(-1 * time.Hour),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "MalformedExpires",
+			url:    "http://localhost/medium.jpg?width=100",
+			signer: &Signer{Key: testKey},
+			modify: func(u *url.URL) {
+				q := u.Query()
+				q.Set(ExpiresParam, "foo")
+				u.RawQuery = q.Encode()
+			},
+			expectedCode: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.signer != nil {
+				u = tc.signer.Sign(u, tc.expires)
+			}
+			if tc.modify != nil {
+				tc.modify(u)
+			}
+			req, err := http.NewRequest("GET", u.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prs := tc.parser
+			if prs == nil {
+				prs = &Parser{Keys: [][]byte{testKey, testOtherKey}}
+			}
+			prs.Parser = &imageserver_http.SourcePathParser{}
+			prs.Now = func() time.Time {
+				return testNow
+			}
+			params := imageserver.Params{}
+			err = prs.Parse(req, params)
+			if tc.expectedCode == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !params.Has(imageserver_source.Param) {
+					t.Fatal("underlying Parser not called")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("no error")
+			}
+			httpErr, ok := err.(*imageserver_http.Error)
+			if !ok {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+			if httpErr.Code != tc.expectedCode {
+				t.Fatalf("unexpected code: got %d, want %d", httpErr.Code, tc.expectedCode)
+			}
+			if params.Has(imageserver_source.Param) {
+				t.Fatal("underlying Parser called")
+			}
+		})
+	}
+}
+
+func TestParserClientHints(t *testing.T) {
+	u, err := url.Parse("http://localhost/medium.jpg?mode=fit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u = (&Signer{Key: testKey}).Sign(u, time.Time{})
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Sec-CH-DPR", "2")
+	req.Header.Set("Sec-CH-Width", "300")
+	prs := &Parser{
+		Parser: &testClientHintsParser{},
+		Keys:   [][]byte{testKey},
+	}
+	params := imageserver.Params{}
+	err = prs.Parse(req, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := imageserver.Params{"mode": "fit"}
+	if params.String() != expected.String() {
+		t.Fatalf("unexpected params: got %s, want %s", params, expected)
+	}
+}
+
+type testClientHintsParser struct{}
+
+func (prs *testClientHintsParser) Parse(req *http.Request, params imageserver.Params) error {
+	imageserver_http.ParseQueryString("mode", req, params)
+	imageserver_http.ParseClientHints(req, params, 0)
+	return nil
+}
+
+func (prs *testClientHintsParser) Resolve(param string) string {
+	return param
+}
+
+func TestParserResolve(t *testing.T) {
+	prs := &Parser{
+		Parser: &imageserver_http.SourcePathParser{},
+	}
+	httpParam := prs.Resolve(imageserver_source.Param)
+	if httpParam != "path" {
+		t.Fatal("not equals")
+	}
+}
+
+func TestSignerSignReplace(t *testing.T) {
+	u, err := url.Parse("http://localhost/medium.jpg?width=100&signature=foo&expires=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sgn := &Signer{Key: testKey}
+	signed := sgn.Sign(u, time.Time{})
+	q := signed.Query()
+	if q.Has(ExpiresParam) {
+		t.Fatal("expires not removed")
+	}
+	if q.Get(SignatureParam) == "foo" {
+		t.Fatal("signature not replaced")
+	}
+	if u.RawQuery != "width=100&signature=foo&expires=1" {
+		t.Fatal("original URL modified")
+	}
+}
@@ -0,0 +1,71 @@
+// Package smartcrop provides a imageserver/http.Parser implementation for imageserver/image/smartcrop.Processor.
+package smartcrop
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const param = "smart_crop"
+
+// Parser is a imageserver/http.Parser implementation for imageserver/image/smartcrop.Processor.
+//
+// It uses the following params in the query string:
+//   - smart_crop: aspect ratio, with the format "<width>:<height>" (e.g. "16:9") or "<float>" (e.g. "1.5")
+//   - gravity: see imageserver/image/smartcrop.Processor (optional)
+//
+// The "gravity" param is ignored if "smart_crop" is not set.
+type Parser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	s := req.URL.Query().Get(param)
+	if s == "" {
+		return nil
+	}
+	ratio, err := parseRatio(s)
+	if err != nil {
+		return &imageserver.ParamError{
+			Param:   param,
+			Message: "expected format '<int>:<int>' or '<float>': " + err.Error(),
+		}
+	}
+	p := imageserver.Params{"ratio": ratio}
+	imageserver_http.ParseQueryString("gravity", req, p)
+	params.Set(param, p)
+	return nil
+}
+
+func parseRatio(s string) (float64, error) {
+	w, h, ok := strings.Cut(s, ":")
+	if !ok {
+		return strconv.ParseFloat(s, 64)
+	}
+	wf, err := strconv.ParseFloat(w, 64)
+	if err != nil {
+		return 0, err
+	}
+	hf, err := strconv.ParseFloat(h, 64)
+	if err != nil {
+		return 0, err
+	}
+	if hf == 0 {
+		return 0, strconv.ErrRange
+	}
+	return wf / hf, nil
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *Parser) Resolve(p string) string {
+	switch p {
+	case param, param + ".ratio":
+		return param
+	case param + ".gravity":
+		return "gravity"
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package smartcrop
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParse(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		name               string
+		url                string
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}{
+		{
+			name:           "Empty",
+			url:            "http://localhost",
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name:           "GravityOnly",
+			url:            "http://localhost?gravity=entropy",
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name: "Float",
+			url:  "http://localhost?smart_crop=1.5",
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"ratio": 1.5,
+			}},
+		},
+		{
+			name: "WidthHeight",
+			url:  "http://localhost?smart_crop=16:8&gravity=attention",
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"ratio":   2.0,
+				"gravity": "attention",
+			}},
+		},
+		{
+			name:               "Invalid",
+			url:                "http://localhost?smart_crop=invalid",
+			expectedParamError: param,
+		},
+		{
+			name:               "InvalidWidth",
+			url:                "http://localhost?smart_crop=a:1",
+			expectedParamError: param,
+		},
+		{
+			name:               "InvalidHeight",
+			url:                "http://localhost?smart_crop=1:a",
+			expectedParamError: param,
+		},
+		{
+			name:               "InvalidHeightZero",
+			url:                "http://localhost?smart_crop=1:0",
+			expectedParamError: param,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = ps.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatalf("no error, expected: %s", tc.expectedParamError)
+			}
+			diff := compare.Compare(params, tc.expectedParams)
+			if len(diff) != 0 {
+				t.Fatalf("diff:\n%+v", diff)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		param    string
+		expected string
+	}{
+		{param: param, expected: param},
+		{param: param + ".ratio", expected: param},
+		{param: param + ".gravity", expected: "gravity"},
+		{param: "foo", expected: ""},
+	} {
+		t.Run(tc.param, func(t *testing.T) {
+			res := ps.Resolve(tc.param)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %q, want %q", res, tc.expected)
+			}
+		})
+	}
+}
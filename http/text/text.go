@@ -0,0 +1,92 @@
+// Package text provides a imageserver/http.Parser implementation for imageserver/image/text.Processor.
+package text
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const param = "text"
+
+// Parser is a imageserver/http.Parser implementation for imageserver/image/text.Processor.
+//
+// It uses the following params in the query string (see imageserver/image/text.Processor):
+//   - text: text
+//   - text_font: font
+//   - text_size: size
+//   - text_color: color
+//   - text_gravity: gravity
+//   - text_margin: margin
+//   - text_width: width
+//   - text_align: align
+//   - text_shadow: shadow
+//   - text_shadow_color: shadow_color
+//
+// The params are stored in a Params at the key "text".
+// The other params are ignored if "text" is not set.
+type Parser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	if req.URL.Query().Get(param) == "" {
+		return nil
+	}
+	q := imageserver.Params{}
+	err := parse(req, q)
+	if err != nil {
+		return err
+	}
+	p := imageserver.Params{}
+	for k, v := range q {
+		p.Set(queryToParam(k), v)
+	}
+	params.Set(param, p)
+	return nil
+}
+
+func parse(req *http.Request, params imageserver.Params) error {
+	imageserver_http.ParseQueryString(param, req, params)
+	imageserver_http.ParseQueryString(param+"_font", req, params)
+	if err := imageserver_http.ParseQueryFloat(param+"_size", req, params); err != nil {
+		return err
+	}
+	imageserver_http.ParseQueryString(param+"_color", req, params)
+	imageserver_http.ParseQueryString(param+"_gravity", req, params)
+	if err := imageserver_http.ParseQueryInt(param+"_margin", req, params); err != nil {
+		return err
+	}
+	if err := imageserver_http.ParseQueryInt(param+"_width", req, params); err != nil {
+		return err
+	}
+	imageserver_http.ParseQueryString(param+"_align", req, params)
+	if err := imageserver_http.ParseQueryInt(param+"_shadow", req, params); err != nil {
+		return err
+	}
+	imageserver_http.ParseQueryString(param+"_shadow_color", req, params)
+	return nil
+}
+
+func queryToParam(q string) string {
+	if q == param {
+		return param
+	}
+	return strings.TrimPrefix(q, param+"_")
+}
+
+// Resolve implements imageserver/http.Parser.
+func (prs *Parser) Resolve(p string) string {
+	if p == param {
+		return param
+	}
+	if !strings.HasPrefix(p, param+".") {
+		return ""
+	}
+	p = strings.TrimPrefix(p, param+".")
+	if p == param {
+		return param
+	}
+	return param + "_" + p
+}
@@ -0,0 +1,135 @@
+package text
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pierrre/compare"
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParse(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		name               string
+		query              url.Values
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}{
+		{
+			name:           "Empty",
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name:           "OptionsOnly",
+			query:          url.Values{"text_size": {"12"}},
+			expectedParams: imageserver.Params{},
+		},
+		{
+			name:  "Text",
+			query: url.Values{"text": {"Hello world"}},
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"text": "Hello world",
+			}},
+		},
+		{
+			name: "All",
+			query: url.Values{
+				"text":              {"Hello world"},
+				"text_font":         {"bold"},
+				"text_size":         {"12.5"},
+				"text_color":        {"ff0000"},
+				"text_gravity":      {"south"},
+				"text_margin":       {"10"},
+				"text_width":        {"300"},
+				"text_align":        {"center"},
+				"text_shadow":       {"2"},
+				"text_shadow_color": {"0008"},
+			},
+			expectedParams: imageserver.Params{param: imageserver.Params{
+				"text":         "Hello world",
+				"font":         "bold",
+				"size":         12.5,
+				"color":        "ff0000",
+				"gravity":      "south",
+				"margin":       10,
+				"width":        300,
+				"align":        "center",
+				"shadow":       2,
+				"shadow_color": "0008",
+			}},
+		},
+		{
+			name:               "InvalidSize",
+			query:              url.Values{"text": {"a"}, "text_size": {"invalid"}},
+			expectedParamError: "text_size",
+		},
+		{
+			name:               "InvalidMargin",
+			query:              url.Values{"text": {"a"}, "text_margin": {"invalid"}},
+			expectedParamError: "text_margin",
+		},
+		{
+			name:               "InvalidWidth",
+			query:              url.Values{"text": {"a"}, "text_width": {"invalid"}},
+			expectedParamError: "text_width",
+		},
+		{
+			name:               "InvalidShadow",
+			query:              url.Values{"text": {"a"}, "text_shadow": {"invalid"}},
+			expectedParamError: "text_shadow",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{
+				Scheme:   "http",
+				Host:     "localhost",
+				RawQuery: tc.query.Encode(),
+			}
+			req, err := http.NewRequest("GET", u.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = ps.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatalf("no error, expected: %s", tc.expectedParamError)
+			}
+			diff := compare.Compare(params, tc.expectedParams)
+			if len(diff) != 0 {
+				t.Fatalf("diff:\n%+v", diff)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ps := &Parser{}
+	for _, tc := range []struct {
+		param    string
+		expected string
+	}{
+		{param: param, expected: param},
+		{param: param + ".text", expected: param},
+		{param: param + ".size", expected: "text_size"},
+		{param: param + ".shadow_color", expected: "text_shadow_color"},
+		{param: "foo", expected: ""},
+	} {
+		t.Run(tc.param, func(t *testing.T) {
+			res := ps.Resolve(tc.param)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %q, want %q", res, tc.expected)
+			}
+		})
+	}
+}
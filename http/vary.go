@@ -0,0 +1,40 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+type varyContextKey struct{}
+
+type vary struct {
+	headers []string
+}
+
+func (v *vary) add(header string) {
+	header = http.CanonicalHeaderKey(header)
+	for _, h := range v.headers {
+		if h == header {
+			return
+		}
+	}
+	v.headers = append(v.headers, header)
+}
+
+func withVary(req *http.Request) (*http.Request, *vary) {
+	v := new(vary)
+	ctx := context.WithValue(req.Context(), varyContextKey{}, v)
+	return req.WithContext(ctx), v
+}
+
+// AddVary adds a header name to the "Vary" header of the response returned by Handler.
+//
+// It should be called by a Parser if the Params depend on a request header (e.g. "Accept").
+// It does nothing if the request is not served by Handler.
+func AddVary(req *http.Request, header string) {
+	v, ok := req.Context().Value(varyContextKey{}).(*vary)
+	if !ok {
+		return
+	}
+	v.add(header)
+}
@@ -1,8 +1,11 @@
 package imageserver
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"time"
 )
 
 const (
@@ -14,16 +17,33 @@ const (
 
 var (
 	imageByteOrder = binary.LittleEndian
+	imageMagic     = []byte("ISIM")
+	imageCRCTable  = crc32.MakeTable(crc32.Castagnoli)
 )
 
+const imageVersion = 2
+
 // Image is a raw image.
 //
-// Binary encoding:
-//  - Format length (uint32)
-//  - Format (string)
-//  - Data length (uint32)
-//  - Data([]byte)
+// Binary encoding (version 2):
+//   - Magic ("ISIM")
+//   - Version (uint8)
+//   - Format length (uint32)
+//   - Format (string)
+//   - Data length (uint32)
+//   - Data([]byte)
+//   - Metadata fields count (uint16)
+//   - Metadata fields: tag (uint16), value length (uint32), value ([]byte)
+//   - Checksum (uint32, CRC-32 Castagnoli of all previous bytes)
+//
 // Numbers are encoded using little-endian order.
+// Unknown metadata fields are ignored, so new fields can be added without a new version.
+//
+// The legacy encoding (version 1, without magic) is still decoded:
+//   - Format length (uint32)
+//   - Format (string)
+//   - Data length (uint32)
+//   - Data([]byte)
 type Image struct {
 	// Format is the format used to encode the image.
 	//
@@ -32,8 +52,45 @@ type Image struct {
 
 	// Data contains the raw data of the encoded image.
 	Data []byte
+
+	// Metadata contains optional metadata.
+	Metadata ImageMetadata
 }
 
+// ImageMetadata contains optional Image metadata.
+//
+// Zero values are not encoded.
+type ImageMetadata struct {
+	// Width is the width of the image, in pixels.
+	// It is set when the Image is encoded by the imageserver/image Handlers.
+	Width int
+
+	// Height is the height of the image, in pixels.
+	// It is set when the Image is encoded by the imageserver/image Handlers.
+	Height int
+
+	// SourceETag is the ETag of the source.
+	// It is set by imageserver/source/http, and kept by the imageserver/image Handlers.
+	SourceETag string
+
+	// Created is the time when the Image was stored in a cache.
+	// It is set by imageserver/cache.Entry.
+	Created time.Time
+
+	// Expires is the time when the Image stored in a cache expires.
+	// It is set by imageserver/cache.Entry.
+	Expires time.Time
+}
+
+// Metadata field tags.
+const (
+	imageMetadataTagWidth uint16 = iota + 1
+	imageMetadataTagHeight
+	imageMetadataTagCreated
+	imageMetadataTagSourceETag
+	imageMetadataTagExpires
+)
+
 // MarshalBinary implements encoding.BinaryMarshaler.
 func (im *Image) MarshalBinary() ([]byte, error) {
 	if len(im.Format) > ImageFormatMaxLen {
@@ -42,21 +99,52 @@ func (im *Image) MarshalBinary() ([]byte, error) {
 	if len(im.Data) > ImageDataMaxLen {
 		return nil, &ImageError{Message: fmt.Sprintf("marshal: data length %d is greater than the maximum value %d", len(im.Data), ImageDataMaxLen)}
 	}
+	meta := im.Metadata.marshal()
 
-	data := make([]byte, 0, 4+len(im.Format)+4+len(im.Data))
-	buf := make([]byte, 4)
+	data := make([]byte, 0, len(imageMagic)+1+4+len(im.Format)+4+len(im.Data)+len(meta)+4)
+	data = append(data, imageMagic...)
+	data = append(data, imageVersion)
 
-	imageByteOrder.PutUint32(buf, uint32(len(im.Format)))
-	data = append(data, buf...)
+	data = imageByteOrder.AppendUint32(data, uint32(len(im.Format)))
 	data = append(data, im.Format...)
 
-	imageByteOrder.PutUint32(buf, uint32(len(im.Data)))
-	data = append(data, buf...)
+	data = imageByteOrder.AppendUint32(data, uint32(len(im.Data)))
 	data = append(data, im.Data...)
 
+	data = append(data, meta...)
+
+	data = imageByteOrder.AppendUint32(data, crc32.Checksum(data, imageCRCTable))
+
 	return data, nil
 }
 
+func (meta *ImageMetadata) marshal() []byte {
+	var fields []byte
+	count := uint16(0)
+	addField := func(tag uint16, value []byte) {
+		fields = imageByteOrder.AppendUint16(fields, tag)
+		fields = imageByteOrder.AppendUint32(fields, uint32(len(value)))
+		fields = append(fields, value...)
+		count++
+	}
+	if meta.Width != 0 {
+		addField(imageMetadataTagWidth, imageByteOrder.AppendUint32(nil, uint32(meta.Width)))
+	}
+	if meta.Height != 0 {
+		addField(imageMetadataTagHeight, imageByteOrder.AppendUint32(nil, uint32(meta.Height)))
+	}
+	if !meta.Created.IsZero() {
+		addField(imageMetadataTagCreated, imageByteOrder.AppendUint64(nil, uint64(meta.Created.UnixNano())))
+	}
+	if meta.SourceETag != "" {
+		addField(imageMetadataTagSourceETag, []byte(meta.SourceETag))
+	}
+	if !meta.Expires.IsZero() {
+		addField(imageMetadataTagExpires, imageByteOrder.AppendUint64(nil, uint64(meta.Expires.UnixNano())))
+	}
+	return append(imageByteOrder.AppendUint16(nil, count), fields...)
+}
+
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
 //
 // It copies data then call UnmarshalBinaryNoCopy().
@@ -70,43 +158,56 @@ func (im *Image) UnmarshalBinary(data []byte) error {
 //
 // The caller must not reuse data after that.
 func (im *Image) UnmarshalBinaryNoCopy(data []byte) error {
-	readData := func(length int) ([]byte, error) {
-		if length > len(data) {
-			return nil, &ImageError{Message: "unmarshal: unexpected end of data"}
-		}
-		res := data[:length]
-		data = data[length:]
-		return res, nil
+	if !bytes.HasPrefix(data, imageMagic) {
+		return im.unmarshalV1(data)
 	}
+	if len(data) < len(imageMagic)+1+4 {
+		return &ImageError{Message: "unmarshal: unexpected end of data"}
+	}
+	version := data[len(imageMagic)]
+	if version != imageVersion {
+		return &ImageError{Message: fmt.Sprintf("unmarshal: unsupported version %d", version)}
+	}
+	checksum := imageByteOrder.Uint32(data[len(data)-4:])
+	data = data[:len(data)-4]
+	if crc32.Checksum(data, imageCRCTable) != checksum {
+		return &ImageError{Message: "unmarshal: invalid checksum"}
+	}
+	r := &imageReader{data: data[len(imageMagic)+1:]}
+	err := im.unmarshalFormatData(r)
+	if err != nil {
+		return err
+	}
+	return im.Metadata.unmarshal(r)
+}
 
-	var buf []byte
-	var err error
+func (im *Image) unmarshalV1(data []byte) error {
+	im.Metadata = ImageMetadata{}
+	return im.unmarshalFormatData(&imageReader{data: data})
+}
 
-	buf, err = readData(4)
+func (im *Image) unmarshalFormatData(r *imageReader) error {
+	formatLen, err := r.readUint32()
 	if err != nil {
 		return err
 	}
-	formatLen := imageByteOrder.Uint32(buf)
 	if formatLen > ImageFormatMaxLen {
 		return &ImageError{Message: fmt.Sprintf("unmarshal: format length %d is greater than the maximum value %d", formatLen, ImageFormatMaxLen)}
 	}
-
-	buf, err = readData(int(formatLen))
+	buf, err := r.read(int(formatLen))
 	if err != nil {
 		return err
 	}
 	im.Format = string(buf)
 
-	buf, err = readData(4)
+	dataLen, err := r.readUint32()
 	if err != nil {
 		return err
 	}
-	dataLen := imageByteOrder.Uint32(buf)
 	if dataLen > ImageDataMaxLen {
 		return &ImageError{Message: fmt.Sprintf("unmarshal: data length %d is greater than the maximum value %d", dataLen, ImageDataMaxLen)}
 	}
-
-	buf, err = readData(int(dataLen))
+	buf, err = r.read(int(dataLen))
 	if err != nil {
 		return err
 	}
@@ -115,6 +216,93 @@ func (im *Image) UnmarshalBinaryNoCopy(data []byte) error {
 	return nil
 }
 
+func (meta *ImageMetadata) unmarshal(r *imageReader) error {
+	*meta = ImageMetadata{}
+	buf, err := r.read(2)
+	if err != nil {
+		return err
+	}
+	count := imageByteOrder.Uint16(buf)
+	for range count {
+		buf, err = r.read(2)
+		if err != nil {
+			return err
+		}
+		tag := imageByteOrder.Uint16(buf)
+		length, err := r.readUint32()
+		if err != nil {
+			return err
+		}
+		value, err := r.read(int(length))
+		if err != nil {
+			return err
+		}
+		err = meta.unmarshalField(tag, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (meta *ImageMetadata) unmarshalField(tag uint16, value []byte) error {
+	checkLen := func(n int) error {
+		if len(value) != n {
+			return &ImageError{Message: fmt.Sprintf("unmarshal: invalid length %d for metadata field %d", len(value), tag)}
+		}
+		return nil
+	}
+	switch tag {
+	case imageMetadataTagWidth, imageMetadataTagHeight:
+		err := checkLen(4)
+		if err != nil {
+			return err
+		}
+		v := int(imageByteOrder.Uint32(value))
+		if tag == imageMetadataTagWidth {
+			meta.Width = v
+		} else {
+			meta.Height = v
+		}
+	case imageMetadataTagCreated, imageMetadataTagExpires:
+		err := checkLen(8)
+		if err != nil {
+			return err
+		}
+		v := time.Unix(0, int64(imageByteOrder.Uint64(value)))
+		if tag == imageMetadataTagCreated {
+			meta.Created = v
+		} else {
+			meta.Expires = v
+		}
+	case imageMetadataTagSourceETag:
+		meta.SourceETag = string(value)
+	}
+	// Unknown fields are ignored.
+	return nil
+}
+
+type imageReader struct {
+	data []byte
+}
+
+func (r *imageReader) read(length int) ([]byte, error) {
+	if length > len(r.data) {
+		return nil, &ImageError{Message: "unmarshal: unexpected end of data"}
+	}
+	res := r.data[:length]
+	r.data = r.data[length:]
+	return res, nil
+}
+
+func (r *imageReader) readUint32() (uint32, error) {
+	buf, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return imageByteOrder.Uint32(buf), nil
+}
+
 // ImageError is an Image error.
 type ImageError struct {
 	Message string
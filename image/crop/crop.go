@@ -82,6 +82,26 @@ func (prc *Processor) crop(im image.Image, bds image.Rectangle) (image.Image, er
 	return im2.SubImage(bds), nil
 }
 
+// Bounds implements imageserver/image.BoundsProcessor.
+func (prc *Processor) Bounds(bds image.Rectangle, params imageserver.Params) (image.Rectangle, error) {
+	if !params.Has(param) {
+		return bds, nil
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return image.ZR, err
+	}
+	cropBds, err := prc.getBounds(params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = param + "." + err.Param
+		}
+		return image.ZR, err
+	}
+	// Same as SubImage().
+	return cropBds.Intersect(bds), nil
+}
+
 // Change implements imageserver/image.Processor.
 func (prc *Processor) Change(params imageserver.Params) bool {
 	return params.Has(param)
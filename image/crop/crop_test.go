@@ -11,6 +11,8 @@ import (
 
 var _ imageserver_image.Processor = &Processor{}
 
+var _ imageserver_image.BoundsProcessor = &Processor{}
+
 func TestProcess(t *testing.T) {
 	prc := &Processor{}
 	for _, tc := range []struct {
@@ -117,6 +119,7 @@ func TestProcess(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
+			srcBds := tc.newImage().Bounds()
 			im, err := prc.Process(tc.newImage(), tc.params)
 			if err != nil {
 				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
@@ -136,6 +139,13 @@ func TestProcess(t *testing.T) {
 			if im.Bounds() != tc.expectedBounds {
 				t.Fatalf("unexpected bounds: got %#v, want %#v", im.Bounds(), tc.expectedBounds)
 			}
+			bds, err := prc.Bounds(srcBds, tc.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bds != tc.expectedBounds {
+				t.Fatalf("unexpected planned bounds: got %#v, want %#v", bds, tc.expectedBounds)
+			}
 		})
 	}
 }
@@ -75,14 +75,30 @@ func encode(nim image.Image, format string, enc Encoder, params imageserver.Para
 	im := &imageserver.Image{
 		Format: format,
 		Data:   buf.Bytes(),
+		Metadata: imageserver.ImageMetadata{
+			Width:  nim.Bounds().Dx(),
+			Height: nim.Bounds().Dy(),
+		},
 	}
 	return im, nil
 }
 
 // Decode decodes a raw Image to a Go Image.
 //
-// It returns an error if the decoded Image format does not match the raw Image format.
+// It doesn't check any Limits, DecodeLimits must be used for untrusted Images.
 func Decode(im *imageserver.Image) (image.Image, error) {
+	return DecodeLimits(im, Limits{})
+}
+
+// DecodeLimits decodes a raw Image to a Go Image.
+//
+// It checks the Limits before decoding (see Limits.Check).
+// It returns an error if the decoded Image format does not match the raw Image format.
+func DecodeLimits(im *imageserver.Image, limits Limits) (image.Image, error) {
+	err := limits.Check(im)
+	if err != nil {
+		return nil, err
+	}
 	nim, format, err := image.Decode(bytes.NewReader(im.Data))
 	if err != nil {
 		return nil, &imageserver.ImageError{Message: err.Error()}
@@ -0,0 +1,377 @@
+// Package exif provides a minimal EXIF parser.
+//
+// It supports the EXIF data embedded in JPEG (APP1 segment), PNG (eXIf chunk) and WebP (EXIF chunk) images.
+// Only the common tags of IFD0, Exif IFD and GPS IFD are returned.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Tags are the EXIF tags, indexed by name.
+//
+// The values are:
+//   - string for ASCII
+//   - int or []int for BYTE, SHORT, LONG and SLONG
+//   - float64 or []float64 for RATIONAL and SRATIONAL
+type Tags map[string]any
+
+// Orientation returns the "Orientation" tag (1 to 8).
+//
+// It returns 1 (normal) if the tag is missing or invalid.
+func (tags Tags) Orientation() int {
+	o, ok := tags["Orientation"].(int)
+	if !ok || o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// RemoveGPS removes the GPS tags (location of the image).
+func (tags Tags) RemoveGPS() {
+	for _, name := range gpsTags {
+		delete(tags, name)
+	}
+}
+
+// Parse parses the EXIF data of an encoded image.
+//
+// It returns nil if there is no EXIF data.
+func Parse(data []byte) (Tags, error) {
+	tiff := Find(data)
+	if tiff == nil {
+		return nil, nil
+	}
+	return ParseTIFF(tiff)
+}
+
+var (
+	jpegExifHeader = []byte("Exif\x00\x00")
+	pngSignature   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// Find returns the EXIF data (TIFF structure) of an encoded image, or nil if there is none.
+func Find(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return findJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return findPNG(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return findWebP(data)
+	}
+	return nil
+}
+
+func findJPEG(data []byte) []byte {
+	data = data[2:]
+	for len(data) >= 4 {
+		if data[0] != 0xff {
+			return nil
+		}
+		marker := data[1]
+		if marker == 0xd8 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 || marker == 0xff {
+			data = data[1:]
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// Start of scan, or end of image: no more metadata.
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < 2 || 2+length > len(data) {
+			return nil
+		}
+		segment := data[4 : 2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, jpegExifHeader) {
+			return segment[len(jpegExifHeader):]
+		}
+		data = data[2+length:]
+	}
+	return nil
+}
+
+func findPNG(data []byte) []byte {
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := int(binary.BigEndian.Uint32(data[0:4]))
+		if length < 0 || 12+length > len(data) {
+			return nil
+		}
+		typ := string(data[4:8])
+		if typ == "eXIf" {
+			return data[8 : 8+length]
+		}
+		if typ == "IDAT" || typ == "IEND" {
+			return nil
+		}
+		data = data[12+length:]
+	}
+	return nil
+}
+
+func findWebP(data []byte) []byte {
+	data = data[12:]
+	for len(data) >= 8 {
+		length := int(binary.LittleEndian.Uint32(data[4:8]))
+		if length < 0 || 8+length > len(data) {
+			return nil
+		}
+		if string(data[0:4]) == "EXIF" {
+			return bytes.TrimPrefix(data[8:8+length], jpegExifHeader)
+		}
+		// Chunks are padded to an even size.
+		length += length & 1
+		if 8+length > len(data) {
+			return nil
+		}
+		data = data[8+length:]
+	}
+	return nil
+}
+
+// ParseTIFF parses EXIF data (TIFF structure).
+func ParseTIFF(data []byte) (Tags, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif: invalid header")
+	}
+	var bo binary.ByteOrder
+	switch string(data[0:4]) {
+	case "II*\x00":
+		bo = binary.LittleEndian
+	case "MM\x00*":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: invalid header")
+	}
+	p := &parser{
+		data:    data,
+		bo:      bo,
+		tags:    make(Tags),
+		visited: make(map[uint32]bool),
+	}
+	err := p.parseIFD(bo.Uint32(data[4:8]), ifd0Tags, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.tags, nil
+}
+
+// ResetOrientation returns a copy of the EXIF data (TIFF structure) with the "Orientation" tag set to 1 (normal).
+//
+// It should be used when the orientation was applied to the pixels.
+// The data is returned as is if there is no "Orientation" tag.
+func ResetOrientation(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif: invalid header")
+	}
+	var bo binary.ByteOrder
+	switch string(data[0:4]) {
+	case "II*\x00":
+		bo = binary.LittleEndian
+	case "MM\x00*":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: invalid header")
+	}
+	offset := bo.Uint32(data[4:8])
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("exif: invalid IFD offset %d", offset)
+	}
+	count := int(bo.Uint16(data[offset:]))
+	entries := data[offset+2:]
+	if count*12 > len(entries) {
+		return nil, fmt.Errorf("exif: invalid IFD entries count %d", count)
+	}
+	for i := range count {
+		entry := entries[i*12 : i*12+12]
+		if bo.Uint16(entry[0:2]) != tagOrientation {
+			continue
+		}
+		if bo.Uint16(entry[2:4]) != 3 || bo.Uint32(entry[4:8]) != 1 { // 1 SHORT.
+			return nil, fmt.Errorf("exif: invalid Orientation tag")
+		}
+		res := bytes.Clone(data)
+		pos := int(offset) + 2 + i*12 + 8
+		bo.PutUint16(res[pos:], 1)
+		return res, nil
+	}
+	return data, nil
+}
+
+const (
+	tagOrientation    = 0x0112
+	tagExifIFDPointer = 0x8769
+	tagGPSIFDPointer  = 0x8825
+)
+
+var ifd0Tags = map[uint16]string{
+	0x010e: "ImageDescription",
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x011a: "XResolution",
+	0x011b: "YResolution",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013b: "Artist",
+	0x8298: "Copyright",
+}
+
+var exifTags = map[uint16]string{
+	0x829a: "ExposureTime",
+	0x829d: "FNumber",
+	0x8822: "ExposureProgram",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9201: "ShutterSpeedValue",
+	0x9202: "ApertureValue",
+	0x9204: "ExposureBiasValue",
+	0x9207: "MeteringMode",
+	0x9209: "Flash",
+	0x920a: "FocalLength",
+	0xa001: "ColorSpace",
+	0xa002: "PixelXDimension",
+	0xa003: "PixelYDimension",
+	0xa405: "FocalLengthIn35mmFilm",
+	0xa433: "LensMake",
+	0xa434: "LensModel",
+}
+
+var gpsTags = map[uint16]string{
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0005: "GPSAltitudeRef",
+	0x0006: "GPSAltitude",
+	0x0007: "GPSTimeStamp",
+	0x001d: "GPSDateStamp",
+}
+
+type parser struct {
+	data    []byte
+	bo      binary.ByteOrder
+	tags    Tags
+	visited map[uint32]bool
+}
+
+// parseIFD parses an IFD.
+// The sub IFDs (Exif and GPS) are only parsed if root is true.
+func (p *parser) parseIFD(offset uint32, names map[uint16]string, root bool) error {
+	if p.visited[offset] {
+		return fmt.Errorf("exif: IFD loop")
+	}
+	p.visited[offset] = true
+	if uint64(offset)+2 > uint64(len(p.data)) {
+		return fmt.Errorf("exif: invalid IFD offset %d", offset)
+	}
+	count := int(p.bo.Uint16(p.data[offset:]))
+	entries := p.data[offset+2:]
+	if count*12 > len(entries) {
+		return fmt.Errorf("exif: invalid IFD entries count %d", count)
+	}
+	for i := range count {
+		entry := entries[i*12 : i*12+12]
+		tag := p.bo.Uint16(entry[0:2])
+		switch {
+		case tag == tagExifIFDPointer && root:
+			err := p.parseIFD(p.bo.Uint32(entry[8:12]), exifTags, false)
+			if err != nil {
+				return err
+			}
+		case tag == tagGPSIFDPointer && root:
+			err := p.parseIFD(p.bo.Uint32(entry[8:12]), gpsTags, false)
+			if err != nil {
+				return err
+			}
+		default:
+			name, ok := names[tag]
+			if !ok {
+				continue
+			}
+			v, ok := p.parseValue(entry)
+			if ok {
+				p.tags[name] = v
+			}
+		}
+	}
+	return nil
+}
+
+var typeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+// parseValue parses the value of an IFD entry.
+// It returns false if the type is not supported or the value is invalid.
+func (p *parser) parseValue(entry []byte) (any, bool) {
+	typ := p.bo.Uint16(entry[2:4])
+	count := p.bo.Uint32(entry[4:8])
+	size, ok := typeSizes[typ]
+	if !ok || count == 0 {
+		return nil, false
+	}
+	total := uint64(size) * uint64(count)
+	var b []byte
+	if total <= 4 {
+		b = entry[8 : 8+total]
+	} else {
+		offset := uint64(p.bo.Uint32(entry[8:12]))
+		if offset+total > uint64(len(p.data)) {
+			return nil, false
+		}
+		b = p.data[offset : offset+total]
+	}
+	if typ == 2 {
+		return strings.TrimRight(string(b), "\x00 "), true
+	}
+	n := int(count)
+	switch typ {
+	case 5, 10:
+		vs := make([]float64, n)
+		for i := range n {
+			num, den := p.bo.Uint32(b[i*8:]), p.bo.Uint32(b[i*8+4:])
+			if den == 0 {
+				continue
+			}
+			if typ == 10 {
+				vs[i] = float64(int32(num)) / float64(int32(den))
+			} else {
+				vs[i] = float64(num) / float64(den)
+			}
+		}
+		if n == 1 {
+			return vs[0], true
+		}
+		return vs, true
+	}
+	vs := make([]int, n)
+	for i := range n {
+		switch typ {
+		case 1:
+			vs[i] = int(b[i])
+		case 3:
+			vs[i] = int(p.bo.Uint16(b[i*2:]))
+		case 4:
+			vs[i] = int(p.bo.Uint32(b[i*4:]))
+		case 9:
+			vs[i] = int(int32(p.bo.Uint32(b[i*4:])))
+		}
+	}
+	if n == 1 {
+		return vs[0], true
+	}
+	return vs, true
+}
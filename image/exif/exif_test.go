@@ -0,0 +1,245 @@
+package exif
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		expected map[string]any
+	}{
+		{
+			name: "JPEGBigEndian",
+			data: testdata.Medium.Data,
+			expected: map[string]any{
+				"Make":            "Canon",
+				"Model":           "Canon EOS 550D",
+				"Orientation":     1,
+				"FNumber":         7.1,
+				"ISOSpeedRatings": 100,
+				"PixelXDimension": 1024,
+			},
+		},
+		{
+			name: "JPEGLittleEndian",
+			data: testdata.Large.Data,
+			expected: map[string]any{
+				"Make":     "Canon",
+				"Software": "picnik.com",
+				"FNumber":  10.0,
+			},
+		},
+		{
+			name: "PNG",
+			data: testPNG(testTIFF(6)),
+			expected: map[string]any{
+				"Orientation": 6,
+			},
+		},
+		{
+			name: "WebP",
+			data: testWebP(testTIFF(3)),
+			expected: map[string]any{
+				"Orientation": 3,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tags, err := Parse(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tc.expected {
+				got, ok := tags[k]
+				if !ok {
+					t.Fatalf("tag %s not found", k)
+				}
+				if got != want {
+					t.Fatalf("unexpected value for tag %s: got %#v, want %#v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseNone(t *testing.T) {
+	for _, data := range [][]byte{
+		testdata.Small.Data,
+		testdata.Random.Data,
+		testdata.Animated.Data,
+		nil,
+	} {
+		tags, err := Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags != nil {
+			t.Fatalf("unexpected tags: %v", tags)
+		}
+	}
+}
+
+func TestParseTIFFError(t *testing.T) {
+	valid := testTIFF(1)
+	loop := testTIFF(1)
+	// The next IFD is not parsed, so a loop is created with the Exif IFD pointer.
+	binary.BigEndian.PutUint16(loop[10:12], tagExifIFDPointer)
+	binary.BigEndian.PutUint16(loop[12:14], 4)
+	binary.BigEndian.PutUint32(loop[14:18], 1)
+	binary.BigEndian.PutUint32(loop[18:22], 8)
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Short", data: []byte("MM")},
+		{name: "Header", data: []byte("XX\x00*\x00\x00\x00\x08")},
+		{name: "Offset", data: append([]byte("MM\x00*\x00\x00\xff\xff"), valid[8:]...)},
+		{name: "Count", data: valid[:12]},
+		{name: "Loop", data: loop},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseTIFF(tc.data)
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestTagsOrientation(t *testing.T) {
+	for _, tc := range []struct {
+		tags     Tags
+		expected int
+	}{
+		{tags: nil, expected: 1},
+		{tags: Tags{"Orientation": 6}, expected: 6},
+		{tags: Tags{"Orientation": 9}, expected: 1},
+		{tags: Tags{"Orientation": "foo"}, expected: 1},
+	} {
+		if o := tc.tags.Orientation(); o != tc.expected {
+			t.Fatalf("unexpected orientation: got %d, want %d", o, tc.expected)
+		}
+	}
+}
+
+func TestResetOrientation(t *testing.T) {
+	data := testTIFF(6)
+	res, err := ResetOrientation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := ParseTIFF(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := tags.Orientation(); o != 1 {
+		t.Fatalf("unexpected orientation: got %d, want %d", o, 1)
+	}
+	tags, err = ParseTIFF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := tags.Orientation(); o != 6 {
+		t.Fatalf("source data modified: got orientation %d, want %d", o, 6)
+	}
+}
+
+func TestResetOrientationNone(t *testing.T) {
+	data := []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	res, err := ResetOrientation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != string(data) {
+		t.Fatal("data changed")
+	}
+}
+
+func TestResetOrientationError(t *testing.T) {
+	valid := testTIFF(6)
+	long := testTIFF(6)
+	binary.BigEndian.PutUint16(long[12:14], 4) // LONG.
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Short", data: []byte("MM")},
+		{name: "Header", data: []byte("XX\x00*\x00\x00\x00\x08")},
+		{name: "Offset", data: append([]byte("MM\x00*\x00\x00\xff\xff"), valid[8:]...)},
+		{name: "Count", data: valid[:12]},
+		{name: "Type", data: long},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ResetOrientation(tc.data)
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+// testTIFF returns a big endian TIFF structure with the Orientation tag.
+func TestTagsRemoveGPS(t *testing.T) {
+	tags := Tags{
+		"Make":            "Canon",
+		"GPSLatitudeRef":  "N",
+		"GPSLatitude":     []float64{48, 51, 24},
+		"GPSLongitudeRef": "E",
+		"GPSLongitude":    []float64{2, 21, 3},
+	}
+	tags.RemoveGPS()
+	if len(tags) != 1 || tags["Make"] != "Canon" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	Tags(nil).RemoveGPS()
+}
+
+func testTIFF(orientation int) []byte {
+	data := []byte("MM\x00*\x00\x00\x00\x08")
+	data = binary.BigEndian.AppendUint16(data, 1)
+	data = binary.BigEndian.AppendUint16(data, 0x0112)
+	data = binary.BigEndian.AppendUint16(data, 3)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = binary.BigEndian.AppendUint16(data, uint16(orientation))
+	data = binary.BigEndian.AppendUint16(data, 0)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	return data
+}
+
+func testPNG(exif []byte) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	chunk := func(typ string, b []byte) {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(b)))
+		data = append(data, typ...)
+		data = append(data, b...)
+		data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(append([]byte(typ), b...)))
+	}
+	chunk("IHDR", make([]byte, 13))
+	chunk("eXIf", exif)
+	chunk("IEND", nil)
+	return data
+}
+
+func testWebP(exif []byte) []byte {
+	var chunks []byte
+	chunk := func(typ string, b []byte) {
+		chunks = append(chunks, typ...)
+		chunks = binary.LittleEndian.AppendUint32(chunks, uint32(len(b)))
+		chunks = append(chunks, b...)
+		if len(b)%2 == 1 {
+			chunks = append(chunks, 0)
+		}
+	}
+	chunk("VP8X", make([]byte, 9))
+	chunk("EXIF", exif)
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(4+len(chunks)))
+	data = append(data, "WEBP"...)
+	return append(data, chunks...)
+}
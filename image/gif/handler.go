@@ -2,22 +2,30 @@ package gif
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image/gif"
 
 	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
 )
 
 // Handler is a GIF imageserver.Handler implementation.
 //
 // Steps:
-//  - decode the GIF image
+//  - check the Limits and decode the GIF image
 //  - processes the GIF image with a Processor from this package
 //  - encode the image to GIF
 //
 // If there is nothing to do, Handler does not decode the GIF image or call the Processor.
+//
+// It implements imageserver.ChangeHandler.
 type Handler struct {
 	Processor Processor
+
+	// Limits are checked before the GIF image is decoded (imageserver/image.DefaultLimits if nil).
+	// All frames are checked (see imageserver/image.Limits.CheckFrames).
+	Limits *imageserver_image.Limits
 }
 
 // Handle implements imageserver.Handler.
@@ -28,6 +36,10 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	if !hdr.Processor.Change(params) {
 		return im, nil
 	}
+	err := hdr.getLimits().CheckFrames(im)
+	if err != nil {
+		return nil, err
+	}
 	g, err := gif.DecodeAll(bytes.NewReader(im.Data))
 	if err != nil {
 		return nil, &imageserver.ImageError{Message: err.Error()}
@@ -44,14 +56,34 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	im = &imageserver.Image{
 		Format: "gif",
 		Data:   buf.Bytes(),
+		Metadata: imageserver.ImageMetadata{
+			Width:      g.Config.Width,
+			Height:     g.Config.Height,
+			SourceETag: im.Metadata.SourceETag,
+		},
 	}
 	return im, nil
 }
 
+func (hdr *Handler) getLimits() imageserver_image.Limits {
+	if hdr.Limits != nil {
+		return *hdr.Limits
+	}
+	return imageserver_image.DefaultLimits
+}
+
+// Change implements imageserver.ChangeHandler.
+func (hdr *Handler) Change(format string, params imageserver.Params) bool {
+	return format != "gif" || hdr.Processor.Change(params)
+}
+
 // FallbackHandler is a imageserver.Handler implementation that allows to switch between a Handler of this package, or a fallback Handler.
 //
 // If the Image format and the "format" param are equal to "gif", the Handler of this package is used.
 // Otherwise, the fallback Handler is used.
+//
+// It implements imageserver.ContextHandler, and forwards the context to the selected Handler.
+// It implements imageserver.ChangeHandler, and returns true if the selected Handler doesn't implement it.
 type FallbackHandler struct {
 	*Handler
 	Fallback imageserver.Handler
@@ -59,11 +91,26 @@ type FallbackHandler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *FallbackHandler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *FallbackHandler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	h, err := hdr.getHandler(im, params)
 	if err != nil {
 		return nil, err
 	}
-	return h.Handle(im, params)
+	return imageserver.HandleContext(ctx, h, im, params)
+}
+
+// Change implements imageserver.ChangeHandler.
+func (hdr *FallbackHandler) Change(format string, params imageserver.Params) bool {
+	h, err := hdr.getHandler(&imageserver.Image{Format: format}, params)
+	if err != nil {
+		return true
+	}
+	ch, ok := h.(imageserver.ChangeHandler)
+	return !ok || ch.Change(format, params)
 }
 
 func (hdr *FallbackHandler) getHandler(im *imageserver.Image, params imageserver.Params) (imageserver.Handler, error) {
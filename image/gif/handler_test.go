@@ -7,10 +7,11 @@ import (
 	"testing"
 
 	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver.Handler = &Handler{}
+var _ imageserver.ChangeHandler = &Handler{}
 
 func TestHandler(t *testing.T) {
 	hdr := &Handler{
@@ -73,6 +74,27 @@ func TestHandlerErrorDecode(t *testing.T) {
 	}
 }
 
+func TestHandlerErrorLimits(t *testing.T) {
+	for _, limits := range []*imageserver_image.Limits{
+		{MaxWidth: 100},
+		{MaxFrames: 1},
+	} {
+		hdr := &Handler{
+			Processor: ProcessorFunc(func(g *gif.GIF, params imageserver.Params) (*gif.GIF, error) {
+				return g, nil
+			}),
+			Limits: limits,
+		}
+		_, err := hdr.Handle(testdata.Animated, imageserver.Params{})
+		if err == nil {
+			t.Fatal("no error")
+		}
+		if _, ok := err.(*imageserver.ImageError); !ok {
+			t.Fatalf("unexpected error type: got %T, want %T", err, &imageserver.ImageError{})
+		}
+	}
+}
+
 func TestHandlerErrorProcessor(t *testing.T) {
 	errPrc := fmt.Errorf("error")
 	hdr := &Handler{
@@ -193,3 +215,41 @@ func TestFallbackHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerChange(t *testing.T) {
+	hdr := &Handler{
+		Processor: testProcessorChange(false),
+	}
+	if hdr.Change("gif", imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !hdr.Change("jpeg", imageserver.Params{}) {
+		t.Fatal("not true")
+	}
+	hdr.Processor = testProcessorChange(true)
+	if !hdr.Change("gif", imageserver.Params{}) {
+		t.Fatal("not true")
+	}
+}
+
+var _ imageserver.ChangeHandler = &FallbackHandler{}
+
+func TestFallbackHandlerChange(t *testing.T) {
+	hdr := &FallbackHandler{
+		Handler: &Handler{
+			Processor: testProcessorChange(false),
+		},
+		Fallback: imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+			return im, nil
+		}),
+	}
+	if hdr.Change("gif", imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !hdr.Change("jpeg", imageserver.Params{}) {
+		t.Fatal("not true")
+	}
+	if !hdr.Change("gif", imageserver.Params{"format": 666}) {
+		t.Fatal("not true")
+	}
+}
@@ -0,0 +1,196 @@
+package gift
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/disintegration/gift"
+	"github.com/pierrre/imageserver"
+	imageserver_image_internal "github.com/pierrre/imageserver/image/internal"
+)
+
+const (
+	adjustParam = "gift_adjust"
+)
+
+// AdjustProcessor is a imageserver/image.Processor implementation that applies color adjustments, blur and sharpen filters with GIFT.
+//
+// All params are extracted from the "gift_adjust" node param and are optionals.
+// The filters are applied in this order:
+//   - brightness: percentage (-100 to 100), see github.com/disintegration/gift.Brightness
+//   - contrast: percentage (-100 to 100), see github.com/disintegration/gift.Contrast
+//   - saturation: percentage (-100 to 500), see github.com/disintegration/gift.Saturation
+//   - hue: angle shift (-180 to 180), see github.com/disintegration/gift.Hue
+//   - grayscale: boolean, see github.com/disintegration/gift.Grayscale
+//   - sepia: percentage (0 to 100), see github.com/disintegration/gift.Sepia
+//   - invert: boolean, see github.com/disintegration/gift.Invert
+//   - blur: sigma (0 to MaxSigma), see github.com/disintegration/gift.GaussianBlur
+//   - sharpen: sigma (0 to MaxSigma), see github.com/disintegration/gift.UnsharpMask
+//   - sharpen_amount: amount for sharpen (0 to 5), 1 by default
+//   - sharpen_threshold: threshold for sharpen (0 to 1), 0 by default
+//
+// A zero (or false) value doesn't apply the filter.
+type AdjustProcessor struct {
+	// MaxSigma is the maximum sigma for blur and sharpen (DefaultAdjustMaxSigma if 0).
+	// The processing time increases with it.
+	MaxSigma float64
+}
+
+// DefaultAdjustMaxSigma is the default value for AdjustProcessor.MaxSigma.
+const DefaultAdjustMaxSigma = 20
+
+// Process implements imageserver/image.Processor.
+func (prc *AdjustProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	if !params.Has(adjustParam) {
+		return nim, nil
+	}
+	params, err := params.GetParams(adjustParam)
+	if err != nil {
+		return nil, err
+	}
+	if params.Empty() {
+		return nim, nil
+	}
+	nim, err = prc.process(nim, params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = fmt.Sprintf("%s.%s", adjustParam, err.Param)
+		}
+		return nil, err
+	}
+	return nim, nil
+}
+
+func (prc *AdjustProcessor) process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	fs, err := prc.getFilters(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) == 0 {
+		return nim, nil
+	}
+	g := gift.New(fs...)
+	out := imageserver_image_internal.NewDrawableSize(nim, g.Bounds(nim.Bounds()))
+	g.Draw(out, nim)
+	return out, nil
+}
+
+// nolint: gocyclo
+func (prc *AdjustProcessor) getFilters(params imageserver.Params) ([]gift.Filter, error) {
+	var fs []gift.Filter
+	for _, af := range []struct {
+		name     string
+		min, max float64
+		filter   func(float32) gift.Filter
+	}{
+		{"brightness", -100, 100, gift.Brightness},
+		{"contrast", -100, 100, gift.Contrast},
+		{"saturation", -100, 500, gift.Saturation},
+		{"hue", -180, 180, gift.Hue},
+	} {
+		v, err := getAdjustFloat(af.name, af.min, af.max, 0, params)
+		if err != nil {
+			return nil, err
+		}
+		if v != 0 {
+			fs = append(fs, af.filter(float32(v)))
+		}
+	}
+	grayscale, err := getAdjustBool("grayscale", params)
+	if err != nil {
+		return nil, err
+	}
+	if grayscale {
+		fs = append(fs, gift.Grayscale())
+	}
+	sepia, err := getAdjustFloat("sepia", 0, 100, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	if sepia != 0 {
+		fs = append(fs, gift.Sepia(float32(sepia)))
+	}
+	invert, err := getAdjustBool("invert", params)
+	if err != nil {
+		return nil, err
+	}
+	if invert {
+		fs = append(fs, gift.Invert())
+	}
+	maxSigma := prc.MaxSigma
+	if maxSigma <= 0 {
+		maxSigma = DefaultAdjustMaxSigma
+	}
+	blur, err := getAdjustFloat("blur", 0, maxSigma, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	if blur != 0 {
+		fs = append(fs, gift.GaussianBlur(float32(blur)))
+	}
+	sharpen, err := getAdjustFloat("sharpen", 0, maxSigma, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := getAdjustFloat("sharpen_amount", 0, 5, 1, params)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := getAdjustFloat("sharpen_threshold", 0, 1, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	if sharpen != 0 && amount != 0 {
+		fs = append(fs, gift.UnsharpMask(float32(sharpen), float32(amount), float32(threshold)))
+	}
+	return fs, nil
+}
+
+func getAdjustFloat(name string, min, max, def float64, params imageserver.Params) (float64, error) {
+	if !params.Has(name) {
+		return def, nil
+	}
+	v, err := params.GetFloat(name)
+	if err != nil {
+		return 0, err
+	}
+	if !(v >= min && v <= max) {
+		return 0, &imageserver.ParamError{Param: name, Message: fmt.Sprintf("must be between %g and %g", min, max)}
+	}
+	return v, nil
+}
+
+func getAdjustBool(name string, params imageserver.Params) (bool, error) {
+	if !params.Has(name) {
+		return false, nil
+	}
+	return params.GetBool(name)
+}
+
+// Change implements imageserver/image.Processor.
+func (prc *AdjustProcessor) Change(params imageserver.Params) bool {
+	if !params.Has(adjustParam) {
+		return false
+	}
+	params, err := params.GetParams(adjustParam)
+	if err != nil {
+		return true
+	}
+	for _, name := range []string{"brightness", "contrast", "saturation", "hue", "sepia", "blur", "sharpen"} {
+		if params.Has(name) {
+			v, err := params.GetFloat(name)
+			if err != nil || v != 0 {
+				return true
+			}
+		}
+	}
+	for _, name := range []string{"grayscale", "invert"} {
+		if params.Has(name) {
+			v, err := params.GetBool(name)
+			if err != nil || v {
+				return true
+			}
+		}
+	}
+	return false
+}
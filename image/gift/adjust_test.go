@@ -0,0 +1,251 @@
+package gift
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+var _ imageserver_image.Processor = &AdjustProcessor{}
+
+func newAdjustTestImage() image.Image {
+	nim := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(nim, nim.Bounds(), image.NewUniform(color.RGBA{R: 0xc0, G: 0x40, B: 0x20, A: 0xff}), image.Point{}, draw.Src)
+	draw.Draw(nim, image.Rect(10, 0, 20, 20), image.NewUniform(color.White), image.Point{}, draw.Src)
+	return nim
+}
+
+func TestAdjustProcessorProcess(t *testing.T) {
+	prc := &AdjustProcessor{}
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expectedColor      color.RGBA
+		expectedParamError string
+	}{
+		{
+			name:          "Empty",
+			params:        imageserver.Params{},
+			expectedColor: color.RGBA{R: 0xc0, G: 0x40, B: 0x20, A: 0xff},
+		},
+		{
+			name:          "EmptyParam",
+			params:        imageserver.Params{adjustParam: imageserver.Params{}},
+			expectedColor: color.RGBA{R: 0xc0, G: 0x40, B: 0x20, A: 0xff},
+		},
+		{
+			name: "Zero",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"brightness": 0.0,
+				"grayscale":  false,
+				"blur":       0.0,
+			}},
+			expectedColor: color.RGBA{R: 0xc0, G: 0x40, B: 0x20, A: 0xff},
+		},
+		{
+			name: "Invert",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"invert": true,
+			}},
+			expectedColor: color.RGBA{R: 0x3f, G: 0xbf, B: 0xdf, A: 0xff},
+		},
+		{
+			name: "BrightnessMin",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"brightness": -100.0,
+			}},
+			expectedColor: color.RGBA{A: 0xff},
+		},
+		{
+			name: "Order",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"invert":     true,
+				"brightness": -100.0,
+			}},
+			expectedColor: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		},
+		{
+			name: "All",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"brightness":        10.0,
+				"contrast":          10.0,
+				"saturation":        10.0,
+				"hue":               10.0,
+				"grayscale":         true,
+				"sepia":             10.0,
+				"invert":            true,
+				"blur":              1.0,
+				"sharpen":           1.0,
+				"sharpen_amount":    1.5,
+				"sharpen_threshold": 0.05,
+			}},
+		},
+		{
+			name:               "ErrorParam",
+			params:             imageserver.Params{adjustParam: "invalid"},
+			expectedParamError: adjustParam,
+		},
+		{
+			name:               "ErrorBrightness",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"brightness": 200.0}},
+			expectedParamError: adjustParam + ".brightness",
+		},
+		{
+			name:               "ErrorContrast",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"contrast": -200.0}},
+			expectedParamError: adjustParam + ".contrast",
+		},
+		{
+			name:               "ErrorSaturation",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"saturation": 600.0}},
+			expectedParamError: adjustParam + ".saturation",
+		},
+		{
+			name:               "ErrorHue",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"hue": "invalid"}},
+			expectedParamError: adjustParam + ".hue",
+		},
+		{
+			name:               "ErrorGrayscale",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"grayscale": "invalid"}},
+			expectedParamError: adjustParam + ".grayscale",
+		},
+		{
+			name:               "ErrorSepia",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"sepia": -1.0}},
+			expectedParamError: adjustParam + ".sepia",
+		},
+		{
+			name:               "ErrorInvert",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"invert": "invalid"}},
+			expectedParamError: adjustParam + ".invert",
+		},
+		{
+			name:               "ErrorBlur",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"blur": 100.0}},
+			expectedParamError: adjustParam + ".blur",
+		},
+		{
+			name:               "ErrorSharpen",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"sharpen": -1.0}},
+			expectedParamError: adjustParam + ".sharpen",
+		},
+		{
+			name:               "ErrorSharpenAmount",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"sharpen": 1.0, "sharpen_amount": 10.0}},
+			expectedParamError: adjustParam + ".sharpen_amount",
+		},
+		{
+			name:               "ErrorSharpenThreshold",
+			params:             imageserver.Params{adjustParam: imageserver.Params{"sharpen": 1.0, "sharpen_threshold": 2.0}},
+			expectedParamError: adjustParam + ".sharpen_threshold",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nim, err := prc.Process(newAdjustTestImage(), tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if nim.Bounds() != image.Rect(0, 0, 20, 20) {
+				t.Fatalf("unexpected bounds: %s", nim.Bounds())
+			}
+			if tc.expectedColor == (color.RGBA{}) {
+				return
+			}
+			c := color.RGBAModel.Convert(nim.At(2, 10)).(color.RGBA)
+			if c != tc.expectedColor {
+				t.Fatalf("unexpected color: got %v, want %v", c, tc.expectedColor)
+			}
+		})
+	}
+}
+
+func TestAdjustProcessorProcessMaxSigma(t *testing.T) {
+	prc := &AdjustProcessor{MaxSigma: 1}
+	_, err := prc.Process(newAdjustTestImage(), imageserver.Params{adjustParam: imageserver.Params{"blur": 2.0}})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	_, err = prc.Process(newAdjustTestImage(), imageserver.Params{adjustParam: imageserver.Params{"blur": 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdjustProcessorChange(t *testing.T) {
+	prc := &AdjustProcessor{}
+	for _, tc := range []struct {
+		name     string
+		params   imageserver.Params
+		expected bool
+	}{
+		{
+			name:     "Empty",
+			params:   imageserver.Params{},
+			expected: false,
+		},
+		{
+			name:     "ParamInvalid",
+			params:   imageserver.Params{adjustParam: "invalid"},
+			expected: true,
+		},
+		{
+			name:     "ParamEmpty",
+			params:   imageserver.Params{adjustParam: imageserver.Params{}},
+			expected: false,
+		},
+		{
+			name: "Zero",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"blur":      0.0,
+				"grayscale": false,
+			}},
+			expected: false,
+		},
+		{
+			name: "Blur",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"blur": 1.0,
+			}},
+			expected: true,
+		},
+		{
+			name: "Grayscale",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"grayscale": true,
+			}},
+			expected: true,
+		},
+		{
+			name: "ValueInvalid",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"hue": "invalid",
+			}},
+			expected: true,
+		},
+		{
+			name: "ParamUnknown",
+			params: imageserver.Params{adjustParam: imageserver.Params{
+				"foo": "bar",
+			}},
+			expected: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := prc.Change(tc.params)
+			if result != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", result, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package gift
+
+import (
+	"image"
+
+	"github.com/disintegration/gift"
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/image/exif"
+	imageserver_image_internal "github.com/pierrre/imageserver/image/internal"
+)
+
+const (
+	autoOrientParam = "auto_orient"
+)
+
+// AutoOrientProcessor is a imageserver/image.Processor implementation that applies the EXIF orientation with GIFT.
+//
+// It is enabled by the boolean "auto_orient" param, or by default if DefaultEnabled is true.
+//
+// It implements imageserver/image.SourceProcessor, and reads the EXIF orientation from the source Image data.
+// It implements imageserver/image.Orienter, so imageserver/image.Handler resets the orientation of the copied EXIF.
+// Process() (without the source Image) does nothing.
+// It must be placed before the other Processors, because the orientation applies to the source Image.
+//
+// Change() returns true if it is enabled (like imageserver/image.ChangeProcessor), because the orientation is unknown before the source Image is read.
+type AutoOrientProcessor struct {
+	DefaultEnabled bool
+}
+
+// Process implements imageserver/image.Processor.
+func (prc *AutoOrientProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	_, err := prc.isEnabled(params)
+	if err != nil {
+		return nil, err
+	}
+	return nim, nil
+}
+
+// ProcessSource implements imageserver/image.SourceProcessor.
+func (prc *AutoOrientProcessor) ProcessSource(nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	enabled, err := prc.isEnabled(params)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nim, nil
+	}
+	tags, err := exif.Parse(im.Data)
+	if err != nil {
+		// Invalid EXIF data is ignored, like most image viewers do.
+		return nim, nil
+	}
+	f := orientationFilter(tags.Orientation())
+	if f == nil {
+		return nim, nil
+	}
+	g := gift.New(f)
+	out := imageserver_image_internal.NewDrawableSize(nim, g.Bounds(nim.Bounds()))
+	g.Draw(out, nim)
+	return out, nil
+}
+
+// orientationFilter returns the filter that transforms an Image with the EXIF orientation to the normal orientation.
+// It returns nil for the normal orientation.
+func orientationFilter(orientation int) gift.Filter {
+	switch orientation {
+	case 2:
+		return gift.FlipHorizontal()
+	case 3:
+		return gift.Rotate180()
+	case 4:
+		return gift.FlipVertical()
+	case 5:
+		return gift.Transpose()
+	case 6:
+		return gift.Rotate270()
+	case 7:
+		return gift.Transverse()
+	case 8:
+		return gift.Rotate90()
+	}
+	return nil
+}
+
+func (prc *AutoOrientProcessor) isEnabled(params imageserver.Params) (bool, error) {
+	if !params.Has(autoOrientParam) {
+		return prc.DefaultEnabled, nil
+	}
+	return params.GetBool(autoOrientParam)
+}
+
+// Orient implements imageserver/image.Orienter.
+func (prc *AutoOrientProcessor) Orient(params imageserver.Params) bool {
+	enabled, err := prc.isEnabled(params)
+	return err == nil && enabled
+}
+
+// Change implements imageserver/image.Processor.
+func (prc *AutoOrientProcessor) Change(params imageserver.Params) bool {
+	enabled, err := prc.isEnabled(params)
+	return err != nil || enabled
+}
@@ -0,0 +1,273 @@
+package gift
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	"github.com/pierrre/imageserver/image/exif"
+	_ "github.com/pierrre/imageserver/image/jpeg"
+	imageserver_testdata "github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver_image.SourceProcessor = &AutoOrientProcessor{}
+
+var _ imageserver_image.Orienter = &AutoOrientProcessor{}
+
+func TestAutoOrientProcessor(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 819))
+	for _, tc := range []struct {
+		name               string
+		prc                *AutoOrientProcessor
+		orientation        int
+		params             imageserver.Params
+		expectedWidth      int
+		expectedHeight     int
+		expectedParamError string
+	}{
+		{
+			name:           "Disabled",
+			prc:            &AutoOrientProcessor{},
+			orientation:    6,
+			params:         imageserver.Params{},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name:           "DisabledParam",
+			prc:            &AutoOrientProcessor{DefaultEnabled: true},
+			orientation:    6,
+			params:         imageserver.Params{autoOrientParam: false},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name:           "Param",
+			prc:            &AutoOrientProcessor{},
+			orientation:    6,
+			params:         imageserver.Params{autoOrientParam: true},
+			expectedWidth:  819,
+			expectedHeight: 1024,
+		},
+		{
+			name:           "Default",
+			prc:            &AutoOrientProcessor{DefaultEnabled: true},
+			orientation:    8,
+			params:         imageserver.Params{},
+			expectedWidth:  819,
+			expectedHeight: 1024,
+		},
+		{
+			name:           "Normal",
+			prc:            &AutoOrientProcessor{DefaultEnabled: true},
+			orientation:    1,
+			params:         imageserver.Params{},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name:           "NoEXIF",
+			prc:            &AutoOrientProcessor{DefaultEnabled: true},
+			params:         imageserver.Params{},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			name:               "InvalidParam",
+			prc:                &AutoOrientProcessor{},
+			params:             imageserver.Params{autoOrientParam: "foo"},
+			expectedParamError: autoOrientParam,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			im := imageserver_testdata.Small
+			if tc.orientation != 0 {
+				im = testImageOrientation(t, tc.orientation)
+			}
+			nim, err := tc.prc.ProcessSource(src, im, tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if nim.Bounds().Dx() != tc.expectedWidth || nim.Bounds().Dy() != tc.expectedHeight {
+				t.Fatalf("unexpected size: got %dx%d, want %dx%d", nim.Bounds().Dx(), nim.Bounds().Dy(), tc.expectedWidth, tc.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestAutoOrientProcessorHandlerMetadata(t *testing.T) {
+	im := testImageOrientationSize(t, 6, 4, 2)
+	for _, tc := range []struct {
+		name                string
+		params              imageserver.Params
+		expectedWidth       int
+		expectedHeight      int
+		expectedOrientation int
+	}{
+		{
+			name:                "Enabled",
+			params:              imageserver.Params{autoOrientParam: true, imageserver_image.StripParam: "none"},
+			expectedWidth:       2,
+			expectedHeight:      4,
+			expectedOrientation: 1,
+		},
+		{
+			name:                "Disabled",
+			params:              imageserver.Params{"quality": 90, imageserver_image.StripParam: "none"},
+			expectedWidth:       4,
+			expectedHeight:      2,
+			expectedOrientation: 6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hdr := &imageserver_image.Handler{
+				Processor: imageserver_image.ListProcessor{&AutoOrientProcessor{}},
+			}
+			res, err := hdr.Handle(im, tc.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(res.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tc.expectedWidth || cfg.Height != tc.expectedHeight {
+				t.Fatalf("unexpected size: got %dx%d, want %dx%d", cfg.Width, cfg.Height, tc.expectedWidth, tc.expectedHeight)
+			}
+			tags, err := exif.Parse(res.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tags == nil {
+				t.Fatal("no EXIF")
+			}
+			if o := tags.Orientation(); o != tc.expectedOrientation {
+				t.Fatalf("unexpected orientation: got %d, want %d", o, tc.expectedOrientation)
+			}
+			// A second auto orientation is a no-op.
+			res2, err := hdr.Handle(res, imageserver.Params{autoOrientParam: true, imageserver_image.StripParam: "none"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg2, err := jpeg.DecodeConfig(bytes.NewReader(res2.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectedOrientation == 1 && (cfg2.Width != cfg.Width || cfg2.Height != cfg.Height) {
+				t.Fatalf("image rotated twice: got %dx%d, want %dx%d", cfg2.Width, cfg2.Height, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
+
+func TestAutoOrientProcessorProcess(t *testing.T) {
+	prc := &AutoOrientProcessor{DefaultEnabled: true}
+	src := image.NewRGBA(image.Rect(0, 0, 10, 5))
+	nim, err := prc.Process(src, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nim != src {
+		t.Fatal("image changed")
+	}
+	_, err = prc.Process(src, imageserver.Params{autoOrientParam: "foo"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestOrientationFilter(t *testing.T) {
+	// 3x2 image, each pixel has a unique color.
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := range 2 {
+		for x := range 3 {
+			src.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 0xff})
+		}
+	}
+	for _, tc := range []struct {
+		orientation int
+		// The source pixel that is displayed at the top left.
+		expectedTopLeft image.Point
+		swapped         bool
+	}{
+		{orientation: 1, expectedTopLeft: image.Pt(0, 0)},
+		{orientation: 2, expectedTopLeft: image.Pt(2, 0)},
+		{orientation: 3, expectedTopLeft: image.Pt(2, 1)},
+		{orientation: 4, expectedTopLeft: image.Pt(0, 1)},
+		{orientation: 5, expectedTopLeft: image.Pt(0, 0), swapped: true},
+		{orientation: 6, expectedTopLeft: image.Pt(0, 1), swapped: true},
+		{orientation: 7, expectedTopLeft: image.Pt(2, 1), swapped: true},
+		{orientation: 8, expectedTopLeft: image.Pt(2, 0), swapped: true},
+	} {
+		f := orientationFilter(tc.orientation)
+		var out image.Image = src
+		if f != nil {
+			dst := image.NewNRGBA(f.Bounds(src.Bounds()))
+			f.Draw(dst, src, nil)
+			out = dst
+		}
+		if swapped := out.Bounds().Dx() == 2; swapped != tc.swapped {
+			t.Fatalf("orientation %d: unexpected size %v", tc.orientation, out.Bounds())
+		}
+		b := out.Bounds()
+		got := color.NRGBAModel.Convert(out.At(b.Min.X, b.Min.Y)).(color.NRGBA)
+		if int(got.R) != tc.expectedTopLeft.X || int(got.G) != tc.expectedTopLeft.Y {
+			t.Fatalf("orientation %d: unexpected top left pixel: got (%d,%d), want %v", tc.orientation, got.R, got.G, tc.expectedTopLeft)
+		}
+	}
+}
+
+func TestAutoOrientProcessorChange(t *testing.T) {
+	prc := &AutoOrientProcessor{}
+	if prc.Change(imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !prc.Change(imageserver.Params{autoOrientParam: true}) {
+		t.Fatal("not true")
+	}
+	if !prc.Change(imageserver.Params{autoOrientParam: "foo"}) {
+		t.Fatal("not true")
+	}
+	prc.DefaultEnabled = true
+	if !prc.Change(imageserver.Params{}) {
+		t.Fatal("not true")
+	}
+}
+
+// testImageOrientation returns a JPEG Image with the EXIF orientation.
+func testImageOrientation(t *testing.T, orientation int) *imageserver.Image {
+	return testImageOrientationSize(t, orientation, 1, 1)
+}
+
+func testImageOrientationSize(t *testing.T, orientation int, width, height int) *imageserver.Image {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM\x00*\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = binary.BigEndian.AppendUint16(tiff, 0)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xff, 0xd8, 0xff, 0xe1}
+	data = binary.BigEndian.AppendUint16(data, uint16(2+len(segment)))
+	data = append(data, segment...)
+	data = append(data, buf.Bytes()[2:]...)
+	return &imageserver.Image{Format: "jpeg", Data: data}
+}
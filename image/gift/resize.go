@@ -18,11 +18,15 @@ const (
 // All params are extracted from the "gift_resize" node param and are optionals:
 //  - width
 //  - height
+//  - dpr: device pixel ratio (1 to 4), the width and height are multiplied by it, and limited to MaxWidth and MaxHeight (keeping the aspect ratio)
 //  - mode: resize mode
 //      possible values:
 //      - <no value> (default): see github.com/disintegration/gift.Resize
 //      - fit: see github.com/disintegration/gift.ResizeToFit
 //      - fill: see github.com/disintegration/gift.ResizeToFill
+//  - focus_x, focus_y: focal point for the "fill" mode, as fractions of the width and height (0 to 1)
+//      The cropped area is centered on the focal point, and kept inside the Image.
+//      The default value is 0.5 (center).
 //  - resampling: resampling method
 //      possible values:
 //      - nearest_neighbor (default)
@@ -66,6 +70,10 @@ func (prc *ResizeProcessor) process(nim image.Image, params imageserver.Params)
 	if width == 0 && height == 0 {
 		return nim, err
 	}
+	nim, err = prc.focus(nim, width, height, params)
+	if err != nil {
+		return nil, err
+	}
 	f, err := prc.getFilter(width, height, params)
 	if err != nil {
 		return nil, err
@@ -76,6 +84,43 @@ func (prc *ResizeProcessor) process(nim image.Image, params imageserver.Params)
 	return out, nil
 }
 
+// Bounds implements imageserver/image.BoundsProcessor.
+func (prc *ResizeProcessor) Bounds(bds image.Rectangle, params imageserver.Params) (image.Rectangle, error) {
+	if !params.Has(resizeParam) {
+		return bds, nil
+	}
+	params, err := params.GetParams(resizeParam)
+	if err != nil {
+		return image.ZR, err
+	}
+	if params.Empty() {
+		return bds, nil
+	}
+	bds, err = prc.bounds(bds, params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = fmt.Sprintf("%s.%s", resizeParam, err.Param)
+		}
+		return image.ZR, err
+	}
+	return bds, nil
+}
+
+func (prc *ResizeProcessor) bounds(bds image.Rectangle, params imageserver.Params) (image.Rectangle, error) {
+	width, height, err := prc.getSize(params)
+	if err != nil {
+		return image.ZR, err
+	}
+	if width == 0 && height == 0 {
+		return bds, nil
+	}
+	f, err := prc.getFilter(width, height, params)
+	if err != nil {
+		return image.ZR, err
+	}
+	return gift.New(f).Bounds(bds), nil
+}
+
 func (prc *ResizeProcessor) getSize(params imageserver.Params) (int, int, error) {
 	w, err := prc.getDimension("width", prc.MaxWidth, params)
 	if err != nil {
@@ -85,6 +130,11 @@ func (prc *ResizeProcessor) getSize(params imageserver.Params) (int, int, error)
 	if err != nil {
 		return 0, 0, err
 	}
+	dpr, err := imageserver_image_internal.GetDPR(params)
+	if err != nil {
+		return 0, 0, err
+	}
+	w, h = imageserver_image_internal.ScaleSize(w, h, dpr, prc.MaxWidth, prc.MaxHeight)
 	return w, h, nil
 }
 
@@ -126,6 +176,31 @@ func (prc *ResizeProcessor) getFilter(width, height int, params imageserver.Para
 	return nil, &imageserver.ParamError{Param: "mode", Message: "invalid value"}
 }
 
+// focus crops the Image around the focal point, if the mode is "fill" and the focal point is set.
+func (prc *ResizeProcessor) focus(nim image.Image, width, height int, params imageserver.Params) (image.Image, error) {
+	if width == 0 || height == 0 || !params.Has("mode") {
+		return nim, nil
+	}
+	if !params.Has("focus_x") && !params.Has("focus_y") {
+		return nim, nil
+	}
+	mode, err := params.GetString("mode")
+	if err != nil || mode != "fill" {
+		// The error is returned by getFilter().
+		return nim, nil
+	}
+	fx, err := imageserver_image_internal.GetFocus("focus_x", params)
+	if err != nil {
+		return nil, err
+	}
+	fy, err := imageserver_image_internal.GetFocus("focus_y", params)
+	if err != nil {
+		return nil, err
+	}
+	r := imageserver_image_internal.FocusRectangle(nim.Bounds(), width, height, fx, fy)
+	return imageserver_image_internal.Crop(nim, r), nil
+}
+
 func (prc *ResizeProcessor) getResampling(params imageserver.Params) (gift.Resampling, error) {
 	if !params.Has("resampling") {
 		if prc.DefaultResampling != nil {
@@ -1,6 +1,8 @@
 package gift
 
 import (
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/disintegration/gift"
@@ -12,6 +14,8 @@ import (
 
 var _ imageserver_image.Processor = &ResizeProcessor{}
 
+var _ imageserver_image.BoundsProcessor = &ResizeProcessor{}
+
 // nolint: gocyclo
 func TestResizeProcessorProcess(t *testing.T) {
 	nim, err := imageserver_image.Decode(imageserver_testdata.Medium)
@@ -72,6 +76,48 @@ func TestResizeProcessorProcess(t *testing.T) {
 			expectedWidth:  100,
 			expectedHeight: 100,
 		},
+		// dpr
+		{
+			name: "DPR",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":  100,
+				"height": 50,
+				"dpr":    2.0,
+			}},
+			expectedWidth:  200,
+			expectedHeight: 100,
+		},
+		{
+			name:      "DPRMax",
+			processor: &ResizeProcessor{MaxWidth: 150},
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width": 100,
+				"dpr":   2.0,
+			}},
+			expectedWidth: 150,
+		},
+		{
+			name:      "DPRMaxAspectRatio",
+			processor: &ResizeProcessor{MaxWidth: 2000},
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":  800,
+				"height": 400,
+				"dpr":    3.0,
+			}},
+			expectedWidth:  2000,
+			expectedHeight: 1000,
+		},
+		{
+			name:      "DPRMaxHeight",
+			processor: &ResizeProcessor{MaxHeight: 120},
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":  100,
+				"height": 50,
+				"dpr":    4.0,
+			}},
+			expectedWidth:  240,
+			expectedHeight: 120,
+		},
 		// mode
 		{
 			name: "ModeFit",
@@ -102,6 +148,29 @@ func TestResizeProcessorProcess(t *testing.T) {
 			expectedWidth:  100,
 			expectedHeight: 80,
 		},
+		{
+			name: "ModeFillFocus",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_x": 0.1,
+				"focus_y": 0.9,
+			}},
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name: "ModeFitFocus",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fit",
+				"focus_x": 0.1,
+			}},
+			expectedWidth:  100,
+			expectedHeight: 80,
+		},
 		// resampling
 		{
 			name:      "ResamplingDefault",
@@ -152,6 +221,22 @@ func TestResizeProcessorProcess(t *testing.T) {
 			expectedWidth: 100,
 		},
 		// error
+		{
+			name: "DPRInvalidType",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width": 100,
+				"dpr":   "invalid",
+			}},
+			expectedParamError: resizeParam + ".dpr",
+		},
+		{
+			name: "DPRInvalidRange",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width": 100,
+				"dpr":   0.5,
+			}},
+			expectedParamError: resizeParam + ".dpr",
+		},
 		{
 			name:               "ParamInvalid",
 			params:             imageserver.Params{resizeParam: "invalid"},
@@ -219,6 +304,26 @@ func TestResizeProcessorProcess(t *testing.T) {
 			}},
 			expectedParamError: resizeParam + ".mode",
 		},
+		{
+			name: "FocusInvalidType",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_x": "invalid",
+			}},
+			expectedParamError: resizeParam + ".focus_x",
+		},
+		{
+			name: "FocusInvalidRange",
+			params: imageserver.Params{resizeParam: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_y": 1.5,
+			}},
+			expectedParamError: resizeParam + ".focus_y",
+		},
 		{
 			name: "ResamplingInvalidType",
 			params: imageserver.Params{resizeParam: imageserver.Params{
@@ -241,6 +346,7 @@ func TestResizeProcessorProcess(t *testing.T) {
 			if prc == nil {
 				prc = &ResizeProcessor{}
 			}
+			srcBds := nim.Bounds()
 			nim, err := prc.Process(nim, tc.params)
 			if err != nil {
 				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
@@ -257,10 +363,82 @@ func TestResizeProcessorProcess(t *testing.T) {
 			if tc.expectedHeight != 0 && nim.Bounds().Dy() != tc.expectedHeight {
 				t.Fatalf("unexpected height: got %d, want %d", nim.Bounds().Dy(), tc.expectedHeight)
 			}
+			bds, err := prc.Bounds(srcBds, tc.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bds != nim.Bounds() {
+				t.Fatalf("unexpected planned bounds: got %s, want %s", bds, nim.Bounds())
+			}
+		})
+	}
+}
+
+func TestResizeProcessorFocus(t *testing.T) {
+	nim := testImageHalves()
+	for _, tc := range []struct {
+		name     string
+		focusX   float64
+		expected color.Color
+	}{
+		{
+			name:     "Left",
+			focusX:   0,
+			expected: color.NRGBA{R: 0xff, A: 0xff},
+		},
+		{
+			name:     "Right",
+			focusX:   1,
+			expected: color.NRGBA{B: 0xff, A: 0xff},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := (&ResizeProcessor{}).Process(nim, imageserver.Params{resizeParam: imageserver.Params{
+				"width":   10,
+				"height":  10,
+				"mode":    "fill",
+				"focus_x": tc.focusX,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Bounds().Dx() != 10 || res.Bounds().Dy() != 10 {
+				t.Fatalf("unexpected size: %s", res.Bounds())
+			}
+			testImageUniform(t, res, tc.expected)
 		})
 	}
 }
 
+// testImageHalves returns a 200x100 Image, with a red left half and a blue right half.
+func testImageHalves() image.Image {
+	nim := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := range 100 {
+		for x := range 200 {
+			c := color.NRGBA{R: 0xff, A: 0xff}
+			if x >= 100 {
+				c = color.NRGBA{B: 0xff, A: 0xff}
+			}
+			nim.SetNRGBA(x, y, c)
+		}
+	}
+	return nim
+}
+
+func testImageUniform(tb testing.TB, nim image.Image, expected color.Color) {
+	tb.Helper()
+	bds := nim.Bounds()
+	er, eg, eb, ea := expected.RGBA()
+	for y := bds.Min.Y; y < bds.Max.Y; y++ {
+		for x := bds.Min.X; x < bds.Max.X; x++ {
+			r, g, b, a := nim.At(x, y).RGBA()
+			if r != er || g != eg || b != eb || a != ea {
+				tb.Fatalf("unexpected color at (%d,%d): got %v, want %v", x, y, nim.At(x, y), expected)
+			}
+		}
+	}
+}
+
 func TestResizeProcessorChange(t *testing.T) {
 	prc := &ResizeProcessor{}
 	for _, tc := range []struct {
@@ -1,7 +1,10 @@
 package image
 
 import (
+	"context"
+
 	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/image/metadata"
 )
 
 // Handler is a imageserver.Handler implementation that uses Go "image" package.
@@ -10,12 +13,32 @@ import (
 // It uses the "format" param to determine which Encoder is used.
 //
 // If there is nothing to do, Handler does not decode the Image or call the Processor.
+// If the Processor implements SourceProcessor, the source Image is given to it.
+// If the Processor implements ContextProcessor, the context is given to it too.
+// The encoded Image has the dimensions and the source ETag in its imageserver.ImageMetadata.
+//
+// The metadata (ICC profile, EXIF and XMP) is controlled by the "strip" and "keep_icc" params (see StripParam and KeepICCParam).
+// By default, an unchanged Image keeps its metadata, and an encoded Image has no metadata.
+// If the metadata must be removed from an unchanged Image, it is rewritten without decoding (JPEG and PNG), or decoded and encoded again (other formats).
+// The metadata is copied to the encoded Image only between JPEG and PNG formats.
+// If the Processor applies the EXIF orientation (see Orienter), the orientation of the copied EXIF is reset to normal.
+//
+// It implements imageserver.ContextHandler, and checks the context between the decoding, processing and encoding steps.
+// It implements imageserver.ChangeHandler.
 type Handler struct {
 	Processor Processor // Optional Processor
+
+	// Limits are checked before the Image is decoded (DefaultLimits if nil).
+	Limits *Limits
 }
 
 // Handle implements imageserver.Handler.
 func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	enc, format, err := getEncoderFormat(im.Format, params)
 	if err != nil {
 		if _, ok := err.(*imageserver.ParamError); !ok {
@@ -23,28 +46,77 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 		}
 		return nil, err
 	}
-	if !hdr.change(im, format, enc, params) {
-		return im, nil
+	if !hdr.change(im.Format, format, enc, params) {
+		keep, err := getMetadataKeep(params, metadataKeepAll)
+		if err != nil {
+			return nil, err
+		}
+		if keep == metadataKeepAll {
+			return im, nil
+		}
+		if metadata.Supported(im.Format) {
+			return stripMetadata(im, keep)
+		}
+	}
+	keep, err := getMetadataKeep(params, metadataKeepNone)
+	if err != nil {
+		return nil, err
 	}
-	nim, err := Decode(im)
+	nim, err := DecodeLimits(im, hdr.getLimits())
 	if err != nil {
 		return nil, err
 	}
 	if hdr.Processor != nil {
-		nim, err = hdr.Processor.Process(nim, params)
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		nim, err = ProcessContext(ctx, hdr.Processor, nim, im, params)
 		if err != nil {
 			return nil, err
 		}
 	}
-	im, err = encode(nim, format, enc, params)
+	err = ctx.Err()
 	if err != nil {
 		return nil, err
 	}
-	return im, nil
+	res, err := encode(nim, format, enc, params)
+	if err != nil {
+		return nil, err
+	}
+	res.Metadata.SourceETag = im.Metadata.SourceETag
+	err = copyMetadata(im, res, keep, hdr.Processor != nil && Orient(hdr.Processor, params))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (hdr *Handler) getLimits() Limits {
+	if hdr.Limits != nil {
+		return *hdr.Limits
+	}
+	return DefaultLimits
+}
+
+// Change implements imageserver.ChangeHandler.
+//
+// It returns true if the "format" param is invalid, so the error is returned by Handle().
+// It returns true if metadata must be removed.
+func (hdr *Handler) Change(imFormat string, params imageserver.Params) bool {
+	enc, format, err := getEncoderFormat(imFormat, params)
+	if err != nil {
+		return true
+	}
+	if hdr.change(imFormat, format, enc, params) {
+		return true
+	}
+	keep, err := getMetadataKeep(params, metadataKeepAll)
+	return err != nil || keep != metadataKeepAll
 }
 
-func (hdr *Handler) change(im *imageserver.Image, format string, enc Encoder, params imageserver.Params) bool {
-	if format != im.Format {
+func (hdr *Handler) change(imFormat string, format string, enc Encoder, params imageserver.Params) bool {
+	if format != imFormat {
 		return true
 	}
 	if hdr.Processor != nil && hdr.Processor.Change(params) {
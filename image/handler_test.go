@@ -9,7 +9,7 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver.Handler = &Handler{}
+var _ imageserver.ChangeHandler = &Handler{}
 
 func TestHandler(t *testing.T) {
 	hdr := &Handler{}
@@ -30,6 +30,51 @@ func TestHandlerNoChange(t *testing.T) {
 	}
 }
 
+func TestHandlerChange(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		format   string
+		params   imageserver.Params
+		expected bool
+	}{
+		{
+			name:   "None",
+			format: "jpeg",
+			params: imageserver.Params{},
+		},
+		{
+			name:   "SameFormat",
+			format: "jpeg",
+			params: imageserver.Params{"format": "jpeg"},
+		},
+		{
+			name:     "Format",
+			format:   "png",
+			params:   imageserver.Params{"format": "jpeg"},
+			expected: true,
+		},
+		{
+			name:     "Encoder",
+			format:   "jpeg",
+			params:   imageserver.Params{"quality": 85},
+			expected: true,
+		},
+		{
+			name:     "ErrorFormat",
+			format:   "jpeg",
+			params:   imageserver.Params{"format": "unknown"},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := (&Handler{}).Change(tc.format, tc.params)
+			if c != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", c, tc.expected)
+			}
+		})
+	}
+}
+
 func TestHandlerFormat(t *testing.T) {
 	hdr := &Handler{}
 	_, err := hdr.Handle(testdata.Medium, imageserver.Params{"format": "jpeg"})
@@ -38,6 +83,33 @@ func TestHandlerFormat(t *testing.T) {
 	}
 }
 
+func TestHandlerImageMetadata(t *testing.T) {
+	src := &imageserver.Image{
+		Format: testdata.Medium.Format,
+		Data:   testdata.Medium.Data,
+		Metadata: imageserver.ImageMetadata{
+			SourceETag: `"foo"`,
+		},
+	}
+	hdr := &Handler{}
+	im, err := hdr.Handle(src, imageserver.Params{"quality": 85})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nim, err := Decode(testdata.Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := imageserver.ImageMetadata{
+		Width:      nim.Bounds().Dx(),
+		Height:     nim.Bounds().Dy(),
+		SourceETag: `"foo"`,
+	}
+	if im.Metadata != expected {
+		t.Fatalf("unexpected metadata: got %+v, want %+v", im.Metadata, expected)
+	}
+}
+
 func TestHandlerProcessor(t *testing.T) {
 	hdr := &Handler{
 		Processor: ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
@@ -1,9 +1,30 @@
 // Package image provides a bridge to the Go "image" package.
+//
+// The Handlers of this package and its sub-packages check the Limits of the Images before decoding them.
+// If the Limits of a Handler are not set, DefaultLimits are used, so huge Images are rejected by default.
+// Decode doesn't check any Limits.
 package image
 
-import "github.com/pierrre/imageserver"
+import (
+	"github.com/pierrre/imageserver"
+	imageserver_image_internal "github.com/pierrre/imageserver/image/internal"
+)
 
 // Changer returns true if the Image could change for the given Params.
 type Changer interface {
 	Change(imageserver.Params) bool
 }
+
+// GetDPR returns the "dpr" param (device pixel ratio, 1 to 4, 1 by default).
+//
+// GetDPR and ScaleSize are shared by the resize implementations, including the ones outside of this package tree (e.g. imageserver/graphicsmagick).
+func GetDPR(params imageserver.Params) (float64, error) {
+	return imageserver_image_internal.GetDPR(params)
+}
+
+// ScaleSize multiplies width and height by the device pixel ratio, with a single factor that keeps the aspect ratio.
+//
+// The factor is reduced so the result fits in maxWidth x maxHeight (0 means no limit).
+func ScaleSize(width, height int, dpr float64, maxWidth, maxHeight int) (int, int) {
+	return imageserver_image_internal.ScaleSize(width, height, dpr, maxWidth, maxHeight)
+}
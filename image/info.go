@@ -0,0 +1,140 @@
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/image/exif"
+)
+
+const (
+	// InfoParam is the param that enables the info mode of InfoHandler.
+	InfoParam = "info"
+
+	// InfoFormat is the format of the Image returned by InfoHandler.
+	InfoFormat = "json"
+)
+
+// Info contains information about an Image.
+type Info struct {
+	Format     string    `json:"format"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Size       int       `json:"size"`
+	ColorModel string    `json:"color_model"`
+	EXIF       exif.Tags `json:"exif,omitempty"`
+}
+
+// GetInfo returns the Info of the Image.
+//
+// It uses image.DecodeConfig(), so the Image is not fully decoded.
+// The decoder for the Image format must be registered.
+func GetInfo(im *imageserver.Image) (*Info, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(im.Data))
+	if err != nil {
+		return nil, &imageserver.ImageError{Message: err.Error()}
+	}
+	if format != im.Format {
+		return nil, &imageserver.ImageError{Message: fmt.Sprintf("decoded format \"%s\" does not match image format \"%s\"", format, im.Format)}
+	}
+	tags, err := exif.Parse(im.Data)
+	if err != nil {
+		// Invalid EXIF data doesn't prevent the image from being displayed.
+		tags = nil
+	}
+	return &Info{
+		Format:     im.Format,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		Size:       len(im.Data),
+		ColorModel: colorModelName(cfg.ColorModel),
+		EXIF:       tags,
+	}, nil
+}
+
+func colorModelName(m color.Model) string {
+	switch m {
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.AlphaModel:
+		return "alpha"
+	case color.Alpha16Model:
+		return "alpha16"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case color.YCbCrModel:
+		return "ycbcr"
+	case color.NYCbCrAModel:
+		return "nycbcra"
+	case color.CMYKModel:
+		return "cmyk"
+	}
+	if _, ok := m.(color.Palette); ok {
+		return "paletted"
+	}
+	return "unknown"
+}
+
+// InfoHandler is a imageserver.Handler implementation that returns the Info of the Image.
+//
+// If the "info" param is true, it returns an Image with the "json" format that contains the Info encoded in JSON.
+// Otherwise it returns the given Image.
+// The returned Image can be stored in a cache, like any other Image.
+//
+// It implements imageserver.ChangeHandler.
+type InfoHandler struct {
+	// GPS includes the GPS EXIF tags in the Info.
+	// They are removed by default, because they reveal the location where the Image was taken.
+	GPS bool
+}
+
+// Handle implements imageserver.Handler.
+func (hdr *InfoHandler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	info, err := getInfoParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if !info {
+		return im, nil
+	}
+	inf, err := GetInfo(im)
+	if err != nil {
+		return nil, err
+	}
+	if !hdr.GPS {
+		inf.EXIF.RemoveGPS()
+	}
+	data, err := json.Marshal(inf)
+	if err != nil {
+		return nil, err
+	}
+	return &imageserver.Image{
+		Format: InfoFormat,
+		Data:   data,
+	}, nil
+}
+
+// Change implements imageserver.ChangeHandler.
+func (hdr *InfoHandler) Change(format string, params imageserver.Params) bool {
+	info, err := getInfoParam(params)
+	return err != nil || info
+}
+
+func getInfoParam(params imageserver.Params) (bool, error) {
+	if !params.Has(InfoParam) {
+		return false, nil
+	}
+	return params.GetBool(InfoParam)
+}
@@ -0,0 +1,212 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+	_ "image/png"
+)
+
+func TestGetInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		image              *imageserver.Image
+		expectedWidth      int
+		expectedHeight     int
+		expectedColorModel string
+		expectedEXIF       bool
+	}{
+		{
+			name:               "JPEG",
+			image:              testdata.Medium,
+			expectedWidth:      1024,
+			expectedHeight:     819,
+			expectedColorModel: "ycbcr",
+			expectedEXIF:       true,
+		},
+		{
+			name:               "PNG",
+			image:              testdata.Random,
+			expectedWidth:      1024,
+			expectedHeight:     1024,
+			expectedColorModel: "rgba",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := GetInfo(tc.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Format != tc.image.Format {
+				t.Fatalf("unexpected format: got %s, want %s", info.Format, tc.image.Format)
+			}
+			if info.Width != tc.expectedWidth || info.Height != tc.expectedHeight {
+				t.Fatalf("unexpected size: got %dx%d, want %dx%d", info.Width, info.Height, tc.expectedWidth, tc.expectedHeight)
+			}
+			if info.Size != len(tc.image.Data) {
+				t.Fatalf("unexpected byte size: got %d, want %d", info.Size, len(tc.image.Data))
+			}
+			if info.ColorModel != tc.expectedColorModel {
+				t.Fatalf("unexpected color model: got %s, want %s", info.ColorModel, tc.expectedColorModel)
+			}
+			if (info.EXIF != nil) != tc.expectedEXIF {
+				t.Fatalf("unexpected EXIF: %v", info.EXIF)
+			}
+		})
+	}
+}
+
+func TestGetInfoError(t *testing.T) {
+	for _, im := range []*imageserver.Image{
+		testdata.Invalid,
+		{Format: "png", Data: testdata.Medium.Data},
+	} {
+		_, err := GetInfo(im)
+		if err == nil {
+			t.Fatal("no error")
+		}
+		if _, ok := err.(*imageserver.ImageError); !ok {
+			t.Fatalf("unexpected error type: %T", err)
+		}
+	}
+}
+
+func TestColorModelName(t *testing.T) {
+	for _, tc := range []struct {
+		model    color.Model
+		expected string
+	}{
+		{model: color.RGBAModel, expected: "rgba"},
+		{model: color.GrayModel, expected: "gray"},
+		{model: color.CMYKModel, expected: "cmyk"},
+		{model: color.Palette{color.Black}, expected: "paletted"},
+		{model: color.ModelFunc(func(c color.Color) color.Color { return c }), expected: "unknown"},
+	} {
+		if name := colorModelName(tc.model); name != tc.expected {
+			t.Fatalf("unexpected name: got %s, want %s", name, tc.expected)
+		}
+	}
+}
+
+var _ imageserver.ChangeHandler = &InfoHandler{}
+
+func TestInfoHandler(t *testing.T) {
+	hdr := &InfoHandler{}
+	im, err := hdr.Handle(testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("image changed")
+	}
+	im, err = hdr.Handle(testdata.Medium, imageserver.Params{InfoParam: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != InfoFormat {
+		t.Fatalf("unexpected format: got %s, want %s", im.Format, InfoFormat)
+	}
+	info := new(Info)
+	err = json.Unmarshal(im.Data, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 1024 || info.EXIF["Make"] != "Canon" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
+
+func TestInfoHandlerGPS(t *testing.T) {
+	im := newTestImageGPS(t)
+	for _, tc := range []struct {
+		name        string
+		handler     *InfoHandler
+		expectedGPS bool
+	}{
+		{
+			name:    "Default",
+			handler: &InfoHandler{},
+		},
+		{
+			name:        "Enabled",
+			handler:     &InfoHandler{GPS: true},
+			expectedGPS: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.handler.Handle(im, imageserver.Params{InfoParam: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			info := new(Info)
+			err = json.Unmarshal(res.Data, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, ok := info.EXIF["GPSLatitudeRef"]
+			if ok != tc.expectedGPS {
+				t.Fatalf("unexpected GPS: got %t, want %t (%s)", ok, tc.expectedGPS, res.Data)
+			}
+		})
+	}
+}
+
+// newTestImageGPS returns a JPEG Image with a GPS EXIF tag.
+func newTestImageGPS(t *testing.T) *imageserver.Image {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM\x00*\x00\x00\x00\x08")
+	// IFD0 with the GPS IFD pointer.
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x8825)
+	tiff = binary.BigEndian.AppendUint16(tiff, 4)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint32(tiff, 26)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0)
+	// GPS IFD with GPSLatitudeRef.
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0001)
+	tiff = binary.BigEndian.AppendUint16(tiff, 2)
+	tiff = binary.BigEndian.AppendUint32(tiff, 2)
+	tiff = append(tiff, "N\x00\x00\x00"...)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xff, 0xd8, 0xff, 0xe1}
+	data = binary.BigEndian.AppendUint16(data, uint16(2+len(segment)))
+	data = append(data, segment...)
+	data = append(data, buf.Bytes()[2:]...)
+	return &imageserver.Image{Format: "jpeg", Data: data}
+}
+
+func TestInfoHandlerError(t *testing.T) {
+	hdr := &InfoHandler{}
+	_, err := hdr.Handle(testdata.Medium, imageserver.Params{InfoParam: "foo"})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ParamError{})
+	}
+	_, err = hdr.Handle(testdata.Invalid, imageserver.Params{InfoParam: true})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+	}
+}
+
+func TestInfoHandlerChange(t *testing.T) {
+	hdr := &InfoHandler{}
+	if hdr.Change("jpeg", imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !hdr.Change("jpeg", imageserver.Params{InfoParam: true}) {
+		t.Fatal("not true")
+	}
+}
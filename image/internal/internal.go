@@ -5,7 +5,9 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
 
+	"github.com/pierrre/imageserver"
 	"github.com/pierrre/imageutil"
 )
 
@@ -70,3 +72,101 @@ func Copy(dst draw.Image, src image.Image) {
 		}
 	})
 }
+
+// FocusRectangle returns the largest rectangle in r with the aspect ratio of width x height.
+//
+// It is centered on the focal point (fx, fy), given as fractions (0 to 1) of r, and moved inside r if needed.
+func FocusRectangle(r image.Rectangle, width, height int, fx, fy float64) image.Rectangle {
+	w, h := r.Dx(), r.Dy()
+	if w <= 0 || h <= 0 || width <= 0 || height <= 0 {
+		return r
+	}
+	cw, ch := w, h
+	if w*height > h*width {
+		cw = max(int(math.Round(float64(h)*float64(width)/float64(height))), 1)
+	} else {
+		ch = max(int(math.Round(float64(w)*float64(height)/float64(width))), 1)
+	}
+	x := focusOffset(w, cw, fx)
+	y := focusOffset(h, ch, fy)
+	return image.Rect(r.Min.X+x, r.Min.Y+y, r.Min.X+x+cw, r.Min.Y+y+ch)
+}
+
+func focusOffset(size, cropSize int, f float64) int {
+	o := int(math.Round(f*float64(size) - float64(cropSize)/2))
+	return min(max(o, 0), size-cropSize)
+}
+
+// GetDPR returns the "dpr" param (device pixel ratio, 1 to 4).
+//
+// The default value is 1.
+func GetDPR(params imageserver.Params) (float64, error) {
+	if !params.Has("dpr") {
+		return 1, nil
+	}
+	dpr, err := params.GetFloat("dpr")
+	if err != nil {
+		return 0, err
+	}
+	if !(dpr >= 1 && dpr <= 4) {
+		return 0, &imageserver.ParamError{Param: "dpr", Message: "must be between 1 and 4"}
+	}
+	return dpr, nil
+}
+
+// ScaleSize multiplies width and height by the device pixel ratio.
+//
+// A single factor is applied to both dimensions, so the aspect ratio is kept.
+// It is reduced so the result fits in maxWidth x maxHeight (0 means no limit).
+// A zero dimension (not set) stays zero.
+func ScaleSize(width, height int, dpr float64, maxWidth, maxHeight int) (int, int) {
+	f := dpr
+	if maxWidth > 0 && width > 0 {
+		f = min(f, float64(maxWidth)/float64(width))
+	}
+	if maxHeight > 0 && height > 0 {
+		f = min(f, float64(maxHeight)/float64(height))
+	}
+	return scaleDimension(width, f, maxWidth), scaleDimension(height, f, maxHeight)
+}
+
+func scaleDimension(d int, f float64, max int) int {
+	d = int(math.Round(float64(d) * f))
+	if max > 0 && d > max {
+		d = max // Rounding.
+	}
+	return d
+}
+
+// GetFocus returns the focal point coordinate param (0 to 1), for FocusRectangle.
+//
+// The default value is 0.5 (center).
+func GetFocus(name string, params imageserver.Params) (float64, error) {
+	if !params.Has(name) {
+		return 0.5, nil
+	}
+	f, err := params.GetFloat(name)
+	if err != nil {
+		return 0, err
+	}
+	if !(f >= 0 && f <= 1) {
+		return 0, &imageserver.ParamError{Param: name, Message: "must be between 0 and 1"}
+	}
+	return f, nil
+}
+
+// Crop returns the part of p in r.
+//
+// It uses the SubImage method if it is available, otherwise the part is copied.
+func Crop(p image.Image, r image.Rectangle) image.Image {
+	type subImager interface {
+		SubImage(image.Rectangle) image.Image
+	}
+	if si, ok := p.(subImager); ok {
+		return si.SubImage(r)
+	}
+	r = r.Intersect(p.Bounds())
+	dst := NewDrawableSize(p, r)
+	Copy(dst, p)
+	return dst
+}
@@ -7,6 +7,8 @@ import (
 	"image/draw"
 	"math/rand"
 	"testing"
+
+	"github.com/pierrre/imageserver"
 )
 
 func TestNewDrawable(t *testing.T) {
@@ -175,3 +177,216 @@ func testDrawRandom(p draw.Image) {
 		}
 	}
 }
+
+func TestFocusRectangle(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		r             image.Rectangle
+		width, height int
+		fx, fy        float64
+		expected      image.Rectangle
+	}{
+		{
+			name:     "Center",
+			r:        image.Rect(0, 0, 200, 100),
+			width:    10,
+			height:   10,
+			fx:       0.5,
+			fy:       0.5,
+			expected: image.Rect(50, 0, 150, 100),
+		},
+		{
+			name:     "Left",
+			r:        image.Rect(0, 0, 200, 100),
+			width:    10,
+			height:   10,
+			fx:       0.1,
+			fy:       0.5,
+			expected: image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:     "Right",
+			r:        image.Rect(0, 0, 200, 100),
+			width:    10,
+			height:   10,
+			fx:       0.6,
+			fy:       0.5,
+			expected: image.Rect(70, 0, 170, 100),
+		},
+		{
+			name:     "Bottom",
+			r:        image.Rect(0, 0, 100, 200),
+			width:    20,
+			height:   10,
+			fx:       0.5,
+			fy:       1,
+			expected: image.Rect(0, 150, 100, 200),
+		},
+		{
+			name:     "Offset",
+			r:        image.Rect(10, 10, 210, 110),
+			width:    10,
+			height:   10,
+			fx:       1,
+			fy:       0,
+			expected: image.Rect(110, 10, 210, 110),
+		},
+		{
+			name:     "SameRatio",
+			r:        image.Rect(0, 0, 200, 100),
+			width:    20,
+			height:   10,
+			fx:       0,
+			fy:       0,
+			expected: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name:     "ZeroSize",
+			r:        image.Rect(0, 0, 200, 100),
+			fx:       0.5,
+			fy:       0.5,
+			expected: image.Rect(0, 0, 200, 100),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := FocusRectangle(tc.r, tc.width, tc.height, tc.fx, tc.fy)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %s, want %s", res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestScaleSize(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		width, height       int
+		dpr                 float64
+		maxWidth, maxHeight int
+		expectedWidth       int
+		expectedHeight      int
+	}{
+		{
+			name:           "NoLimit",
+			width:          100,
+			height:         50,
+			dpr:            1.5,
+			expectedWidth:  150,
+			expectedHeight: 75,
+		},
+		{
+			name:           "MaxWidth",
+			width:          800,
+			height:         400,
+			dpr:            3,
+			maxWidth:       2000,
+			expectedWidth:  2000,
+			expectedHeight: 1000,
+		},
+		{
+			name:           "MaxHeight",
+			width:          800,
+			height:         400,
+			dpr:            3,
+			maxHeight:      1000,
+			expectedWidth:  2000,
+			expectedHeight: 1000,
+		},
+		{
+			name:           "MaxBoth",
+			width:          800,
+			height:         400,
+			dpr:            3,
+			maxWidth:       1600,
+			maxHeight:      1000,
+			expectedWidth:  1600,
+			expectedHeight: 800,
+		},
+		{
+			name:           "NotReached",
+			width:          100,
+			height:         100,
+			dpr:            2,
+			maxWidth:       1000,
+			maxHeight:      1000,
+			expectedWidth:  200,
+			expectedHeight: 200,
+		},
+		{
+			name:          "WidthOnly",
+			width:         100,
+			dpr:           2,
+			maxWidth:      150,
+			maxHeight:     10,
+			expectedWidth: 150,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w, h := ScaleSize(tc.width, tc.height, tc.dpr, tc.maxWidth, tc.maxHeight)
+			if w != tc.expectedWidth || h != tc.expectedHeight {
+				t.Fatalf("unexpected size: got %dx%d, want %dx%d", w, h, tc.expectedWidth, tc.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestGetFocus(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		params        imageserver.Params
+		expected      float64
+		expectedError bool
+	}{
+		{
+			name:     "Default",
+			params:   imageserver.Params{},
+			expected: 0.5,
+		},
+		{
+			name:     "Value",
+			params:   imageserver.Params{"focus_x": 0.25},
+			expected: 0.25,
+		},
+		{
+			name:          "ErrorInvalid",
+			params:        imageserver.Params{"focus_x": "invalid"},
+			expectedError: true,
+		},
+		{
+			name:          "ErrorRange",
+			params:        imageserver.Params{"focus_x": 1.5},
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := GetFocus("focus_x", tc.params)
+			if err != nil {
+				if tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError {
+				t.Fatal("no error")
+			}
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %v, want %v", res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCrop(t *testing.T) {
+	r := image.Rect(10, 20, 30, 40)
+	for _, p := range []image.Image{
+		image.NewRGBA(image.Rect(0, 0, 100, 100)),
+		image.NewUniform(color.Black),
+	} {
+		t.Run(fmt.Sprintf("%T", p), func(t *testing.T) {
+			res := Crop(p, r)
+			if res.Bounds() != r {
+				t.Fatalf("unexpected bounds: got %s, want %s", res.Bounds(), r)
+			}
+		})
+	}
+}
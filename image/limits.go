@@ -0,0 +1,160 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/pierrre/imageserver"
+)
+
+// Limits are the limits of an Image, checked before it is decoded.
+//
+// They protect against "decompression bombs": small Images that declare huge dimensions.
+// A zero value means no limit.
+//
+// MaxFrames and MaxTotalPixels are only checked by CheckFrames, because only the first frame is decoded otherwise.
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64 // Maximum width * height.
+	MaxFrames int   // Maximum number of frames (animated GIF).
+
+	// MaxTotalPixels is the maximum width * height * frames (animated GIF).
+	// It bounds the memory used by all the frames, that MaxPixels and MaxFrames don't bound together.
+	MaxTotalPixels int64
+}
+
+// DefaultLimits are the default Limits.
+//
+// They are used by the Handlers of this package and its sub-packages if their Limits are not set.
+// They are not used by Decode.
+var DefaultLimits = Limits{
+	MaxWidth:  16384,
+	MaxHeight: 16384,
+	MaxPixels: 100000000,
+	MaxFrames: 1000,
+
+	MaxTotalPixels: 1000000000,
+}
+
+// Check checks the declared dimensions of the Image, without decoding it.
+//
+// It returns an *imageserver.ImageError if a limit is exceeded, or if the Image config can't be decoded.
+// The frame count is not checked, see CheckFrames.
+func (l Limits) Check(im *imageserver.Image) error {
+	_, err := l.check(im)
+	return err
+}
+
+// CheckFrames is like Check, and it also checks the frame count and total pixels (MaxFrames and MaxTotalPixels).
+//
+// It must be used before all frames are decoded (e.g. imageserver/image/gif.Handler).
+// The frame count is only checked for the GIF format.
+func (l Limits) CheckFrames(im *imageserver.Image) error {
+	cfg, err := l.check(im)
+	if err != nil {
+		return err
+	}
+	if im.Format == "gif" {
+		return l.checkGIFFrames(im.Data, cfg)
+	}
+	return nil
+}
+
+func (l Limits) check(im *imageserver.Image) (image.Config, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(im.Data))
+	if err != nil {
+		return image.Config{}, &imageserver.ImageError{Message: err.Error()}
+	}
+	err = l.checkConfig(cfg)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return cfg, nil
+}
+
+func (l Limits) checkConfig(cfg image.Config) error {
+	if l.MaxWidth > 0 && cfg.Width > l.MaxWidth {
+		return &imageserver.ImageError{Message: fmt.Sprintf("width %d exceeds the maximum %d", cfg.Width, l.MaxWidth)}
+	}
+	if l.MaxHeight > 0 && cfg.Height > l.MaxHeight {
+		return &imageserver.ImageError{Message: fmt.Sprintf("height %d exceeds the maximum %d", cfg.Height, l.MaxHeight)}
+	}
+	if l.MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > l.MaxPixels {
+		return &imageserver.ImageError{Message: fmt.Sprintf("size %dx%d exceeds the maximum %d pixels", cfg.Width, cfg.Height, l.MaxPixels)}
+	}
+	return nil
+}
+
+func (l Limits) checkGIFFrames(data []byte, cfg image.Config) error {
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	checkTotal := l.MaxTotalPixels > 0 && pixels > 0
+	if l.MaxFrames <= 0 && !checkTotal {
+		return nil
+	}
+	// Only count the frames needed to exceed one of the limits.
+	max := l.MaxFrames
+	if checkTotal {
+		m := int(min(l.MaxTotalPixels/pixels, math.MaxInt32))
+		if max <= 0 || m < max {
+			max = m
+		}
+	}
+	n := countGIFFrames(data, max)
+	if l.MaxFrames > 0 && n > l.MaxFrames {
+		return &imageserver.ImageError{Message: fmt.Sprintf("frame count exceeds the maximum %d", l.MaxFrames)}
+	}
+	if checkTotal && int64(n)*pixels > l.MaxTotalPixels {
+		return &imageserver.ImageError{Message: fmt.Sprintf("size %dx%d with %d frames exceeds the maximum %d total pixels", cfg.Width, cfg.Height, n, l.MaxTotalPixels)}
+	}
+	return nil
+}
+
+// countGIFFrames returns the number of frames in the GIF data.
+//
+// It only reads the block structure, and stops counting after max frames.
+// If the data is invalid, it returns the number of frames found so far, the error is returned by the decoder.
+func countGIFFrames(data []byte, max int) int {
+	const headerSize = 6 + 7 // Signature + version, logical screen descriptor.
+	if len(data) < headerSize {
+		return 0
+	}
+	i := headerSize
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (1 + flags&0x07) // Global color table.
+	}
+	n := 0
+	for i < len(data) && n <= max {
+		switch data[i] {
+		case 0x21: // Extension.
+			i = skipGIFSubBlocks(data, i+2)
+		case 0x2c: // Image descriptor.
+			n++
+			i += 10
+			if i > len(data) {
+				return n
+			}
+			if flags := data[i-1]; flags&0x80 != 0 {
+				i += 3 << (1 + flags&0x07) // Local color table.
+			}
+			i = skipGIFSubBlocks(data, i+1) // LZW minimum code size, then image data.
+		default: // Trailer or invalid.
+			return n
+		}
+	}
+	return n
+}
+
+func skipGIFSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		size := int(data[i])
+		i++
+		if size == 0 {
+			break
+		}
+		i += size
+	}
+	return i
+}
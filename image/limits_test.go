@@ -0,0 +1,263 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+// newTestPNGBomb returns a PNG Image that declares the given dimensions, without image data.
+func newTestPNGBomb(width, height uint32) *imageserver.Image {
+	buf := new(bytes.Buffer)
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	ihdr[8] = 8 // Bit depth.
+	ihdr[9] = 6 // Color type RGBA.
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(ihdr)))
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte("IHDR"))
+	_, _ = crc.Write(ihdr)
+	buf.WriteString("IHDR")
+	buf.Write(ihdr)
+	_ = binary.Write(buf, binary.BigEndian, crc.Sum32())
+	return &imageserver.Image{Format: "png", Data: buf.Bytes()}
+}
+
+func newTestGIF(t *testing.T, frames int) *imageserver.Image {
+	t.Helper()
+	g := &gif.GIF{}
+	for range frames {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9))
+		g.Delay = append(g.Delay, 0)
+	}
+	buf := new(bytes.Buffer)
+	err := gif.EncodeAll(buf, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &imageserver.Image{Format: "gif", Data: buf.Bytes()}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		limits        Limits
+		image         *imageserver.Image
+		frames        bool
+		expectedError bool
+	}{
+		{
+			name:   "Default",
+			limits: DefaultLimits,
+			image:  testdata.Medium,
+		},
+		{
+			name:   "NoLimit",
+			limits: Limits{},
+			image:  newTestPNGBomb(50000, 50000),
+		},
+		{
+			name:          "DefaultBomb",
+			limits:        DefaultLimits,
+			image:         newTestPNGBomb(50000, 50000),
+			expectedError: true,
+		},
+		{
+			name:          "MaxWidth",
+			limits:        Limits{MaxWidth: 1000},
+			image:         testdata.Medium,
+			expectedError: true,
+		},
+		{
+			name:          "MaxHeight",
+			limits:        Limits{MaxHeight: 800},
+			image:         testdata.Medium,
+			expectedError: true,
+		},
+		{
+			name:          "MaxPixels",
+			limits:        Limits{MaxPixels: 10000},
+			image:         newTestPNGBomb(101, 100),
+			expectedError: true,
+		},
+		{
+			name:   "MaxPixelsEqual",
+			limits: Limits{MaxPixels: 10000},
+			image:  newTestPNGBomb(100, 100),
+		},
+		{
+			name:   "MaxFrames",
+			limits: Limits{MaxFrames: 3},
+			image:  newTestGIF(t, 3),
+			frames: true,
+		},
+		{
+			name:          "MaxFramesExceeded",
+			limits:        Limits{MaxFrames: 3},
+			image:         newTestGIF(t, 4),
+			frames:        true,
+			expectedError: true,
+		},
+		{
+			name:   "MaxTotalPixels",
+			limits: Limits{MaxTotalPixels: 48},
+			image:  newTestGIF(t, 3),
+			frames: true,
+		},
+		{
+			name:          "MaxTotalPixelsExceeded",
+			limits:        Limits{MaxTotalPixels: 48},
+			image:         newTestGIF(t, 4),
+			frames:        true,
+			expectedError: true,
+		},
+		{
+			name:          "MaxTotalPixelsExceededMaxFrames",
+			limits:        Limits{MaxFrames: 10, MaxTotalPixels: 48},
+			image:         newTestGIF(t, 4),
+			frames:        true,
+			expectedError: true,
+		},
+		{
+			name:          "MaxTotalPixelsSingleFrame",
+			limits:        Limits{MaxTotalPixels: 10},
+			image:         newTestGIF(t, 1),
+			frames:        true,
+			expectedError: true,
+		},
+		{
+			name:   "MaxFramesNotChecked",
+			limits: Limits{MaxFrames: 3, MaxTotalPixels: 48},
+			image:  newTestGIF(t, 4),
+		},
+		{
+			name:          "Invalid",
+			limits:        DefaultLimits,
+			image:         testdata.Invalid,
+			expectedError: true,
+		},
+		{
+			name:          "InvalidFrames",
+			limits:        DefaultLimits,
+			image:         testdata.Invalid,
+			frames:        true,
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			check := tc.limits.Check
+			if tc.frames {
+				check = tc.limits.CheckFrames
+			}
+			err := check(tc.image)
+			if err != nil {
+				if _, ok := err.(*imageserver.ImageError); ok && tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		max      int
+		expected int
+	}{
+		{
+			name:     "Animated",
+			data:     testdata.Animated.Data,
+			max:      1000,
+			expected: mustDecodeGIFFrames(t, testdata.Animated),
+		},
+		{
+			name:     "Spaceship",
+			data:     testdata.Spaceship.Data,
+			max:      1000,
+			expected: mustDecodeGIFFrames(t, testdata.Spaceship),
+		},
+		{
+			name:     "Max",
+			data:     newTestGIF(t, 10).Data,
+			max:      2,
+			expected: 3,
+		},
+		{
+			name:     "Truncated",
+			data:     newTestGIF(t, 2).Data[:20],
+			max:      1000,
+			expected: 0,
+		},
+		{
+			name:     "Empty",
+			max:      1000,
+			expected: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := countGIFFrames(tc.data, tc.max)
+			if n != tc.expected {
+				t.Fatalf("unexpected count: got %d, want %d", n, tc.expected)
+			}
+		})
+	}
+}
+
+func mustDecodeGIFFrames(t *testing.T, im *imageserver.Image) int {
+	t.Helper()
+	g, err := gif.DecodeAll(bytes.NewReader(im.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(g.Image)
+}
+
+func TestDecodeLimits(t *testing.T) {
+	_, err := Decode(newTestPNGBomb(50000, 50000))
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+	}
+	_, err = DecodeLimits(testdata.Medium, Limits{MaxWidth: 100})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+	}
+	_, err = DecodeLimits(testdata.Medium, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	hdr := &Handler{
+		Limits: &Limits{MaxWidth: 100},
+	}
+	_, err := hdr.Handle(testdata.Medium, imageserver.Params{"quality": 85})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+	}
+	// No decoding.
+	_, err = hdr.Handle(testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr = &Handler{}
+	_, err = hdr.Handle(newTestPNGBomb(50000, 50000), imageserver.Params{"format": "jpeg"})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ImageError{})
+	}
+}
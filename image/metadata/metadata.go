@@ -0,0 +1,422 @@
+// Package metadata reads and writes the metadata (ICC profile, EXIF and XMP) of encoded images.
+//
+// It supports the "jpeg" and "png" formats.
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Metadata is the metadata of an encoded image.
+//
+// A nil field means that the metadata is missing.
+type Metadata struct {
+	ICC  []byte // ICC profile
+	EXIF []byte // EXIF data (TIFF structure)
+	XMP  []byte // XMP packet
+}
+
+// Empty returns true if there is no metadata.
+func (md *Metadata) Empty() bool {
+	return md.ICC == nil && md.EXIF == nil && md.XMP == nil
+}
+
+// Supported returns true if the format is supported.
+func Supported(format string) bool {
+	return format == "jpeg" || format == "png"
+}
+
+// Read returns the Metadata of the data.
+//
+// It returns an empty Metadata if the format is not supported.
+// The returned data may share memory with the given data.
+func Read(format string, data []byte) (*Metadata, error) {
+	switch format {
+	case "jpeg":
+		return readJPEG(data)
+	case "png":
+		return readPNG(data)
+	}
+	return &Metadata{}, nil
+}
+
+// Write replaces the metadata of the data by the given Metadata.
+//
+// The existing ICC profile, EXIF and XMP are removed, and the non-nil fields of the Metadata are written.
+// It returns an error if the format is not supported.
+func Write(format string, data []byte, md *Metadata) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return writeJPEG(data, md)
+	case "png":
+		return writePNG(data, md)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+const (
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerEOI  = 0xd9
+	jpegMarkerSOS  = 0xda
+	jpegMarkerAPP0 = 0xe0
+	jpegMarkerAPP1 = 0xe1
+	jpegMarkerAPP2 = 0xe2
+
+	jpegMaxSegmentData = 0xffff - 2
+)
+
+var (
+	jpegEXIFHeader        = []byte("Exif\x00\x00")
+	jpegXMPHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegXMPExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	jpegICCHeader         = []byte("ICC_PROFILE\x00")
+	jpegJFIFHeader        = []byte("JFIF\x00")
+)
+
+type jpegSegment struct {
+	marker byte
+	data   []byte // Without marker and length.
+	raw    []byte // With marker and length.
+}
+
+// parseJPEG returns the segments before the start of scan, and the remaining data.
+func parseJPEG(data []byte) ([]jpegSegment, []byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegMarkerSOI {
+		return nil, nil, errors.New("invalid JPEG: missing start of image")
+	}
+	var segs []jpegSegment
+	p := data[2:]
+	for {
+		if len(p) < 2 || p[0] != 0xff {
+			return nil, nil, errors.New("invalid JPEG: invalid marker")
+		}
+		marker := p[1]
+		if marker == 0xff {
+			// Fill byte.
+			p = p[1:]
+			continue
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			return segs, p, nil
+		}
+		if (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 {
+			// Standalone marker.
+			segs = append(segs, jpegSegment{marker: marker, raw: p[:2]})
+			p = p[2:]
+			continue
+		}
+		if len(p) < 4 {
+			return nil, nil, errors.New("invalid JPEG: truncated segment")
+		}
+		length := int(binary.BigEndian.Uint16(p[2:4]))
+		if length < 2 || 2+length > len(p) {
+			return nil, nil, errors.New("invalid JPEG: invalid segment length")
+		}
+		segs = append(segs, jpegSegment{marker: marker, data: p[4 : 2+length], raw: p[:2+length]})
+		p = p[2+length:]
+	}
+}
+
+func readJPEG(data []byte) (*Metadata, error) {
+	segs, _, err := parseJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{}
+	var iccChunks []jpegICCChunk
+	for _, seg := range segs {
+		switch {
+		case seg.marker == jpegMarkerAPP1 && bytes.HasPrefix(seg.data, jpegEXIFHeader):
+			if md.EXIF == nil {
+				md.EXIF = bytes.TrimPrefix(seg.data, jpegEXIFHeader)
+			}
+		case seg.marker == jpegMarkerAPP1 && bytes.HasPrefix(seg.data, jpegXMPHeader):
+			if md.XMP == nil {
+				md.XMP = bytes.TrimPrefix(seg.data, jpegXMPHeader)
+			}
+		case seg.marker == jpegMarkerAPP2 && bytes.HasPrefix(seg.data, jpegICCHeader):
+			d := bytes.TrimPrefix(seg.data, jpegICCHeader)
+			if len(d) < 2 {
+				return nil, errors.New("invalid JPEG: invalid ICC profile chunk")
+			}
+			iccChunks = append(iccChunks, jpegICCChunk{seq: d[0], data: d[2:]})
+		}
+	}
+	if len(iccChunks) > 0 {
+		// The chunks are ordered by sequence number (starting at 1).
+		sort.SliceStable(iccChunks, func(i, j int) bool {
+			return iccChunks[i].seq < iccChunks[j].seq
+		})
+		var icc []byte
+		for _, c := range iccChunks {
+			icc = append(icc, c.data...)
+		}
+		md.ICC = icc
+	}
+	return md, nil
+}
+
+type jpegICCChunk struct {
+	seq  byte
+	data []byte
+}
+
+func isJPEGMetadata(seg jpegSegment) bool {
+	switch seg.marker {
+	case jpegMarkerAPP1:
+		return bytes.HasPrefix(seg.data, jpegEXIFHeader) || bytes.HasPrefix(seg.data, jpegXMPHeader) || bytes.HasPrefix(seg.data, jpegXMPExtendedHeader)
+	case jpegMarkerAPP2:
+		return bytes.HasPrefix(seg.data, jpegICCHeader)
+	}
+	return false
+}
+
+// writeJPEG writes the metadata after the start of image (and JFIF) marker.
+//
+// The EXIF and XMP that don't fit in a segment are not written.
+// The extended XMP is removed.
+func writeJPEG(data []byte, md *Metadata) ([]byte, error) {
+	segs, rest, err := parseJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+len(md.ICC)+len(md.EXIF)+len(md.XMP)))
+	buf.Write([]byte{0xff, jpegMarkerSOI})
+	if len(segs) > 0 && segs[0].marker == jpegMarkerAPP0 && bytes.HasPrefix(segs[0].data, jpegJFIFHeader) {
+		// The JFIF segment must be the first segment.
+		buf.Write(segs[0].raw)
+		segs = segs[1:]
+	}
+	if md.EXIF != nil && len(jpegEXIFHeader)+len(md.EXIF) <= jpegMaxSegmentData {
+		writeJPEGSegment(buf, jpegMarkerAPP1, jpegEXIFHeader, md.EXIF)
+	}
+	if md.XMP != nil && len(jpegXMPHeader)+len(md.XMP) <= jpegMaxSegmentData {
+		writeJPEGSegment(buf, jpegMarkerAPP1, jpegXMPHeader, md.XMP)
+	}
+	if md.ICC != nil {
+		err = writeJPEGICC(buf, md.ICC)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, seg := range segs {
+		if !isJPEGMetadata(seg) {
+			buf.Write(seg.raw)
+		}
+	}
+	buf.Write(rest)
+	return buf.Bytes(), nil
+}
+
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, header []byte, data []byte) {
+	buf.Write([]byte{0xff, marker})
+	_ = binary.Write(buf, binary.BigEndian, uint16(2+len(header)+len(data)))
+	buf.Write(header)
+	buf.Write(data)
+}
+
+func writeJPEGICC(buf *bytes.Buffer, icc []byte) error {
+	const chunkSize = jpegMaxSegmentData - 14 // ICC header + sequence number + count
+	count := (len(icc) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+	if count > 255 {
+		return fmt.Errorf("ICC profile too large: %d bytes", len(icc))
+	}
+	for i := range count {
+		end := min((i+1)*chunkSize, len(icc))
+		header := append(append([]byte{}, jpegICCHeader...), byte(i+1), byte(count))
+		writeJPEGSegment(buf, jpegMarkerAPP2, header, icc[i*chunkSize:end])
+	}
+	return nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	pngXMPKeyword = "XML:com.adobe.xmp"
+	pngICCName    = "ICC Profile"
+
+	// pngMaxDecompressedSize limits the decompressed size of the ICC profile and XMP.
+	pngMaxDecompressedSize = 16 << 20
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+	raw  []byte // With length, type and CRC.
+}
+
+func parsePNG(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("invalid PNG: missing signature")
+	}
+	var chunks []pngChunk
+	p := data[len(pngSignature):]
+	for len(p) > 0 {
+		if len(p) < 12 {
+			return nil, errors.New("invalid PNG: truncated chunk")
+		}
+		length := binary.BigEndian.Uint32(p[0:4])
+		if uint64(length)+12 > uint64(len(p)) {
+			return nil, errors.New("invalid PNG: invalid chunk length")
+		}
+		n := int(length)
+		chunks = append(chunks, pngChunk{typ: string(p[4:8]), data: p[8 : 8+n], raw: p[:12+n]})
+		p = p[12+n:]
+	}
+	return chunks, nil
+}
+
+func readPNG(data []byte) (*Metadata, error) {
+	chunks, err := parsePNG(data)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{}
+	for _, c := range chunks {
+		switch c.typ {
+		case "iCCP":
+			if md.ICC != nil {
+				continue
+			}
+			md.ICC, err = readPNGICC(c.data)
+			if err != nil {
+				return nil, err
+			}
+		case "eXIf":
+			if md.EXIF == nil {
+				md.EXIF = c.data
+			}
+		case "iTXt":
+			if md.XMP != nil || !isPNGXMP(c) {
+				continue
+			}
+			md.XMP, err = readPNGXMP(c.data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return md, nil
+}
+
+func readPNGICC(data []byte) ([]byte, error) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 || i+2 > len(data) {
+		return nil, errors.New("invalid PNG: invalid iCCP chunk")
+	}
+	if data[i+1] != 0 {
+		return nil, fmt.Errorf("invalid PNG: unknown iCCP compression method %d", data[i+1])
+	}
+	return decompressPNG(data[i+2:])
+}
+
+func isPNGXMP(c pngChunk) bool {
+	return c.typ == "iTXt" && bytes.HasPrefix(c.data, []byte(pngXMPKeyword+"\x00"))
+}
+
+func readPNGXMP(data []byte) ([]byte, error) {
+	p := data[len(pngXMPKeyword)+1:]
+	if len(p) < 2 {
+		return nil, errors.New("invalid PNG: invalid iTXt chunk")
+	}
+	compressed := p[0] == 1
+	p = p[2:]
+	// Skip the language tag and the translated keyword.
+	for range 2 {
+		i := bytes.IndexByte(p, 0)
+		if i < 0 {
+			return nil, errors.New("invalid PNG: invalid iTXt chunk")
+		}
+		p = p[i+1:]
+	}
+	if compressed {
+		return decompressPNG(p)
+	}
+	return p, nil
+}
+
+func decompressPNG(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PNG: %w", err)
+	}
+	d, err := io.ReadAll(io.LimitReader(r, pngMaxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PNG: %w", err)
+	}
+	if len(d) > pngMaxDecompressedSize {
+		return nil, errors.New("invalid PNG: decompressed data too large")
+	}
+	return d, nil
+}
+
+func isPNGMetadata(c pngChunk, md *Metadata) bool {
+	switch c.typ {
+	case "iCCP", "eXIf":
+		return true
+	case "sRGB":
+		// The sRGB chunk must not be present with the iCCP chunk.
+		return md.ICC != nil
+	}
+	return isPNGXMP(c)
+}
+
+// writePNG writes the metadata after the IHDR chunk.
+func writePNG(data []byte, md *Metadata) ([]byte, error) {
+	chunks, err := parsePNG(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return nil, errors.New("invalid PNG: missing IHDR chunk")
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+len(md.ICC)+len(md.EXIF)+len(md.XMP)))
+	buf.Write(pngSignature)
+	buf.Write(chunks[0].raw)
+	if md.ICC != nil {
+		zbuf := new(bytes.Buffer)
+		zbuf.WriteString(pngICCName)
+		zbuf.Write([]byte{0, 0})
+		zw := zlib.NewWriter(zbuf)
+		_, _ = zw.Write(md.ICC)
+		_ = zw.Close()
+		writePNGChunk(buf, "iCCP", zbuf.Bytes())
+	}
+	if md.EXIF != nil {
+		writePNGChunk(buf, "eXIf", md.EXIF)
+	}
+	if md.XMP != nil {
+		d := make([]byte, 0, len(pngXMPKeyword)+5+len(md.XMP))
+		d = append(d, pngXMPKeyword...)
+		// Null separator, compression flag, compression method, empty language tag and translated keyword.
+		d = append(d, 0, 0, 0, 0, 0)
+		d = append(d, md.XMP...)
+		writePNGChunk(buf, "iTXt", d)
+	}
+	for _, c := range chunks[1:] {
+		if !isPNGMetadata(c, md) {
+			buf.Write(c.raw)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte(typ))
+	_, _ = crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	_ = binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
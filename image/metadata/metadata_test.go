@@ -0,0 +1,229 @@
+package metadata
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestReadWrite(t *testing.T) {
+	for _, format := range []string{"jpeg", "png"} {
+		t.Run(format, func(t *testing.T) {
+			for _, tc := range []struct {
+				name string
+				md   *Metadata
+			}{
+				{
+					name: "Empty",
+					md:   &Metadata{},
+				},
+				{
+					name: "All",
+					md: &Metadata{
+						ICC:  []byte("icc"),
+						EXIF: []byte("MM\x00*exif"),
+						XMP:  []byte("<x:xmpmeta/>"),
+					},
+				},
+				{
+					name: "ICC",
+					md: &Metadata{
+						ICC: []byte("icc"),
+					},
+				},
+				{
+					name: "LargeICC",
+					md: &Metadata{
+						ICC: bytes.Repeat([]byte("0123456789"), 20000),
+					},
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					data := testEncode(t, format)
+					data, err := Write(format, data, tc.md)
+					if err != nil {
+						t.Fatal(err)
+					}
+					testDecode(t, format, data)
+					md, err := Read(format, data)
+					if err != nil {
+						t.Fatal(err)
+					}
+					testCompareMetadata(t, md, tc.md)
+				})
+			}
+		})
+	}
+}
+
+func TestWriteReplace(t *testing.T) {
+	for _, format := range []string{"jpeg", "png"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := Write(format, testEncode(t, format), &Metadata{
+				ICC:  []byte("icc"),
+				EXIF: []byte("MM\x00*exif"),
+				XMP:  []byte("<x:xmpmeta/>"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &Metadata{ICC: []byte("other icc")}
+			data, err = Write(format, data, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testDecode(t, format, data)
+			md, err := Read(format, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testCompareMetadata(t, md, expected)
+		})
+	}
+}
+
+func TestReadTestdata(t *testing.T) {
+	md, err := Read("jpeg", testdata.Medium.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.EXIF == nil {
+		t.Fatal("no EXIF")
+	}
+	data, err := Write("jpeg", testdata.Medium.Data, &Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDecode(t, "jpeg", data)
+	md, err = Read("jpeg", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.Empty() {
+		t.Fatalf("not empty: %#v", md)
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	md, err := Read("gif", testdata.Animated.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.Empty() {
+		t.Fatal("not empty")
+	}
+	if Supported("gif") {
+		t.Fatal("gif is supported")
+	}
+}
+
+func TestWriteErrorUnsupported(t *testing.T) {
+	_, err := Write("gif", testdata.Animated.Data, &Metadata{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestReadWriteErrorInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		format string
+		data   []byte
+	}{
+		{
+			name:   "JPEGSignature",
+			format: "jpeg",
+			data:   []byte("foobar"),
+		},
+		{
+			name:   "JPEGTruncated",
+			format: "jpeg",
+			data:   testdata.Medium.Data[:100],
+		},
+		{
+			name:   "PNGSignature",
+			format: "png",
+			data:   []byte("foobar"),
+		},
+		{
+			name:   "PNGTruncated",
+			format: "png",
+			data:   testdata.Random.Data[:100],
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Read(tc.format, tc.data)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			_, err = Write(tc.format, tc.data, &Metadata{})
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestReadErrorPNGICC(t *testing.T) {
+	buf := new(bytes.Buffer)
+	data := testEncode(t, "png")
+	chunks, err := parsePNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(pngSignature)
+	buf.Write(chunks[0].raw)
+	writePNGChunk(buf, "iCCP", []byte("name\x00\x00invalid"))
+	for _, c := range chunks[1:] {
+		buf.Write(c.raw)
+	}
+	_, err = Read("png", buf.Bytes())
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func testEncode(tb testing.TB, format string) []byte {
+	tb.Helper()
+	nim := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	buf := new(bytes.Buffer)
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(buf, nim, nil)
+	case "png":
+		err = png.Encode(buf, nim)
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testDecode(tb testing.TB, format string, data []byte) {
+	tb.Helper()
+	_, f, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if f != format {
+		tb.Fatalf("unexpected format: got %s, want %s", f, format)
+	}
+}
+
+func testCompareMetadata(tb testing.TB, md, expected *Metadata) {
+	tb.Helper()
+	if !bytes.Equal(md.ICC, expected.ICC) {
+		tb.Fatalf("unexpected ICC: got %d bytes, want %d bytes", len(md.ICC), len(expected.ICC))
+	}
+	if !bytes.Equal(md.EXIF, expected.EXIF) {
+		tb.Fatalf("unexpected EXIF: got %q, want %q", md.EXIF, expected.EXIF)
+	}
+	if !bytes.Equal(md.XMP, expected.XMP) {
+		tb.Fatalf("unexpected XMP: got %q, want %q", md.XMP, expected.XMP)
+	}
+}
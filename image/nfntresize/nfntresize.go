@@ -7,6 +7,7 @@ import (
 
 	"github.com/nfnt/resize"
 	"github.com/pierrre/imageserver"
+	imageserver_image_internal "github.com/pierrre/imageserver/image/internal"
 )
 
 const (
@@ -18,10 +19,15 @@ const (
 // All params are extracted from the "graphicsmagick" node param and are optionals:
 //  - width
 //  - height
+//  - dpr: device pixel ratio (1 to 4), the width and height are multiplied by it, and limited to MaxWidth and MaxHeight (keeping the aspect ratio)
 //  - mode: resize mode
 //      possible values:
 //      - resize (default): see github.com/nfnt/resize.Resize
 //      - thumbnail: see github.com/nfnt/resize.Thumbnail
+//      - fill: crops the Image to the aspect ratio (around the focal point), then resizes it to the exact size
+//  - focus_x, focus_y: focal point for the "fill" mode, as fractions of the width and height (0 to 1)
+//      The cropped area is centered on the focal point, and kept inside the Image.
+//      The default value is 0.5 (center).
 //  - interpolation: interpolation method
 //      possible values:
 //      - nearest_neighbor (default)
@@ -74,10 +80,31 @@ func (prc *Processor) process(nim image.Image, params imageserver.Params) (image
 	if err != nil {
 		return nil, err
 	}
+	if mode == nil {
+		return fill(width, height, nim, interp, params)
+	}
 	nim = mode(width, height, nim, interp)
 	return nim, nil
 }
 
+// fill crops the Image around the focal point, then resizes it.
+func fill(width, height uint, nim image.Image, interp resize.InterpolationFunction, params imageserver.Params) (image.Image, error) {
+	if width == 0 || height == 0 {
+		return resize.Resize(width, height, nim, interp), nil
+	}
+	fx, err := imageserver_image_internal.GetFocus("focus_x", params)
+	if err != nil {
+		return nil, err
+	}
+	fy, err := imageserver_image_internal.GetFocus("focus_y", params)
+	if err != nil {
+		return nil, err
+	}
+	r := imageserver_image_internal.FocusRectangle(nim.Bounds(), int(width), int(height), fx, fy)
+	nim = imageserver_image_internal.Crop(nim, r)
+	return resize.Resize(width, height, nim, interp), nil
+}
+
 func (prc *Processor) getSize(params imageserver.Params) (uint, uint, error) {
 	w, err := getDimension("width", prc.MaxWidth, params)
 	if err != nil {
@@ -87,7 +114,12 @@ func (prc *Processor) getSize(params imageserver.Params) (uint, uint, error) {
 	if err != nil {
 		return 0, 0, err
 	}
-	return w, h, nil
+	dpr, err := imageserver_image_internal.GetDPR(params)
+	if err != nil {
+		return 0, 0, err
+	}
+	sw, sh := imageserver_image_internal.ScaleSize(int(w), int(h), dpr, prc.MaxWidth, prc.MaxHeight)
+	return uint(sw), uint(sh), nil
 }
 
 func getDimension(name string, max int, params imageserver.Params) (uint, error) {
@@ -135,6 +167,7 @@ func (prc *Processor) getInterpolation(params imageserver.Params) (resize.Interp
 
 type modeFunc func(uint, uint, image.Image, resize.InterpolationFunction) image.Image
 
+// getModeFunc returns the modeFunc, or nil for the "fill" mode.
 func getModeFunc(params imageserver.Params) (modeFunc, error) {
 	if !params.Has("mode") {
 		return resize.Resize, nil
@@ -148,6 +181,8 @@ func getModeFunc(params imageserver.Params) (modeFunc, error) {
 		return resize.Resize, nil
 	case "thumbnail":
 		return resize.Thumbnail, nil
+	case "fill":
+		return nil, nil
 	default:
 		return nil, &imageserver.ParamError{Param: "mode", Message: "invalid value"}
 	}
@@ -71,6 +71,48 @@ func TestProcessor(t *testing.T) {
 			expectedWidth:  100,
 			expectedHeight: 100,
 		},
+		// dpr
+		{
+			name: "DPR",
+			params: imageserver.Params{param: imageserver.Params{
+				"width":  100,
+				"height": 50,
+				"dpr":    2.0,
+			}},
+			expectedWidth:  200,
+			expectedHeight: 100,
+		},
+		{
+			name:      "DPRMax",
+			processor: &Processor{MaxWidth: 150},
+			params: imageserver.Params{param: imageserver.Params{
+				"width": 100,
+				"dpr":   2.0,
+			}},
+			expectedWidth: 150,
+		},
+		{
+			name:      "DPRMaxAspectRatio",
+			processor: &Processor{MaxWidth: 2000},
+			params: imageserver.Params{param: imageserver.Params{
+				"width":  800,
+				"height": 400,
+				"dpr":    3.0,
+			}},
+			expectedWidth:  2000,
+			expectedHeight: 1000,
+		},
+		{
+			name:      "DPRMaxHeight",
+			processor: &Processor{MaxHeight: 120},
+			params: imageserver.Params{param: imageserver.Params{
+				"width":  100,
+				"height": 50,
+				"dpr":    4.0,
+			}},
+			expectedWidth:  240,
+			expectedHeight: 120,
+		},
 		// mode
 		{
 			name: "ModeResize",
@@ -92,6 +134,37 @@ func TestProcessor(t *testing.T) {
 			expectedWidth:  100,
 			expectedHeight: 79,
 		},
+		{
+			name: "ModeFill",
+			params: imageserver.Params{param: imageserver.Params{
+				"width":  100,
+				"height": 100,
+				"mode":   "fill",
+			}},
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name: "ModeFillFocus",
+			params: imageserver.Params{param: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_x": 0.1,
+				"focus_y": 0.9,
+			}},
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name: "ModeFillWidth",
+			params: imageserver.Params{param: imageserver.Params{
+				"width": 100,
+				"mode":  "fill",
+			}},
+			expectedWidth:  100,
+			expectedHeight: 80,
+		},
 		// interpolation
 		{
 			name: "InterpolationNearestNeighbor",
@@ -142,6 +215,22 @@ func TestProcessor(t *testing.T) {
 			expectedWidth: 100,
 		},
 		// error
+		{
+			name: "DPRInvalidType",
+			params: imageserver.Params{param: imageserver.Params{
+				"width": 100,
+				"dpr":   "invalid",
+			}},
+			expectedParamError: param + ".dpr",
+		},
+		{
+			name: "DPRInvalidRange",
+			params: imageserver.Params{param: imageserver.Params{
+				"width": 100,
+				"dpr":   0.5,
+			}},
+			expectedParamError: param + ".dpr",
+		},
 		{
 			name:               "ParamInvalid",
 			params:             imageserver.Params{param: "invalid"},
@@ -191,6 +280,26 @@ func TestProcessor(t *testing.T) {
 			}},
 			expectedParamError: param + ".height",
 		},
+		{
+			name: "FocusInvalidType",
+			params: imageserver.Params{param: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_x": "invalid",
+			}},
+			expectedParamError: param + ".focus_x",
+		},
+		{
+			name: "FocusInvalidRange",
+			params: imageserver.Params{param: imageserver.Params{
+				"width":   100,
+				"height":  100,
+				"mode":    "fill",
+				"focus_y": -0.5,
+			}},
+			expectedParamError: param + ".focus_y",
+		},
 		{
 			name: "InterpolationInvalidType",
 			params: imageserver.Params{param: imageserver.Params{
@@ -0,0 +1,181 @@
+// Package ops provides a imageserver/image.Processor implementation that applies an ordered list of operations.
+package ops
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+const param = "ops"
+
+// DefaultMaxSteps is the default value for Processor.MaxSteps.
+const DefaultMaxSteps = 10
+
+// Processor is a imageserver/image.Processor implementation that applies an ordered list of operations.
+//
+// The steps are extracted from the "ops" node param, with the keys "0", "1", "2", ... (in this order).
+// Each step is a Params:
+//   - op: operation name (key in Processors)
+//   - params: Params given to the Processor
+//
+// Example, with the Processors "crop" (imageserver/image/crop.Processor) and "rotate" (imageserver/image/gift.RotateProcessor):
+//
+//	imageserver.Params{"ops": imageserver.Params{
+//		"0": imageserver.Params{"op": "rotate", "params": imageserver.Params{"gift_rotate": imageserver.Params{"rotation": 90.0}}},
+//		"1": imageserver.Params{"op": "crop", "params": imageserver.Params{"crop": imageserver.Params{"min_x": 0, "min_y": 0, "max_x": 100, "max_y": 100}}},
+//	}}
+//
+// The Image size is checked after each step.
+// If the Processor of a step implements imageserver/image.BoundsProcessor (e.g. crop and resize), the planned size is also checked before the step,
+// so a too large Image is never allocated.
+// The other Processors should have their own limits (e.g. imageserver/image/gift.ResizeProcessor.MaxWidth).
+type Processor struct {
+	// Processors are the available operations, by name.
+	Processors map[string]imageserver_image.Processor
+
+	// MaxSteps is the maximum number of steps (DefaultMaxSteps if 0).
+	MaxSteps int
+
+	// MaxWidth and MaxHeight are the optional maximum sizes of the intermediate Images.
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Process implements imageserver/image.Processor.
+func (prc *Processor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	if !params.Has(param) {
+		return nim, nil
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return nil, err
+	}
+	maxSteps := prc.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	if params.Len() > maxSteps {
+		return nil, &imageserver.ParamError{Param: param, Message: fmt.Sprintf("must contain at most %d steps", maxSteps)}
+	}
+	nim, err = prc.process(nim, params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = param + "." + err.Param
+		}
+		return nil, err
+	}
+	return nim, nil
+}
+
+func (prc *Processor) process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	for i := range params.Len() {
+		key := strconv.Itoa(i)
+		step, err := params.GetParams(key)
+		if err != nil {
+			return nil, err
+		}
+		nim, err = prc.processStep(nim, step)
+		if err != nil {
+			if err, ok := err.(*imageserver.ParamError); ok {
+				err.Param = prefixParam(key, err.Param)
+			}
+			return nil, err
+		}
+	}
+	return nim, nil
+}
+
+func (prc *Processor) processStep(nim image.Image, step imageserver.Params) (image.Image, error) {
+	p, stepPrc, err := prc.getStep(step)
+	if err != nil {
+		return nil, err
+	}
+	if stepPrc, ok := stepPrc.(imageserver_image.BoundsProcessor); ok {
+		bds, err := stepPrc.Bounds(nim.Bounds(), p)
+		if err != nil {
+			if err, ok := err.(*imageserver.ParamError); ok {
+				err.Param = "params." + err.Param
+			}
+			return nil, err
+		}
+		err = prc.checkSize("planned", bds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nim, err = stepPrc.Process(nim, p)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = "params." + err.Param
+		}
+		return nil, err
+	}
+	err = prc.checkSize("intermediate", nim.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	return nim, nil
+}
+
+// checkSize returns a *imageserver.ParamError (for the step) if the bounds exceed the maximum size.
+func (prc *Processor) checkSize(name string, bds image.Rectangle) error {
+	if (prc.MaxWidth > 0 && bds.Dx() > prc.MaxWidth) || (prc.MaxHeight > 0 && bds.Dy() > prc.MaxHeight) {
+		return &imageserver.ParamError{Message: fmt.Sprintf("%s image size %dx%d exceeds the maximum size %dx%d", name, bds.Dx(), bds.Dy(), prc.MaxWidth, prc.MaxHeight)}
+	}
+	return nil
+}
+
+func prefixParam(prefix, p string) string {
+	if p == "" {
+		return prefix
+	}
+	return prefix + "." + p
+}
+
+func (prc *Processor) getStep(step imageserver.Params) (imageserver.Params, imageserver_image.Processor, error) {
+	op, err := step.GetString("op")
+	if err != nil {
+		return nil, nil, err
+	}
+	stepPrc, ok := prc.Processors[op]
+	if !ok {
+		return nil, nil, &imageserver.ParamError{Param: "op", Message: "invalid value"}
+	}
+	p := imageserver.Params{}
+	if step.Has("params") {
+		p, err = step.GetParams("params")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return p, stepPrc, nil
+}
+
+// Change implements imageserver/image.Processor.
+func (prc *Processor) Change(params imageserver.Params) bool {
+	if !params.Has(param) {
+		return false
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return true
+	}
+	for i := range params.Len() {
+		step, err := params.GetParams(strconv.Itoa(i))
+		if err != nil {
+			return true
+		}
+		p, stepPrc, err := prc.getStep(step)
+		if err != nil {
+			return true
+		}
+		if stepPrc.Change(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package ops
+
+import (
+	"image"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	imageserver_image_crop "github.com/pierrre/imageserver/image/crop"
+	imageserver_image_gift "github.com/pierrre/imageserver/image/gift"
+)
+
+var _ imageserver_image.Processor = &Processor{}
+
+func newTestProcessor() *Processor {
+	return &Processor{
+		Processors: map[string]imageserver_image.Processor{
+			"crop":   &imageserver_image_crop.Processor{},
+			"rotate": &imageserver_image_gift.RotateProcessor{},
+			"resize": &imageserver_image_gift.ResizeProcessor{},
+		},
+		MaxWidth:  300,
+		MaxHeight: 300,
+	}
+}
+
+func newCropStep(minX, minY, maxX, maxY int) imageserver.Params {
+	return imageserver.Params{"op": "crop", "params": imageserver.Params{"crop": imageserver.Params{
+		"min_x": minX,
+		"min_y": minY,
+		"max_x": maxX,
+		"max_y": maxY,
+	}}}
+}
+
+func newRotateStep(rotation float64) imageserver.Params {
+	return imageserver.Params{"op": "rotate", "params": imageserver.Params{"gift_rotate": imageserver.Params{
+		"rotation": rotation,
+	}}}
+}
+
+func newResizeStep(width, height int) imageserver.Params {
+	return imageserver.Params{"op": "resize", "params": imageserver.Params{"gift_resize": imageserver.Params{
+		"width":  width,
+		"height": height,
+	}}}
+}
+
+func TestProcess(t *testing.T) {
+	prc := newTestProcessor()
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expectedBounds     image.Rectangle
+		expectedParamError string
+	}{
+		{
+			name:           "Empty",
+			params:         imageserver.Params{},
+			expectedBounds: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name:           "EmptySteps",
+			params:         imageserver.Params{param: imageserver.Params{}},
+			expectedBounds: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name: "RotateCrop",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newRotateStep(90),
+				"1": newCropStep(0, 0, 100, 150),
+			}},
+			expectedBounds: image.Rect(0, 0, 100, 150),
+		},
+		{
+			name: "CropRotate",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newCropStep(0, 0, 100, 50),
+				"1": newRotateStep(90),
+			}},
+			expectedBounds: image.Rect(0, 0, 50, 100),
+		},
+		{
+			name: "CropRotateResize",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newCropStep(0, 0, 100, 50),
+				"1": newRotateStep(90),
+				"2": newResizeStep(25, 0),
+			}},
+			expectedBounds: image.Rect(0, 0, 25, 50),
+		},
+		{
+			name: "NoParams",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "crop"},
+			}},
+			expectedBounds: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name:               "ErrorParam",
+			params:             imageserver.Params{param: "invalid"},
+			expectedParamError: param,
+		},
+		{
+			name: "ErrorMaxSteps",
+			params: imageserver.Params{param: imageserver.Params{
+				"0":  newRotateStep(90),
+				"1":  newRotateStep(90),
+				"2":  newRotateStep(90),
+				"3":  newRotateStep(90),
+				"4":  newRotateStep(90),
+				"5":  newRotateStep(90),
+				"6":  newRotateStep(90),
+				"7":  newRotateStep(90),
+				"8":  newRotateStep(90),
+				"9":  newRotateStep(90),
+				"10": newRotateStep(90),
+			}},
+			expectedParamError: param,
+		},
+		{
+			name: "ErrorStepMissing",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newRotateStep(90),
+				"2": newRotateStep(90),
+			}},
+			expectedParamError: param + ".1",
+		},
+		{
+			name: "ErrorStepInvalid",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": "invalid",
+			}},
+			expectedParamError: param + ".0",
+		},
+		{
+			name: "ErrorOpMissing",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{},
+			}},
+			expectedParamError: param + ".0.op",
+		},
+		{
+			name: "ErrorOpUnknown",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "unknown"},
+			}},
+			expectedParamError: param + ".0.op",
+		},
+		{
+			name: "ErrorParamsInvalid",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "crop", "params": "invalid"},
+			}},
+			expectedParamError: param + ".0.params",
+		},
+		{
+			name: "ErrorStepParams",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newRotateStep(90),
+				"1": imageserver.Params{"op": "crop", "params": imageserver.Params{"crop": imageserver.Params{}}},
+			}},
+			expectedParamError: param + ".1.params.crop.min_x",
+		},
+		{
+			name: "ErrorPlannedSize",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newResizeStep(100000, 100000),
+			}},
+			expectedParamError: param + ".0",
+		},
+		{
+			name: "ErrorPlannedSizeCrop",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newResizeStep(300, 0),
+				"1": newCropStep(0, 0, 300, 150),
+				"2": newRotateStep(90),
+				"3": newResizeStep(0, 400),
+			}},
+			expectedParamError: param + ".3",
+		},
+		{
+			name: "ErrorPlannedSizeParam",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "resize", "params": imageserver.Params{"gift_resize": imageserver.Params{"width": -1}}},
+			}},
+			expectedParamError: param + ".0.params.gift_resize.width",
+		},
+		{
+			name: "ErrorIntermediateSize",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newResizeStep(400, 0),
+				"1": newResizeStep(100, 0),
+			}},
+			expectedParamError: param + ".0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nim := image.NewRGBA(image.Rect(0, 0, 200, 100))
+			out, err := prc.Process(nim, tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if out.Bounds() != tc.expectedBounds {
+				t.Fatalf("unexpected bounds: got %s, want %s", out.Bounds(), tc.expectedBounds)
+			}
+		})
+	}
+}
+
+func TestChange(t *testing.T) {
+	prc := newTestProcessor()
+	for _, tc := range []struct {
+		name     string
+		params   imageserver.Params
+		expected bool
+	}{
+		{
+			name:     "Empty",
+			params:   imageserver.Params{},
+			expected: false,
+		},
+		{
+			name:     "ParamInvalid",
+			params:   imageserver.Params{param: "invalid"},
+			expected: true,
+		},
+		{
+			name:     "ParamEmpty",
+			params:   imageserver.Params{param: imageserver.Params{}},
+			expected: false,
+		},
+		{
+			name: "Step",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": newRotateStep(90),
+			}},
+			expected: true,
+		},
+		{
+			name: "StepNoChange",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "rotate"},
+			}},
+			expected: false,
+		},
+		{
+			name: "StepInvalid",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": "invalid",
+			}},
+			expected: true,
+		},
+		{
+			name: "OpUnknown",
+			params: imageserver.Params{param: imageserver.Params{
+				"0": imageserver.Params{"op": "unknown"},
+			}},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := prc.Change(tc.params)
+			if result != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestProcessPlannedSizeNotProcessed(t *testing.T) {
+	prc := &Processor{
+		Processors: map[string]imageserver_image.Processor{
+			"test": &testBoundsProcessor{
+				Processor: imageserver_image.ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+					t.Fatal("processed")
+					return nim, nil
+				}),
+				bounds: image.Rect(0, 0, 100000, 100000),
+			},
+		},
+		MaxWidth:  300,
+		MaxHeight: 300,
+	}
+	_, err := prc.Process(image.NewRGBA(image.Rect(0, 0, 200, 100)), imageserver.Params{param: imageserver.Params{
+		"0": imageserver.Params{"op": "test"},
+	}})
+	if err, ok := err.(*imageserver.ParamError); !ok || err.Param != param+".0" {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ParamError{})
+	}
+}
+
+type testBoundsProcessor struct {
+	imageserver_image.Processor
+	bounds image.Rectangle
+}
+
+func (prc *testBoundsProcessor) Bounds(bds image.Rectangle, params imageserver.Params) (image.Rectangle, error) {
+	return prc.bounds, nil
+}
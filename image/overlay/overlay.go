@@ -0,0 +1,382 @@
+// Package overlay provides a imageserver/image.Processor implementation that composites an overlay Image (e.g. watermark) onto the Image.
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"github.com/disintegration/gift"
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	imageserver_source "github.com/pierrre/imageserver/source"
+	"github.com/pierrre/lrucache"
+)
+
+const param = "overlay"
+
+// Gravity values.
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "north_east"
+	GravityNorthWest = "north_west"
+	GravitySouthEast = "south_east"
+	GravitySouthWest = "south_west"
+)
+
+// DefaultCacheSize is the default value for Processor.CacheSize.
+const DefaultCacheSize = 64 << 20
+
+// DefaultMinOverlaySize is the default value for Processor.MinOverlaySize.
+const DefaultMinOverlaySize = 16
+
+// DefaultMaxTiles is the default value for Processor.MaxTiles.
+const DefaultMaxTiles = 10000
+
+// Processor is a imageserver/image.Processor implementation that composites an overlay Image onto the Image.
+//
+// The overlay Image is loaded by the Server with the "source" param (with the context of the request), then decoded and cached.
+// It must be in a format supported by imageserver/image.Decode, and is checked against Limits before it is decoded.
+//
+// All params are extracted from the "overlay" node param and are optionals:
+//   - source: overlay source, DefaultSource by default
+//   - gravity: position (center, north, south, east, west, north_east, north_west, south_east, south_west), DefaultGravity by default
+//   - margin: margin in pixels from the edges (or between the tiles), DefaultMargin by default
+//   - opacity: opacity (0 to 1), DefaultOpacity by default
+//   - scale: overlay width relative to the Image width (0 to 1, 0 keeps the original size), DefaultScale by default
+//   - tile: repeats the overlay on the whole Image (gravity is ignored), DefaultTile by default
+//
+// If DefaultSource is set, the overlay is applied even if there is no "overlay" param.
+// The overlay is applied only if the Image size is greater than or equal to MinWidth and MinHeight.
+//
+// The scaled overlay must not be smaller than MinOverlaySize, and the number of tiles must not exceed MaxTiles,
+// otherwise a *imageserver.ParamError is returned.
+// It prevents a request from drawing a tiny overlay for each pixel of a large Image.
+//
+// It implements imageserver/image.ContextProcessor.
+type Processor struct {
+	// Server loads the overlay Image.
+	// The "source" param may be controlled by the request, so it should only give access to the overlay Images.
+	Server imageserver.Server
+
+	DefaultSource  string
+	DefaultGravity string  // Optional, "south_east" if empty.
+	DefaultMargin  int     // Optional.
+	DefaultOpacity float64 // Optional, 1 if 0.
+	DefaultScale   float64 // Optional.
+	DefaultTile    bool    // Optional.
+
+	// MinWidth and MinHeight are optional minimum Image sizes.
+	MinWidth  int
+	MinHeight int
+
+	// MinOverlaySize is the minimum width and height (in pixels) of a scaled overlay Image (DefaultMinOverlaySize if 0).
+	MinOverlaySize int
+
+	// MaxTiles is the maximum number of tiles (DefaultMaxTiles if 0).
+	MaxTiles int
+
+	// Limits are checked before the overlay Image is decoded (imageserver/image.DefaultLimits if nil).
+	Limits *imageserver_image.Limits
+
+	// CacheSize is the maximum size (in bytes) of the decoded overlay Images in the cache (DefaultCacheSize if 0).
+	// The size of a decoded Image is 4 bytes per pixel.
+	// The cached overlay Images are never reloaded.
+	CacheSize int
+
+	cacheOnce sync.Once
+	cache     *lrucache.LRUCache
+}
+
+type cacheItem struct {
+	image image.Image
+}
+
+// Size implements github.com/pierrre/lrucache.Value.
+func (item *cacheItem) Size() int {
+	bds := item.image.Bounds()
+	return bds.Dx() * bds.Dy() * 4
+}
+
+// Process implements imageserver/image.Processor.
+func (prc *Processor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return prc.ProcessContext(context.Background(), nim, nil, params)
+}
+
+// ProcessContext implements imageserver/image.ContextProcessor.
+//
+// The context is used to load the overlay Image.
+func (prc *Processor) ProcessContext(ctx context.Context, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	if !params.Has(param) && prc.DefaultSource == "" {
+		return nim, nil
+	}
+	p := imageserver.Params{}
+	if params.Has(param) {
+		var err error
+		p, err = params.GetParams(param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nim, err := prc.process(ctx, nim, p)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = param + "." + err.Param
+		}
+		return nil, err
+	}
+	return nim, nil
+}
+
+func (prc *Processor) process(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
+	opts, err := prc.getOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	bds := nim.Bounds()
+	if bds.Dx() < prc.MinWidth || bds.Dy() < prc.MinHeight {
+		return nim, nil
+	}
+	ov, err := prc.getOverlay(ctx, opts.source)
+	if err != nil {
+		return nil, err
+	}
+	g := scaleFilter(ov, bds, opts.scale)
+	size := ov.Bounds().Size()
+	if g != nil {
+		size = g.Bounds(ov.Bounds()).Size()
+		err = prc.checkOverlaySize(size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.tile {
+		err = prc.checkTiles(bds, size, opts.margin)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if g != nil {
+		out := image.NewRGBA(g.Bounds(ov.Bounds()))
+		g.Draw(out, ov)
+		ov = out
+	}
+	out := image.NewRGBA(bds)
+	draw.Draw(out, bds, nim, bds.Min, draw.Src)
+	var mask image.Image
+	if opts.opacity < 1 {
+		mask = image.NewUniform(color.Alpha16{A: uint16(math.Round(opts.opacity * 0xffff))})
+	}
+	for _, pt := range positions(bds, ov.Bounds().Size(), opts) {
+		r := image.Rectangle{Min: pt, Max: pt.Add(ov.Bounds().Size())}
+		draw.DrawMask(out, r, ov, ov.Bounds().Min, mask, image.Point{}, draw.Over)
+	}
+	return out, nil
+}
+
+type options struct {
+	source  string
+	gravity string
+	margin  int
+	opacity float64
+	scale   float64
+	tile    bool
+}
+
+// nolint: gocyclo
+func (prc *Processor) getOptions(params imageserver.Params) (*options, error) {
+	opts := &options{
+		source:  prc.DefaultSource,
+		gravity: prc.DefaultGravity,
+		margin:  prc.DefaultMargin,
+		opacity: prc.DefaultOpacity,
+		scale:   prc.DefaultScale,
+		tile:    prc.DefaultTile,
+	}
+	if opts.gravity == "" {
+		opts.gravity = GravitySouthEast
+	}
+	if opts.opacity == 0 {
+		opts.opacity = 1
+	}
+	var err error
+	if params.Has(imageserver_source.Param) {
+		opts.source, err = params.GetString(imageserver_source.Param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.source == "" {
+		return nil, &imageserver.ParamError{Param: imageserver_source.Param, Message: "missing"}
+	}
+	if params.Has("gravity") {
+		opts.gravity, err = params.GetString("gravity")
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch opts.gravity {
+	case GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityNorthEast, GravityNorthWest, GravitySouthEast, GravitySouthWest:
+	default:
+		return nil, &imageserver.ParamError{Param: "gravity", Message: "invalid value"}
+	}
+	if params.Has("margin") {
+		opts.margin, err = params.GetInt("margin")
+		if err != nil {
+			return nil, err
+		}
+		if opts.margin < 0 {
+			return nil, &imageserver.ParamError{Param: "margin", Message: "must be greater than or equal to 0"}
+		}
+	}
+	if params.Has("opacity") {
+		opts.opacity, err = params.GetFloat("opacity")
+		if err != nil {
+			return nil, err
+		}
+		if !(opts.opacity >= 0 && opts.opacity <= 1) {
+			return nil, &imageserver.ParamError{Param: "opacity", Message: "must be between 0 and 1"}
+		}
+	}
+	if params.Has("scale") {
+		opts.scale, err = params.GetFloat("scale")
+		if err != nil {
+			return nil, err
+		}
+		if !(opts.scale >= 0 && opts.scale <= 1) {
+			return nil, &imageserver.ParamError{Param: "scale", Message: "must be between 0 and 1"}
+		}
+	}
+	if params.Has("tile") {
+		opts.tile, err = params.GetBool("tile")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func (prc *Processor) checkOverlaySize(size image.Point) error {
+	minSize := prc.MinOverlaySize
+	if minSize <= 0 {
+		minSize = DefaultMinOverlaySize
+	}
+	if size.X < minSize || size.Y < minSize {
+		return &imageserver.ParamError{Param: "scale", Message: fmt.Sprintf("scaled overlay size %dx%d is smaller than the minimum size %d", size.X, size.Y, minSize)}
+	}
+	return nil
+}
+
+func (prc *Processor) checkTiles(bds image.Rectangle, size image.Point, margin int) error {
+	maxTiles := prc.MaxTiles
+	if maxTiles <= 0 {
+		maxTiles = DefaultMaxTiles
+	}
+	n := tileCount(bds.Dx(), size.X, margin) * tileCount(bds.Dy(), size.Y, margin)
+	if n > int64(maxTiles) {
+		return &imageserver.ParamError{Param: "tile", Message: fmt.Sprintf("tile count %d exceeds the maximum %d", n, maxTiles)}
+	}
+	return nil
+}
+
+// tileCount returns the number of tiles in one dimension (see positions).
+func tileCount(length, size, margin int) int64 {
+	step := size + margin
+	if step <= 0 || length <= margin {
+		return 0
+	}
+	return int64((length - margin + step - 1) / step)
+}
+
+// getOverlay returns the decoded overlay Image, from the cache or the Server.
+func (prc *Processor) getOverlay(ctx context.Context, source string) (image.Image, error) {
+	prc.cacheOnce.Do(func() {
+		size := prc.CacheSize
+		if size <= 0 {
+			size = DefaultCacheSize
+		}
+		prc.cache = lrucache.NewLRUCache(int64(size))
+	})
+	if v, ok := prc.cache.Get(source); ok {
+		return v.(*cacheItem).image, nil
+	}
+	im, err := imageserver.GetContext(ctx, prc.Server, imageserver.Params{imageserver_source.Param: source})
+	if err != nil {
+		return nil, err
+	}
+	ov, err := imageserver_image.DecodeLimits(im, prc.getLimits())
+	if err != nil {
+		return nil, err
+	}
+	prc.cache.Set(source, &cacheItem{image: ov})
+	return ov, nil
+}
+
+func (prc *Processor) getLimits() imageserver_image.Limits {
+	if prc.Limits != nil {
+		return *prc.Limits
+	}
+	return imageserver_image.DefaultLimits
+}
+
+// scaleFilter returns the filter that resizes the overlay Image relatively to the Image bounds.
+//
+// It returns nil if the overlay Image is not resized.
+func scaleFilter(ov image.Image, bds image.Rectangle, s float64) *gift.GIFT {
+	if s == 0 {
+		return nil
+	}
+	w := max(int(math.Round(float64(bds.Dx())*s)), 1)
+	if w == ov.Bounds().Dx() {
+		return nil
+	}
+	return gift.New(gift.Resize(w, 0, gift.LanczosResampling))
+}
+
+// positions returns the top-left positions of the overlay Image.
+func positions(bds image.Rectangle, size image.Point, opts *options) []image.Point {
+	m := opts.margin
+	if opts.tile {
+		var pts []image.Point
+		stepX, stepY := size.X+m, size.Y+m
+		if stepX <= 0 || stepY <= 0 {
+			return nil
+		}
+		for y := bds.Min.Y + m; y < bds.Max.Y; y += stepY {
+			for x := bds.Min.X + m; x < bds.Max.X; x += stepX {
+				pts = append(pts, image.Pt(x, y))
+			}
+		}
+		return pts
+	}
+	x := bds.Min.X + (bds.Dx()-size.X)/2
+	y := bds.Min.Y + (bds.Dy()-size.Y)/2
+	switch opts.gravity {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		y = bds.Min.Y + m
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		y = bds.Max.Y - size.Y - m
+	}
+	switch opts.gravity {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		x = bds.Min.X + m
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		x = bds.Max.X - size.X - m
+	}
+	return []image.Point{image.Pt(x, y)}
+}
+
+// Change implements imageserver/image.Processor.
+//
+// It returns true if the overlay is enabled, because the Image size is unknown.
+func (prc *Processor) Change(params imageserver.Params) bool {
+	return params.Has(param) || prc.DefaultSource != ""
+}
@@ -0,0 +1,425 @@
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	imageserver_source "github.com/pierrre/imageserver/source"
+)
+
+var _ imageserver_image.Processor = &Processor{}
+
+var (
+	testBaseColor    = color.RGBA{R: 0xff, A: 0xff}
+	testOverlayColor = color.RGBA{B: 0xff, A: 0xff}
+)
+
+func newTestBase(w, h int) image.Image {
+	nim := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(nim, nim.Bounds(), image.NewUniform(testBaseColor), image.Point{}, draw.Src)
+	return nim
+}
+
+func newTestServer(t *testing.T, calls *int) imageserver.Server {
+	t.Helper()
+	nim := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(nim, nim.Bounds(), image.NewUniform(testOverlayColor), image.Point{}, draw.Src)
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, nim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+		if calls != nil {
+			*calls++
+		}
+		src, err := params.GetString(imageserver_source.Param)
+		if err != nil {
+			return nil, err
+		}
+		switch src {
+		case "logo", "logo2":
+			return &imageserver.Image{Format: "png", Data: buf.Bytes()}, nil
+		case "invalid":
+			return &imageserver.Image{Format: "png", Data: []byte("invalid")}, nil
+		}
+		return nil, &imageserver.ParamError{Param: imageserver_source.Param, Message: "not found"}
+	})
+}
+
+func TestProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		processor          *Processor
+		image              image.Image
+		params             imageserver.Params
+		expectedParamError string
+		expectedImageError bool
+		expectedOverlay    []image.Point
+		expectedBase       []image.Point
+	}{
+		{
+			name:         "Empty",
+			processor:    &Processor{},
+			image:        newTestBase(100, 100),
+			params:       imageserver.Params{},
+			expectedBase: []image.Point{{95, 95}},
+		},
+		{
+			name:            "Default",
+			processor:       &Processor{},
+			image:           newTestBase(100, 100),
+			params:          imageserver.Params{param: imageserver.Params{"source": "logo"}},
+			expectedOverlay: []image.Point{{90, 90}, {99, 99}},
+			expectedBase:    []image.Point{{89, 89}, {50, 50}},
+		},
+		{
+			name:            "DefaultSource",
+			processor:       &Processor{DefaultSource: "logo"},
+			image:           newTestBase(100, 100),
+			params:          imageserver.Params{},
+			expectedOverlay: []image.Point{{95, 95}},
+		},
+		{
+			name:      "Gravity",
+			processor: &Processor{},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source":  "logo",
+				"gravity": GravityNorthWest,
+				"margin":  5,
+			}},
+			expectedOverlay: []image.Point{{5, 5}, {14, 14}},
+			expectedBase:    []image.Point{{4, 4}, {15, 15}},
+		},
+		{
+			name:      "Center",
+			processor: &Processor{},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source":  "logo",
+				"gravity": GravityCenter,
+			}},
+			expectedOverlay: []image.Point{{45, 45}, {54, 54}},
+			expectedBase:    []image.Point{{44, 44}, {55, 55}},
+		},
+		{
+			name:      "Tile",
+			processor: &Processor{},
+			image:     newTestBase(30, 30),
+			params: imageserver.Params{param: imageserver.Params{
+				"source": "logo",
+				"tile":   true,
+				"margin": 5,
+			}},
+			expectedOverlay: []image.Point{{5, 5}, {20, 5}, {5, 20}, {20, 20}},
+			expectedBase:    []image.Point{{0, 0}, {17, 5}, {5, 17}},
+		},
+		{
+			name:      "Scale",
+			processor: &Processor{},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source": "logo",
+				"scale":  0.5,
+			}},
+			expectedOverlay: []image.Point{{50, 50}, {99, 99}},
+			expectedBase:    []image.Point{{49, 49}},
+		},
+		{
+			name:      "MinSize",
+			processor: &Processor{MinWidth: 400, MinHeight: 400},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source": "logo",
+			}},
+			expectedBase: []image.Point{{95, 95}},
+		},
+		{
+			name:               "ErrorParams",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: "invalid"},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorSourceMissing",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{}},
+			expectedParamError: param + ".source",
+		},
+		{
+			name:               "ErrorSourceNotFound",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "unknown"}},
+			expectedParamError: param + ".source",
+		},
+		{
+			name:               "ErrorSourceInvalid",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "invalid"}},
+			expectedImageError: true,
+		},
+		{
+			name:               "ErrorGravity",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "gravity": "invalid"}},
+			expectedParamError: param + ".gravity",
+		},
+		{
+			name:               "ErrorMargin",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "margin": -1}},
+			expectedParamError: param + ".margin",
+		},
+		{
+			name:               "ErrorOpacity",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "opacity": 2.0}},
+			expectedParamError: param + ".opacity",
+		},
+		{
+			name:               "ErrorScale",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "scale": -1.0}},
+			expectedParamError: param + ".scale",
+		},
+		{
+			name:               "ErrorScaleMinOverlaySize",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "scale": 0.05}},
+			expectedParamError: param + ".scale",
+		},
+		{
+			name:      "ScaleMinOverlaySize",
+			processor: &Processor{MinOverlaySize: 5},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source": "logo",
+				"scale":  0.05,
+			}},
+			expectedOverlay: []image.Point{{96, 96}, {98, 98}},
+			expectedBase:    []image.Point{{94, 94}},
+		},
+		{
+			name:               "ErrorTileMaxTiles",
+			processor:          &Processor{MaxTiles: 99},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "tile": true}},
+			expectedParamError: param + ".tile",
+		},
+		{
+			name:      "TileMaxTiles",
+			processor: &Processor{MaxTiles: 100},
+			image:     newTestBase(100, 100),
+			params: imageserver.Params{param: imageserver.Params{
+				"source": "logo",
+				"tile":   true,
+			}},
+			expectedOverlay: []image.Point{{0, 0}, {99, 99}},
+		},
+		{
+			name:               "ErrorLimits",
+			processor:          &Processor{Limits: &imageserver_image.Limits{MaxWidth: 5}},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo"}},
+			expectedImageError: true,
+		},
+		{
+			name:               "ErrorTile",
+			processor:          &Processor{},
+			image:              newTestBase(100, 100),
+			params:             imageserver.Params{param: imageserver.Params{"source": "logo", "tile": "invalid"}},
+			expectedParamError: param + ".tile",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.processor.Server = newTestServer(t, nil)
+			nim, err := tc.processor.Process(tc.image, tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				if _, ok := err.(*imageserver.ImageError); ok && tc.expectedImageError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if tc.expectedImageError {
+				t.Fatal("no error")
+			}
+			for _, pt := range tc.expectedOverlay {
+				if c := color.RGBAModel.Convert(nim.At(pt.X, pt.Y)); c != testOverlayColor {
+					t.Errorf("unexpected color at %s: got %v, want %v", pt, c, testOverlayColor)
+				}
+			}
+			for _, pt := range tc.expectedBase {
+				if c := color.RGBAModel.Convert(nim.At(pt.X, pt.Y)); c != testBaseColor {
+					t.Errorf("unexpected color at %s: got %v, want %v", pt, c, testBaseColor)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessOpacity(t *testing.T) {
+	prc := &Processor{
+		Server: newTestServer(t, nil),
+	}
+	nim, err := prc.Process(newTestBase(100, 100), imageserver.Params{param: imageserver.Params{
+		"source":  "logo",
+		"opacity": 0.5,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := color.RGBAModel.Convert(nim.At(95, 95)).(color.RGBA)
+	if c.R < 0x70 || c.R > 0x90 || c.B < 0x70 || c.B > 0x90 {
+		t.Fatalf("unexpected color: %v", c)
+	}
+}
+
+func TestProcessCache(t *testing.T) {
+	var calls int
+	prc := &Processor{
+		Server:        newTestServer(t, &calls),
+		DefaultSource: "logo",
+		CacheSize:     400,
+	}
+	for range 3 {
+		_, err := prc.Process(newTestBase(100, 100), imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("unexpected calls: got %d, want %d", calls, 1)
+	}
+	_, err := prc.Process(newTestBase(100, 100), imageserver.Params{param: imageserver.Params{"source": "unknown"}})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	// The failed load is not cached.
+	_, err = prc.getOverlay(t.Context(), "invalid")
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if prc.cache.Length() != 1 {
+		t.Fatalf("unexpected cache length: got %d, want %d", prc.cache.Length(), 1)
+	}
+	calls = 0
+	_, err = prc.Process(newTestBase(100, 100), imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Fatalf("unexpected calls: got %d, want %d", calls, 0)
+	}
+}
+
+func TestProcessCacheEviction(t *testing.T) {
+	var calls int
+	prc := &Processor{
+		Server:    newTestServer(t, &calls),
+		CacheSize: 400,
+	}
+	for _, src := range []string{"logo", "logo", "logo2", "logo"} {
+		_, err := prc.getOverlay(t.Context(), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("unexpected calls: got %d, want %d", calls, 3)
+	}
+}
+
+func TestProcessCacheSize(t *testing.T) {
+	prc := &Processor{
+		Server:    newTestServer(t, nil),
+		CacheSize: 399,
+	}
+	_, err := prc.getOverlay(t.Context(), "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prc.cache.Length() != 0 {
+		t.Fatalf("unexpected cache length: got %d, want %d", prc.cache.Length(), 0)
+	}
+}
+
+var _ imageserver_image.ContextProcessor = &Processor{}
+
+func TestProcessContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(t.Context(), ctxKey{}, "test")
+	srv := newTestServer(t, nil)
+	var got any
+	prc := &Processor{
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			got = ctx.Value(ctxKey{})
+			return srv.Get(params)
+		}),
+		DefaultSource: "logo",
+	}
+	_, err := prc.ProcessContext(ctx, newTestBase(100, 100), nil, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "test" {
+		t.Fatalf("context not forwarded: got %v", got)
+	}
+}
+
+func TestChange(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		processor *Processor
+		params    imageserver.Params
+		expected  bool
+	}{
+		{
+			name:      "Empty",
+			processor: &Processor{},
+			params:    imageserver.Params{},
+			expected:  false,
+		},
+		{
+			name:      "Param",
+			processor: &Processor{},
+			params:    imageserver.Params{param: imageserver.Params{"source": "logo"}},
+			expected:  true,
+		},
+		{
+			name:      "DefaultSource",
+			processor: &Processor{DefaultSource: "logo"},
+			params:    imageserver.Params{},
+			expected:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.processor.Change(tc.params)
+			if c != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", c, tc.expected)
+			}
+		})
+	}
+}
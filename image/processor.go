@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"image"
 
 	"github.com/pierrre/imageserver"
@@ -14,6 +15,76 @@ type Processor interface {
 	Changer
 }
 
+// SourceProcessor is a Processor that needs the source Image (before decoding), e.g. to read its metadata.
+//
+// Handler calls ProcessSource() instead of Process() if the Processor implements it.
+type SourceProcessor interface {
+	Processor
+
+	// ProcessSource is like Process with the source Image.
+	ProcessSource(nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error)
+}
+
+// ProcessSource processes the Go Image with the source Image.
+//
+// If the Processor implements SourceProcessor, it calls ProcessSource().
+// Otherwise it calls Process().
+func ProcessSource(prc Processor, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	if prc, ok := prc.(SourceProcessor); ok {
+		return prc.ProcessSource(nim, im, params)
+	}
+	return prc.Process(nim, params)
+}
+
+// ContextProcessor is a Processor that needs the context of the request, e.g. to load another Image.
+//
+// Handler calls ProcessContext() instead of ProcessSource() if the Processor implements it.
+type ContextProcessor interface {
+	Processor
+
+	// ProcessContext is like ProcessSource with the context of the request.
+	ProcessContext(ctx context.Context, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error)
+}
+
+// ProcessContext processes the Go Image with the context and the source Image.
+//
+// If the Processor implements ContextProcessor, it calls ProcessContext().
+// Otherwise it calls ProcessSource().
+func ProcessContext(ctx context.Context, prc Processor, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	if prc, ok := prc.(ContextProcessor); ok {
+		return prc.ProcessContext(ctx, nim, im, params)
+	}
+	return ProcessSource(prc, nim, im, params)
+}
+
+// Orienter is a Processor that applies the EXIF orientation of the source Image to the Go Image.
+//
+// Handler uses it to reset the orientation of the EXIF copied to the encoded Image, so it is not applied twice.
+type Orienter interface {
+	Processor
+
+	// Orient returns true if the EXIF orientation is applied for the given Params.
+	Orient(imageserver.Params) bool
+}
+
+// Orient returns true if the Processor implements Orienter and applies the EXIF orientation.
+func Orient(prc Processor, params imageserver.Params) bool {
+	if prc, ok := prc.(Orienter); ok {
+		return prc.Orient(params)
+	}
+	return false
+}
+
+// BoundsProcessor is a Processor that can compute the bounds of the processed Image, without processing it.
+//
+// It allows to check the size of the processed Image before allocating it (see imageserver/image/ops.Processor).
+type BoundsProcessor interface {
+	Processor
+
+	// Bounds returns the bounds of the Image processed with the given Params, from the bounds of the given Image.
+	Bounds(image.Rectangle, imageserver.Params) (image.Rectangle, error)
+}
+
 // ProcessorFunc is a Processor func.
 type ProcessorFunc func(image.Image, imageserver.Params) (image.Image, error)
 
@@ -28,6 +99,8 @@ func (f ProcessorFunc) Change(params imageserver.Params) bool {
 }
 
 // ListProcessor is a Processor implementation that wrap a list of Processor.
+//
+// It implements SourceProcessor, ContextProcessor and Orienter.
 type ListProcessor []Processor
 
 // Process implements Processor.
@@ -42,6 +115,40 @@ func (prc ListProcessor) Process(nim image.Image, params imageserver.Params) (im
 	return nim, nil
 }
 
+// ProcessSource implements SourceProcessor.
+func (prc ListProcessor) ProcessSource(nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	for _, p := range prc {
+		var err error
+		nim, err = ProcessSource(p, nim, im, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nim, nil
+}
+
+// ProcessContext implements ContextProcessor.
+func (prc ListProcessor) ProcessContext(ctx context.Context, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	for _, p := range prc {
+		var err error
+		nim, err = ProcessContext(ctx, p, nim, im, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nim, nil
+}
+
+// Orient implements Orienter.
+func (prc ListProcessor) Orient(params imageserver.Params) bool {
+	for _, p := range prc {
+		if Orient(p, params) {
+			return true
+		}
+	}
+	return false
+}
+
 // Change implements Processor.
 func (prc ListProcessor) Change(params imageserver.Params) bool {
 	for _, p := range prc {
@@ -53,10 +160,27 @@ func (prc ListProcessor) Change(params imageserver.Params) bool {
 }
 
 // ChangeProcessor is a Processor implementation that alway return true for the Change method.
+//
+// It implements SourceProcessor, ContextProcessor and Orienter.
 type ChangeProcessor struct {
 	Processor
 }
 
+// ProcessSource implements SourceProcessor.
+func (prc *ChangeProcessor) ProcessSource(nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	return ProcessSource(prc.Processor, nim, im, params)
+}
+
+// ProcessContext implements ContextProcessor.
+func (prc *ChangeProcessor) ProcessContext(ctx context.Context, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	return ProcessContext(ctx, prc.Processor, nim, im, params)
+}
+
+// Orient implements Orienter.
+func (prc *ChangeProcessor) Orient(params imageserver.Params) bool {
+	return Orient(prc.Processor, params)
+}
+
 // Change implements Processor.
 func (prc *ChangeProcessor) Change(params imageserver.Params) bool {
 	return true
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"testing"
@@ -108,3 +109,169 @@ func TestChangeProcessor(t *testing.T) {
 		t.Fatal("not true")
 	}
 }
+
+var _ SourceProcessor = ListProcessor{}
+
+var _ Orienter = ListProcessor{}
+
+var _ Orienter = &ChangeProcessor{}
+
+func TestOrient(t *testing.T) {
+	nop := ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+		return nim, nil
+	})
+	for _, tc := range []struct {
+		name     string
+		prc      Processor
+		expected bool
+	}{
+		{
+			name: "NotOrienter",
+			prc:  nop,
+		},
+		{
+			name:     "Orienter",
+			prc:      testOrienter{Processor: nop},
+			expected: true,
+		},
+		{
+			name:     "List",
+			prc:      ListProcessor{nop, &ChangeProcessor{Processor: testOrienter{Processor: nop}}},
+			expected: true,
+		},
+		{
+			name: "ListNotOrienter",
+			prc:  ListProcessor{nop, &ChangeProcessor{Processor: nop}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := Orient(tc.prc, imageserver.Params{})
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", res, tc.expected)
+			}
+		})
+	}
+}
+
+type testOrienter struct {
+	Processor
+}
+
+func (prc testOrienter) Orient(params imageserver.Params) bool {
+	return true
+}
+
+func TestListProcessorProcessSource(t *testing.T) {
+	src := &imageserver.Image{Format: "test"}
+	var got []*imageserver.Image
+	prc := ListProcessor{
+		testSourceProcessor(func(im *imageserver.Image) {
+			got = append(got, im)
+		}),
+		ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			return nim, nil
+		}),
+		&ChangeProcessor{
+			Processor: testSourceProcessor(func(im *imageserver.Image) {
+				got = append(got, im)
+			}),
+		},
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := ProcessSource(prc, nim, src, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != src || got[1] != src {
+		t.Fatalf("source image not forwarded: %v", got)
+	}
+}
+
+func TestListProcessorProcessSourceError(t *testing.T) {
+	prc := ListProcessor{
+		ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			return nil, fmt.Errorf("error")
+		}),
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := prc.ProcessSource(nim, &imageserver.Image{}, imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+var _ ContextProcessor = ListProcessor{}
+
+var _ ContextProcessor = &ChangeProcessor{}
+
+func TestListProcessorProcessContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(t.Context(), ctxKey{}, "test")
+	src := &imageserver.Image{Format: "test"}
+	var gotCtx []context.Context
+	var gotSrc []*imageserver.Image
+	prc := ListProcessor{
+		testSourceProcessor(func(im *imageserver.Image) {
+			gotSrc = append(gotSrc, im)
+		}),
+		&ChangeProcessor{
+			Processor: testContextProcessor(func(ctx context.Context) {
+				gotCtx = append(gotCtx, ctx)
+			}),
+		},
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := ProcessContext(ctx, prc, nim, src, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotSrc) != 1 || gotSrc[0] != src {
+		t.Fatalf("source image not forwarded: %v", gotSrc)
+	}
+	if len(gotCtx) != 1 || gotCtx[0].Value(ctxKey{}) != "test" {
+		t.Fatalf("context not forwarded: %v", gotCtx)
+	}
+}
+
+func TestListProcessorProcessContextError(t *testing.T) {
+	prc := ListProcessor{
+		ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			return nil, fmt.Errorf("error")
+		}),
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := prc.ProcessContext(t.Context(), nim, &imageserver.Image{}, imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type testContextProcessor func(ctx context.Context)
+
+func (prc testContextProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (prc testContextProcessor) ProcessContext(ctx context.Context, nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	prc(ctx)
+	return nim, nil
+}
+
+func (prc testContextProcessor) Change(params imageserver.Params) bool {
+	return true
+}
+
+type testSourceProcessor func(im *imageserver.Image)
+
+func (prc testSourceProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (prc testSourceProcessor) ProcessSource(nim image.Image, im *imageserver.Image, params imageserver.Params) (image.Image, error) {
+	prc(im)
+	return nim, nil
+}
+
+func (prc testSourceProcessor) Change(params imageserver.Params) bool {
+	return true
+}
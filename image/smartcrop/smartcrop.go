@@ -0,0 +1,351 @@
+// Package smartcrop provides a imageserver/image.Processor implementation that crops Image to an aspect ratio, with gravity or content analysis.
+package smartcrop
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/pierrre/imageserver"
+)
+
+const param = "smart_crop"
+
+// Gravity values.
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityEntropy   = "entropy"
+	GravityAttention = "attention"
+)
+
+// analysisSize is the maximum size of the grid used by content analysis.
+const analysisSize = 256
+
+// Processor is a imageserver/image.Processor implementation that crops Image to an aspect ratio.
+//
+// It keeps the largest area with the aspect ratio, and chooses its position with the gravity.
+//
+// All params are extracted from the "smart_crop" node param:
+//   - ratio: aspect ratio (width / height), mandatory
+//   - gravity: position of the cropped area (optional)
+//
+// The gravity values are:
+//   - center: centered (default)
+//   - north, south, east, west: aligned to the edge
+//   - entropy: the edges with the lowest entropy are removed
+//   - attention: the area with the most edges, saturated colors and skin tones is kept
+//
+// The content analysis is done on a downsampled version of the Image.
+type Processor struct {
+	DefaultGravity string // Optional, "center" if empty.
+}
+
+// Process implements imageserver/image.Processor.
+func (prc *Processor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	if !params.Has(param) {
+		return nim, nil
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return nil, err
+	}
+	nim, err = prc.process(nim, params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = param + "." + err.Param
+		}
+		return nil, err
+	}
+	return nim, nil
+}
+
+func (prc *Processor) process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	ratio, err := getRatio(params)
+	if err != nil {
+		return nil, err
+	}
+	gravity, err := prc.getGravity(params)
+	if err != nil {
+		return nil, err
+	}
+	bds := Crop(nim, ratio, gravity)
+	if bds == nim.Bounds() {
+		return nim, nil
+	}
+	return subImage(nim, bds)
+}
+
+func getRatio(params imageserver.Params) (float64, error) {
+	ratio, err := params.GetFloat("ratio")
+	if err != nil {
+		return 0, err
+	}
+	if !(ratio > 0) || math.IsInf(ratio, 0) {
+		return 0, &imageserver.ParamError{Param: "ratio", Message: "must be greater than 0"}
+	}
+	return ratio, nil
+}
+
+func (prc *Processor) getGravity(params imageserver.Params) (string, error) {
+	if !params.Has("gravity") {
+		if prc.DefaultGravity != "" {
+			return prc.DefaultGravity, nil
+		}
+		return GravityCenter, nil
+	}
+	gravity, err := params.GetString("gravity")
+	if err != nil {
+		return "", err
+	}
+	switch gravity {
+	case GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityEntropy, GravityAttention:
+		return gravity, nil
+	}
+	return "", &imageserver.ParamError{Param: "gravity", Message: "invalid value"}
+}
+
+// Change implements imageserver/image.Processor.
+func (prc *Processor) Change(params imageserver.Params) bool {
+	return params.Has(param)
+}
+
+// Crop returns the bounds of the cropped area of the Image, for the aspect ratio (width / height) and gravity.
+//
+// An unknown gravity is handled as "center".
+func Crop(nim image.Image, ratio float64, gravity string) image.Rectangle {
+	bds := nim.Bounds()
+	w, h := bds.Dx(), bds.Dy()
+	if w <= 0 || h <= 0 {
+		return bds
+	}
+	cw, ch := w, h
+	if float64(w)/float64(h) > ratio {
+		cw = max(int(math.Round(float64(h)*ratio)), 1)
+	} else {
+		ch = max(int(math.Round(float64(w)/ratio)), 1)
+	}
+	if cw == w && ch == h {
+		return bds
+	}
+	horizontal := cw < w
+	excess := w - cw
+	if !horizontal {
+		excess = h - ch
+	}
+	var offset int
+	switch gravity {
+	case GravityNorth:
+		if horizontal {
+			offset = excess / 2
+		}
+	case GravitySouth:
+		offset = excess
+		if horizontal {
+			offset = excess / 2
+		}
+	case GravityWest:
+		if !horizontal {
+			offset = excess / 2
+		}
+	case GravityEast:
+		offset = excess
+		if !horizontal {
+			offset = excess / 2
+		}
+	case GravityEntropy, GravityAttention:
+		offset = analyze(nim, horizontal, excess, gravity)
+	default:
+		offset = excess / 2
+	}
+	if horizontal {
+		return image.Rect(bds.Min.X+offset, bds.Min.Y, bds.Min.X+offset+cw, bds.Max.Y)
+	}
+	return image.Rect(bds.Min.X, bds.Min.Y+offset, bds.Max.X, bds.Min.Y+offset+ch)
+}
+
+// analyze returns the offset of the cropped area, along the cropped axis.
+func analyze(nim image.Image, horizontal bool, excess int, gravity string) int {
+	g := newGrid(nim)
+	length := g.height
+	size := nim.Bounds().Dy()
+	if horizontal {
+		length = g.width
+		size = nim.Bounds().Dx()
+	}
+	// Size of the cropped area in the grid.
+	window := int(math.Round(float64(size-excess) * float64(length) / float64(size)))
+	window = min(max(window, 1), length)
+	if window == length {
+		return excess / 2
+	}
+	var offset int
+	if gravity == GravityEntropy {
+		offset = g.entropyOffset(horizontal, window)
+	} else {
+		offset = g.attentionOffset(horizontal, window)
+	}
+	return int(math.Round(float64(offset) * float64(excess) / float64(length-window)))
+}
+
+// grid is a downsampled version of an Image.
+type grid struct {
+	width, height int
+	pixels        []color.NRGBA
+}
+
+func newGrid(nim image.Image) *grid {
+	bds := nim.Bounds()
+	w, h := bds.Dx(), bds.Dy()
+	scale := math.Min(1, float64(analysisSize)/float64(max(w, h)))
+	g := &grid{
+		width:  max(int(math.Round(float64(w)*scale)), 1),
+		height: max(int(math.Round(float64(h)*scale)), 1),
+	}
+	g.pixels = make([]color.NRGBA, g.width*g.height)
+	for y := range g.height {
+		sy := bds.Min.Y + (2*y+1)*h/(2*g.height)
+		for x := range g.width {
+			sx := bds.Min.X + (2*x+1)*w/(2*g.width)
+			g.pixels[y*g.width+x] = color.NRGBAModel.Convert(nim.At(sx, sy)).(color.NRGBA)
+		}
+	}
+	return g
+}
+
+func (g *grid) at(x, y int) color.NRGBA {
+	return g.pixels[y*g.width+x]
+}
+
+func luminance(c color.NRGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
+
+// entropyOffset removes the slice with the lowest entropy from the start or the end, until the window size is reached.
+func (g *grid) entropyOffset(horizontal bool, window int) int {
+	length := g.height
+	if horizontal {
+		length = g.width
+	}
+	start, end := 0, length
+	for end-start > window {
+		slice := min(max(length/20, 1), end-start-window)
+		if g.entropy(horizontal, start, start+slice) < g.entropy(horizontal, end-slice, end) {
+			start += slice
+		} else {
+			end -= slice
+		}
+	}
+	return start
+}
+
+// entropy returns the entropy of the luminance histogram of the slice [from, to) along the axis.
+func (g *grid) entropy(horizontal bool, from, to int) float64 {
+	var hist [256]int
+	n := 0
+	for i := from; i < to; i++ {
+		if horizontal {
+			for y := range g.height {
+				hist[luminance(g.at(i, y))]++
+			}
+			n += g.height
+		} else {
+			for x := range g.width {
+				hist[luminance(g.at(x, i))]++
+			}
+			n += g.width
+		}
+	}
+	var e float64
+	for _, c := range hist {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// attentionOffset returns the offset of the window with the highest attention score.
+func (g *grid) attentionOffset(horizontal bool, window int) int {
+	length := g.height
+	if horizontal {
+		length = g.width
+	}
+	scores := make([]float64, length)
+	for y := range g.height {
+		for x := range g.width {
+			s := g.attention(x, y)
+			if horizontal {
+				scores[x] += s
+			} else {
+				scores[y] += s
+			}
+		}
+	}
+	var sum float64
+	for _, s := range scores[:window] {
+		sum += s
+	}
+	best, bestSum := 0, sum
+	for i := window; i < length; i++ {
+		sum += scores[i] - scores[i-window]
+		if sum > bestSum {
+			best, bestSum = i-window+1, sum
+		}
+	}
+	return best
+}
+
+// attention returns the attention score of a pixel.
+//
+// It is based on the edges (luminance gradient), the saturation and the skin tones.
+func (g *grid) attention(x, y int) float64 {
+	c := g.at(x, y)
+	l := luminance(c)
+	var edge int
+	if x > 0 {
+		edge += abs(l - luminance(g.at(x-1, y)))
+	}
+	if y > 0 {
+		edge += abs(l - luminance(g.at(x, y-1)))
+	}
+	r, gr, b := int(c.R), int(c.G), int(c.B)
+	saturation := max(r, gr, b) - min(r, gr, b)
+	score := float64(edge) + float64(saturation)/4
+	if isSkin(r, gr, b) {
+		score += 64
+	}
+	return score * float64(c.A) / 0xff
+}
+
+// isSkin returns true if the color is a skin tone.
+func isSkin(r, g, b int) bool {
+	return r > 95 && g > 40 && b > 20 && r > g && r > b && r-g > 15 && max(r, g, b)-min(r, g, b) > 15
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func subImage(nim image.Image, bds image.Rectangle) (image.Image, error) {
+	type SubImage interface {
+		image.Image
+		SubImage(image.Rectangle) image.Image
+	}
+	sim, ok := nim.(SubImage)
+	if !ok {
+		return nil, &imageserver.ImageError{
+			Message: fmt.Sprintf("smart crop: image type %T not supported: method SubImage not found", nim),
+		}
+	}
+	return sim.SubImage(bds), nil
+}
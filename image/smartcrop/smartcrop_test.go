@@ -0,0 +1,329 @@
+package smartcrop
+
+import (
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	imageserver_testdata "github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver_image.Processor = &Processor{}
+
+func TestProcess(t *testing.T) {
+	prc := &Processor{}
+	for _, tc := range []struct {
+		name               string
+		newImage           func() image.Image
+		params             imageserver.Params
+		expectedParamError string
+		expectedImageError bool
+		expectedBounds     image.Rectangle
+	}{
+		{
+			name: "Empty",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params:         imageserver.Params{},
+			expectedBounds: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name: "Center",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio": 1.0,
+			}},
+			expectedBounds: image.Rect(50, 0, 150, 100),
+		},
+		{
+			name: "SameRatio",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio": 2.0,
+			}},
+			expectedBounds: image.Rect(0, 0, 200, 100),
+		},
+		{
+			name: "Gravity",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio":   1.0,
+				"gravity": "east",
+			}},
+			expectedBounds: image.Rect(100, 0, 200, 100),
+		},
+		{
+			name: "Invalid",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params:             imageserver.Params{param: "invalid"},
+			expectedParamError: param,
+		},
+		{
+			name: "RatioMissing",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params:             imageserver.Params{param: imageserver.Params{}},
+			expectedParamError: param + ".ratio",
+		},
+		{
+			name: "RatioInvalid",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio": -1.0,
+			}},
+			expectedParamError: param + ".ratio",
+		},
+		{
+			name: "GravityInvalid",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio":   1.0,
+				"gravity": "invalid",
+			}},
+			expectedParamError: param + ".gravity",
+		},
+		{
+			name: "GravityInvalidType",
+			newImage: func() image.Image {
+				return image.NewRGBA(image.Rect(0, 0, 200, 100))
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio":   1.0,
+				"gravity": 1,
+			}},
+			expectedParamError: param + ".gravity",
+		},
+		{
+			name: "NotSupported",
+			newImage: func() image.Image {
+				return image.NewUniform(color.Black)
+			},
+			params: imageserver.Params{param: imageserver.Params{
+				"ratio": 2.0,
+			}},
+			expectedImageError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nim, err := prc.Process(tc.newImage(), tc.params)
+			if err != nil {
+				switch err := err.(type) {
+				case *imageserver.ParamError:
+					if err.Param == tc.expectedParamError {
+						return
+					}
+				case *imageserver.ImageError:
+					if tc.expectedImageError {
+						return
+					}
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" || tc.expectedImageError {
+				t.Fatal("no error")
+			}
+			if nim.Bounds() != tc.expectedBounds {
+				t.Fatalf("unexpected bounds: got %s, want %s", nim.Bounds(), tc.expectedBounds)
+			}
+		})
+	}
+}
+
+func TestProcessDefaultGravity(t *testing.T) {
+	prc := &Processor{DefaultGravity: GravityNorth}
+	nim, err := prc.Process(image.NewRGBA(image.Rect(0, 0, 100, 200)), imageserver.Params{param: imageserver.Params{
+		"ratio": 1.0,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := image.Rect(0, 0, 100, 100)
+	if nim.Bounds() != expected {
+		t.Fatalf("unexpected bounds: got %s, want %s", nim.Bounds(), expected)
+	}
+}
+
+func TestProcessTestdata(t *testing.T) {
+	nim, err := imageserver_image.Decode(imageserver_testdata.Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gravity := range []string{GravityEntropy, GravityAttention} {
+		t.Run(gravity, func(t *testing.T) {
+			res, err := (&Processor{}).Process(nim, imageserver.Params{param: imageserver.Params{
+				"ratio":   1.0,
+				"gravity": gravity,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Bounds().Dx() != 819 || res.Bounds().Dy() != 819 {
+				t.Fatalf("unexpected size: %s", res.Bounds())
+			}
+			if !res.Bounds().In(nim.Bounds()) {
+				t.Fatalf("bounds %s not in %s", res.Bounds(), nim.Bounds())
+			}
+		})
+	}
+}
+
+func TestCrop(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		bounds   image.Rectangle
+		ratio    float64
+		gravity  string
+		expected image.Rectangle
+	}{
+		{
+			name:     "HorizontalCenter",
+			bounds:   image.Rect(0, 0, 200, 100),
+			ratio:    1,
+			gravity:  GravityCenter,
+			expected: image.Rect(50, 0, 150, 100),
+		},
+		{
+			name:     "HorizontalWest",
+			bounds:   image.Rect(0, 0, 200, 100),
+			ratio:    1,
+			gravity:  GravityWest,
+			expected: image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:     "HorizontalEast",
+			bounds:   image.Rect(0, 0, 200, 100),
+			ratio:    1,
+			gravity:  GravityEast,
+			expected: image.Rect(100, 0, 200, 100),
+		},
+		{
+			name:     "HorizontalNorth",
+			bounds:   image.Rect(0, 0, 200, 100),
+			ratio:    1,
+			gravity:  GravityNorth,
+			expected: image.Rect(50, 0, 150, 100),
+		},
+		{
+			name:     "VerticalNorth",
+			bounds:   image.Rect(0, 0, 100, 200),
+			ratio:    1,
+			gravity:  GravityNorth,
+			expected: image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:     "VerticalSouth",
+			bounds:   image.Rect(0, 0, 100, 200),
+			ratio:    1,
+			gravity:  GravitySouth,
+			expected: image.Rect(0, 100, 100, 200),
+		},
+		{
+			name:     "VerticalEast",
+			bounds:   image.Rect(0, 0, 100, 200),
+			ratio:    1,
+			gravity:  GravityEast,
+			expected: image.Rect(0, 50, 100, 150),
+		},
+		{
+			name:     "Offset",
+			bounds:   image.Rect(10, 20, 210, 120),
+			ratio:    0.5,
+			gravity:  GravityCenter,
+			expected: image.Rect(85, 20, 135, 120),
+		},
+		{
+			name:     "Minimum",
+			bounds:   image.Rect(0, 0, 100, 1),
+			ratio:    0.001,
+			gravity:  GravityCenter,
+			expected: image.Rect(49, 0, 50, 1),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := Crop(image.NewRGBA(tc.bounds), tc.ratio, tc.gravity)
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %s, want %s", res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCropAnalysis(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		horizontal bool
+		gravity    string
+	}{
+		{
+			name:       "EntropyHorizontal",
+			horizontal: true,
+			gravity:    GravityEntropy,
+		},
+		{
+			name:    "EntropyVertical",
+			gravity: GravityEntropy,
+		},
+		{
+			name:       "AttentionHorizontal",
+			horizontal: true,
+			gravity:    GravityAttention,
+		},
+		{
+			name:    "AttentionVertical",
+			gravity: GravityAttention,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// A flat image with a detailed area at the end.
+			size := image.Pt(300, 1000)
+			detail := image.Rect(0, 800, 300, 1000)
+			expected := image.Rect(0, 700, 300, 1000)
+			if tc.horizontal {
+				size = image.Pt(1000, 300)
+				detail = image.Rect(800, 0, 1000, 300)
+				expected = image.Rect(700, 0, 1000, 300)
+			}
+			nim := image.NewNRGBA(image.Rectangle{Max: size})
+			for y := range size.Y {
+				for x := range size.X {
+					c := color.NRGBA{R: 128, G: 128, B: 128, A: 0xff}
+					if image.Pt(x, y).In(detail) {
+						c = color.NRGBA{R: uint8(x * 37), G: uint8(y * 91), B: uint8(x * y), A: 0xff}
+					}
+					nim.SetNRGBA(x, y, c)
+				}
+			}
+			res := Crop(nim, float64(expected.Dx())/float64(expected.Dy()), tc.gravity)
+			if res != expected {
+				t.Fatalf("unexpected result: got %s, want %s", res, expected)
+			}
+		})
+	}
+}
+
+func TestChange(t *testing.T) {
+	prc := &Processor{}
+	if prc.Change(imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !prc.Change(imageserver.Params{param: imageserver.Params{}}) {
+		t.Fatal("not true")
+	}
+}
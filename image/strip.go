@@ -0,0 +1,124 @@
+package image
+
+import (
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/image/exif"
+	"github.com/pierrre/imageserver/image/metadata"
+)
+
+const (
+	// StripParam is the param that controls which metadata is removed by Handler.
+	//
+	// Values:
+	//   - "all": removes the ICC profile, EXIF and XMP
+	//   - "exif": removes EXIF and XMP (GPS location, camera, ...), and keeps the ICC profile
+	//   - "none": keeps the ICC profile, EXIF and XMP
+	StripParam = "strip"
+
+	// KeepICCParam is the boolean param that keeps (or removes) the ICC profile, regardless of StripParam.
+	KeepICCParam = "keep_icc"
+)
+
+// metadataKeep is the metadata kept by Handler.
+type metadataKeep struct {
+	ICC  bool
+	EXIF bool
+	XMP  bool
+}
+
+var (
+	metadataKeepAll  = metadataKeep{ICC: true, EXIF: true, XMP: true}
+	metadataKeepNone = metadataKeep{}
+)
+
+// getMetadataKeep returns the metadata kept, from the params.
+//
+// The default value is returned if the params are not set.
+func getMetadataKeep(params imageserver.Params, def metadataKeep) (metadataKeep, error) {
+	keep := def
+	if params.Has(StripParam) {
+		s, err := params.GetString(StripParam)
+		if err != nil {
+			return keep, err
+		}
+		switch s {
+		case "all":
+			keep = metadataKeepNone
+		case "exif":
+			keep = metadataKeep{ICC: true}
+		case "none":
+			keep = metadataKeepAll
+		default:
+			return keep, &imageserver.ParamError{Param: StripParam, Message: "invalid value"}
+		}
+	}
+	if params.Has(KeepICCParam) {
+		var err error
+		keep.ICC, err = params.GetBool(KeepICCParam)
+		if err != nil {
+			return keep, err
+		}
+	}
+	return keep, nil
+}
+
+// filter returns the kept Metadata.
+func (keep metadataKeep) filter(md *metadata.Metadata) *metadata.Metadata {
+	res := &metadata.Metadata{}
+	if keep.ICC {
+		res.ICC = md.ICC
+	}
+	if keep.EXIF {
+		res.EXIF = md.EXIF
+	}
+	if keep.XMP {
+		res.XMP = md.XMP
+	}
+	return res
+}
+
+// stripMetadata removes the metadata of an unchanged Image.
+func stripMetadata(im *imageserver.Image, keep metadataKeep) (*imageserver.Image, error) {
+	md, err := metadata.Read(im.Format, im.Data)
+	if err != nil {
+		return nil, &imageserver.ImageError{Message: err.Error()}
+	}
+	data, err := metadata.Write(im.Format, im.Data, keep.filter(md))
+	if err != nil {
+		return nil, &imageserver.ImageError{Message: err.Error()}
+	}
+	return &imageserver.Image{
+		Format:   im.Format,
+		Data:     data,
+		Metadata: im.Metadata,
+	}, nil
+}
+
+// copyMetadata copies the kept metadata from the source Image to the encoded Image.
+//
+// If oriented is true, the EXIF orientation was applied to the pixels, and it is reset to normal (or the EXIF is removed if it is invalid).
+// It does nothing if one of the formats is not supported.
+func copyMetadata(src, dst *imageserver.Image, keep metadataKeep, oriented bool) error {
+	if keep == metadataKeepNone || !metadata.Supported(src.Format) || !metadata.Supported(dst.Format) {
+		return nil
+	}
+	md, err := metadata.Read(src.Format, src.Data)
+	if err != nil {
+		return &imageserver.ImageError{Message: err.Error()}
+	}
+	md = keep.filter(md)
+	if md.Empty() {
+		return nil
+	}
+	if oriented && md.EXIF != nil {
+		md.EXIF, err = exif.ResetOrientation(md.EXIF)
+		if err != nil {
+			md.EXIF = nil
+		}
+	}
+	dst.Data, err = metadata.Write(dst.Format, dst.Data, md)
+	if err != nil {
+		return &imageserver.ImageError{Message: err.Error()}
+	}
+	return nil
+}
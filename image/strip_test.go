@@ -0,0 +1,185 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/image/metadata"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestHandlerMetadata(t *testing.T) {
+	src := testImageMetadata(t)
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expectedICC        bool
+		expectedEXIF       bool
+		expectedXMP        bool
+		expectedParamError string
+	}{
+		{
+			name:         "Unchanged",
+			params:       imageserver.Params{},
+			expectedICC:  true,
+			expectedEXIF: true,
+			expectedXMP:  true,
+		},
+		{
+			name:   "UnchangedStripAll",
+			params: imageserver.Params{StripParam: "all"},
+		},
+		{
+			name:        "UnchangedStripEXIF",
+			params:      imageserver.Params{StripParam: "exif"},
+			expectedICC: true,
+		},
+		{
+			name:         "UnchangedKeepICCFalse",
+			params:       imageserver.Params{KeepICCParam: false},
+			expectedEXIF: true,
+			expectedXMP:  true,
+		},
+		{
+			name:        "UnchangedStripAllKeepICC",
+			params:      imageserver.Params{StripParam: "all", KeepICCParam: true},
+			expectedICC: true,
+		},
+		{
+			name:   "Encoded",
+			params: imageserver.Params{"quality": 50},
+		},
+		{
+			name:        "EncodedKeepICC",
+			params:      imageserver.Params{"quality": 50, KeepICCParam: true},
+			expectedICC: true,
+		},
+		{
+			name:         "EncodedStripNone",
+			params:       imageserver.Params{"quality": 50, StripParam: "none"},
+			expectedICC:  true,
+			expectedEXIF: true,
+			expectedXMP:  true,
+		},
+		{
+			name:               "ErrorStripInvalid",
+			params:             imageserver.Params{StripParam: "invalid"},
+			expectedParamError: StripParam,
+		},
+		{
+			name:               "ErrorStripType",
+			params:             imageserver.Params{"quality": 50, StripParam: 1},
+			expectedParamError: StripParam,
+		},
+		{
+			name:               "ErrorKeepICCType",
+			params:             imageserver.Params{KeepICCParam: "invalid"},
+			expectedParamError: KeepICCParam,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			im, err := (&Handler{}).Handle(src, tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedParamError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			_, err = Decode(im)
+			if err != nil {
+				t.Fatal(err)
+			}
+			md, err := metadata.Read(im.Format, im.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (md.ICC != nil) != tc.expectedICC {
+				t.Fatalf("unexpected ICC: got %t, want %t", md.ICC != nil, tc.expectedICC)
+			}
+			if (md.EXIF != nil) != tc.expectedEXIF {
+				t.Fatalf("unexpected EXIF: got %t, want %t", md.EXIF != nil, tc.expectedEXIF)
+			}
+			if (md.XMP != nil) != tc.expectedXMP {
+				t.Fatalf("unexpected XMP: got %t, want %t", md.XMP != nil, tc.expectedXMP)
+			}
+		})
+	}
+}
+
+func TestHandlerChangeMetadataUnsupportedFormat(t *testing.T) {
+	c := (&Handler{}).Change("gif", imageserver.Params{StripParam: "all"})
+	if !c {
+		t.Fatal("not true")
+	}
+}
+
+func TestHandlerMetadataErrorInvalid(t *testing.T) {
+	_, err := (&Handler{}).Handle(testdata.Invalid, imageserver.Params{StripParam: "all"})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHandlerChangeMetadata(t *testing.T) {
+	hdr := &Handler{}
+	for _, tc := range []struct {
+		name     string
+		params   imageserver.Params
+		expected bool
+	}{
+		{
+			name:   "StripNone",
+			params: imageserver.Params{StripParam: "none"},
+		},
+		{
+			name:   "KeepICC",
+			params: imageserver.Params{KeepICCParam: true},
+		},
+		{
+			name:     "StripAll",
+			params:   imageserver.Params{StripParam: "all"},
+			expected: true,
+		},
+		{
+			name:     "StripEXIF",
+			params:   imageserver.Params{StripParam: "exif"},
+			expected: true,
+		},
+		{
+			name:     "KeepICCFalse",
+			params:   imageserver.Params{KeepICCParam: false},
+			expected: true,
+		},
+		{
+			name:     "Invalid",
+			params:   imageserver.Params{StripParam: "invalid"},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := hdr.Change("jpeg", tc.params)
+			if c != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", c, tc.expected)
+			}
+		})
+	}
+}
+
+func testImageMetadata(tb testing.TB) *imageserver.Image {
+	tb.Helper()
+	md, err := metadata.Read("jpeg", testdata.Small.Data)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	md.ICC = []byte("icc")
+	md.EXIF = []byte("MM\x00*exif")
+	md.XMP = []byte("<x:xmpmeta/>")
+	data, err := metadata.Write("jpeg", testdata.Small.Data, md)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &imageserver.Image{Format: "jpeg", Data: data}
+}
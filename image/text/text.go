@@ -0,0 +1,421 @@
+// Package text provides a imageserver/image.Processor implementation that draws text onto the Image.
+package text
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pierrre/imageserver"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const param = "text"
+
+// Gravity values.
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "north_east"
+	GravityNorthWest = "north_west"
+	GravitySouthEast = "south_east"
+	GravitySouthWest = "south_west"
+)
+
+// Align values.
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// Default values for Processor.
+const (
+	DefaultSize      = 24
+	DefaultMaxSize   = 256
+	DefaultMaxLength = 1024
+)
+
+// Processor is a imageserver/image.Processor implementation that draws text onto the Image.
+//
+// All params are extracted from the "text" node param:
+//   - text: the text (required), "\n" starts a new line
+//   - font: font name in Fonts, DefaultFont by default
+//   - size: font size in pixels, DefaultSize by default
+//   - color: text color, hexadecimal "rgb", "rgba", "rrggbb" or "rrggbbaa", "fff" (white) by default
+//   - gravity: text block position (center, north, south, east, west, north_east, north_west, south_east, south_west), "center" by default
+//   - margin: margin in pixels from the edges, 0 by default
+//   - width: wrapping width in pixels, the Image width minus the margins by default
+//   - align: lines alignment (left, center, right), "left" by default
+//   - shadow: shadow offset in pixels, 0 (no shadow) by default
+//   - shadow_color: shadow color, same format as color, "000" (black) by default
+//
+// The text is wrapped on spaces, and the words longer than the width are broken.
+// The lines that don't fit in the Image are not drawn.
+type Processor struct {
+	// Fonts are the available fonts, by name.
+	// They can be loaded from TTF/OTF files with golang.org/x/image/font/opentype.Parse.
+	Fonts map[string]*opentype.Font
+
+	DefaultFont string
+	DefaultSize float64 // Optional, DefaultSize if 0.
+
+	// MaxSize is the maximum font size (DefaultMaxSize if 0).
+	MaxSize float64
+
+	// MaxLength is the maximum text length, in characters (DefaultMaxLength if 0).
+	MaxLength int
+}
+
+// Process implements imageserver/image.Processor.
+func (prc *Processor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	if !params.Has(param) {
+		return nim, nil
+	}
+	params, err := params.GetParams(param)
+	if err != nil {
+		return nil, err
+	}
+	nim, err = prc.process(nim, params)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = param + "." + err.Param
+		}
+		return nil, err
+	}
+	return nim, nil
+}
+
+func (prc *Processor) process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	opts, err := prc.getOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	if opts.text == "" {
+		return nim, nil
+	}
+	face, err := opentype.NewFace(opts.font, &opentype.FaceOptions{
+		Size:    opts.size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, &imageserver.ImageError{Message: fmt.Sprintf("text: %s", err)}
+	}
+	defer func() {
+		_ = face.Close()
+	}()
+	bds := nim.Bounds()
+	width := opts.width
+	if width == 0 {
+		width = bds.Dx() - 2*opts.margin
+	}
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	maxLines := (bds.Dy() - 2*opts.margin) / max(lineHeight, 1)
+	lines := wrap(face, opts.text, fixed.I(max(width, 1)), maxLines)
+	if len(lines) == 0 {
+		return nim, nil
+	}
+	out := image.NewRGBA(bds)
+	draw.Draw(out, bds, nim, bds.Min, draw.Src)
+	var blockWidth int
+	lineWidths := make([]int, len(lines))
+	for i, l := range lines {
+		lineWidths[i] = font.MeasureString(face, l).Ceil()
+		blockWidth = max(blockWidth, lineWidths[i])
+	}
+	block := position(bds, image.Pt(blockWidth, len(lines)*lineHeight), opts.gravity, opts.margin)
+	for i, l := range lines {
+		x := block.X
+		switch opts.align {
+		case AlignCenter:
+			x += (blockWidth - lineWidths[i]) / 2
+		case AlignRight:
+			x += blockWidth - lineWidths[i]
+		}
+		dot := fixed.Point26_6{
+			X: fixed.I(x),
+			Y: fixed.I(block.Y+i*lineHeight) + metrics.Ascent,
+		}
+		if opts.shadow != 0 {
+			drawString(out, face, opts.shadowColor, dot.Add(fixed.P(opts.shadow, opts.shadow)), l)
+		}
+		drawString(out, face, opts.color, dot, l)
+	}
+	return out, nil
+}
+
+func drawString(dst draw.Image, face font.Face, c color.Color, dot fixed.Point26_6, s string) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  dot,
+	}
+	d.DrawString(s)
+}
+
+type options struct {
+	text        string
+	font        *opentype.Font
+	size        float64
+	color       color.Color
+	gravity     string
+	margin      int
+	width       int
+	align       string
+	shadow      int
+	shadowColor color.Color
+}
+
+// nolint: gocyclo
+func (prc *Processor) getOptions(params imageserver.Params) (*options, error) {
+	opts := &options{
+		color:       color.White,
+		gravity:     GravityCenter,
+		align:       AlignLeft,
+		shadowColor: color.Black,
+	}
+	var err error
+	opts.text, err = params.GetString("text")
+	if err != nil {
+		return nil, err
+	}
+	maxLength := prc.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLength
+	}
+	if len(opts.text) > maxLength*utf8.UTFMax || utf8.RuneCountInString(opts.text) > maxLength {
+		return nil, &imageserver.ParamError{Param: "text", Message: fmt.Sprintf("length must be less than or equal to %d", maxLength)}
+	}
+	opts.font, err = prc.getFont(params)
+	if err != nil {
+		return nil, err
+	}
+	opts.size, err = prc.getSize(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Has("color") {
+		opts.color, err = getColor("color", params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if params.Has("gravity") {
+		opts.gravity, err = params.GetString("gravity")
+		if err != nil {
+			return nil, err
+		}
+		switch opts.gravity {
+		case GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityNorthEast, GravityNorthWest, GravitySouthEast, GravitySouthWest:
+		default:
+			return nil, &imageserver.ParamError{Param: "gravity", Message: "invalid value"}
+		}
+	}
+	opts.margin, err = getPositiveInt("margin", params)
+	if err != nil {
+		return nil, err
+	}
+	opts.width, err = getPositiveInt("width", params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Has("align") {
+		opts.align, err = params.GetString("align")
+		if err != nil {
+			return nil, err
+		}
+		switch opts.align {
+		case AlignLeft, AlignCenter, AlignRight:
+		default:
+			return nil, &imageserver.ParamError{Param: "align", Message: "invalid value"}
+		}
+	}
+	opts.shadow, err = getPositiveInt("shadow", params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Has("shadow_color") {
+		opts.shadowColor, err = getColor("shadow_color", params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func (prc *Processor) getFont(params imageserver.Params) (*opentype.Font, error) {
+	name := prc.DefaultFont
+	if params.Has("font") {
+		var err error
+		name, err = params.GetString("font")
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, ok := prc.Fonts[name]
+	if !ok {
+		return nil, &imageserver.ParamError{Param: "font", Message: "invalid value"}
+	}
+	return f, nil
+}
+
+func (prc *Processor) getSize(params imageserver.Params) (float64, error) {
+	if !params.Has("size") {
+		if prc.DefaultSize != 0 {
+			return prc.DefaultSize, nil
+		}
+		return DefaultSize, nil
+	}
+	size, err := params.GetFloat("size")
+	if err != nil {
+		return 0, err
+	}
+	maxSize := prc.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if !(size > 0 && size <= maxSize) {
+		return 0, &imageserver.ParamError{Param: "size", Message: fmt.Sprintf("must be greater than 0 and less than or equal to %g", maxSize)}
+	}
+	return size, nil
+}
+
+func getPositiveInt(name string, params imageserver.Params) (int, error) {
+	if !params.Has(name) {
+		return 0, nil
+	}
+	i, err := params.GetInt(name)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, &imageserver.ParamError{Param: name, Message: "must be greater than or equal to 0"}
+	}
+	return i, nil
+}
+
+func getColor(name string, params imageserver.Params) (color.Color, error) {
+	s, err := params.GetString(name)
+	if err != nil {
+		return nil, err
+	}
+	switch len(s) {
+	case 3, 4:
+		// Expand "rgb(a)" to "rrggbb(aa)".
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+		s = b.String()
+	case 6, 8:
+	default:
+		return nil, &imageserver.ParamError{Param: name, Message: "length must be equal to 3, 4, 6 or 8"}
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, &imageserver.ParamError{Param: name, Message: "must only contain characters in 0-9a-f"}
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// wrap splits the text in lines that are not wider than width.
+//
+// It returns at most maxLines lines.
+func wrap(face font.Face, text string, width fixed.Int26_6, maxLines int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			if len(lines) >= maxLines {
+				return lines
+			}
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			line = ""
+			for font.MeasureString(face, word) > width && len(lines) < maxLines {
+				n := breakWord(face, word, width)
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+			line = word
+		}
+		if len(lines) >= maxLines {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// breakWord returns the length of the longest prefix of word that is not wider than width.
+//
+// It is at least one character.
+func breakWord(face font.Face, word string, width fixed.Int26_6) int {
+	var adv fixed.Int26_6
+	prev := rune(-1)
+	for i, r := range word {
+		if prev >= 0 {
+			adv += face.Kern(prev, r)
+		}
+		a, _ := face.GlyphAdvance(r)
+		adv += a
+		if adv > width {
+			if i == 0 {
+				_, size := utf8.DecodeRuneInString(word)
+				return size
+			}
+			return i
+		}
+		prev = r
+	}
+	return len(word)
+}
+
+// position returns the top-left position of the text block.
+func position(bds image.Rectangle, size image.Point, gravity string, margin int) image.Point {
+	x := bds.Min.X + (bds.Dx()-size.X)/2
+	y := bds.Min.Y + (bds.Dy()-size.Y)/2
+	switch gravity {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		y = bds.Min.Y + margin
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		y = bds.Max.Y - size.Y - margin
+	}
+	switch gravity {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		x = bds.Min.X + margin
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		x = bds.Max.X - size.X - margin
+	}
+	return image.Pt(x, y)
+}
+
+// Change implements imageserver/image.Processor.
+func (prc *Processor) Change(params imageserver.Params) bool {
+	return params.Has(param)
+}
@@ -0,0 +1,295 @@
+package text
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var _ imageserver_image.Processor = &Processor{}
+
+func newTestProcessor(t *testing.T) *Processor {
+	t.Helper()
+	fonts := make(map[string]*opentype.Font)
+	for name, data := range map[string][]byte{
+		"regular": goregular.TTF,
+		"bold":    gobold.TTF,
+	} {
+		f, err := opentype.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fonts[name] = f
+	}
+	return &Processor{
+		Fonts:       fonts,
+		DefaultFont: "regular",
+	}
+}
+
+func newTestImage() *image.RGBA {
+	nim := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(nim, nim.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	return nim
+}
+
+func TestProcess(t *testing.T) {
+	prc := newTestProcessor(t)
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expectedParamError string
+		expectedChanged    image.Rectangle
+	}{
+		{
+			name:   "Empty",
+			params: imageserver.Params{},
+		},
+		{
+			name:   "EmptyText",
+			params: imageserver.Params{param: imageserver.Params{"text": ""}},
+		},
+		{
+			name:            "Default",
+			params:          imageserver.Params{param: imageserver.Params{"text": "Hello"}},
+			expectedChanged: image.Rect(50, 30, 150, 70),
+		},
+		{
+			name: "Options",
+			params: imageserver.Params{param: imageserver.Params{
+				"text":         "Hello world, this is a long caption",
+				"font":         "bold",
+				"size":         12.0,
+				"color":        "ff0000",
+				"gravity":      GravityNorthWest,
+				"margin":       5,
+				"width":        100,
+				"align":        AlignRight,
+				"shadow":       1,
+				"shadow_color": "0f08",
+			}},
+			expectedChanged: image.Rect(0, 0, 110, 50),
+		},
+		{
+			name: "SouthEast",
+			params: imageserver.Params{param: imageserver.Params{
+				"text":    "Hello",
+				"gravity": GravitySouthEast,
+				"align":   AlignCenter,
+			}},
+			expectedChanged: image.Rect(100, 50, 200, 100),
+		},
+		{
+			name:               "ErrorParams",
+			params:             imageserver.Params{param: "invalid"},
+			expectedParamError: param,
+		},
+		{
+			name:               "ErrorText",
+			params:             imageserver.Params{param: imageserver.Params{}},
+			expectedParamError: param + ".text",
+		},
+		{
+			name:               "ErrorTextTooLong",
+			params:             imageserver.Params{param: imageserver.Params{"text": strings.Repeat("a", DefaultMaxLength+1)}},
+			expectedParamError: param + ".text",
+		},
+		{
+			name:               "ErrorFont",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "font": "invalid"}},
+			expectedParamError: param + ".font",
+		},
+		{
+			name:               "ErrorSize",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "size": 1000.0}},
+			expectedParamError: param + ".size",
+		},
+		{
+			name:               "ErrorSizeZero",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "size": 0.0}},
+			expectedParamError: param + ".size",
+		},
+		{
+			name:               "ErrorColorLength",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "color": "fffff"}},
+			expectedParamError: param + ".color",
+		},
+		{
+			name:               "ErrorColorCharacters",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "color": "zzzzzz"}},
+			expectedParamError: param + ".color",
+		},
+		{
+			name:               "ErrorGravity",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "gravity": "invalid"}},
+			expectedParamError: param + ".gravity",
+		},
+		{
+			name:               "ErrorMargin",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "margin": -1}},
+			expectedParamError: param + ".margin",
+		},
+		{
+			name:               "ErrorWidth",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "width": -1}},
+			expectedParamError: param + ".width",
+		},
+		{
+			name:               "ErrorAlign",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "align": "invalid"}},
+			expectedParamError: param + ".align",
+		},
+		{
+			name:               "ErrorShadow",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "shadow": -1}},
+			expectedParamError: param + ".shadow",
+		},
+		{
+			name:               "ErrorShadowColor",
+			params:             imageserver.Params{param: imageserver.Params{"text": "Hello", "shadow_color": "invalid"}},
+			expectedParamError: param + ".shadow_color",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nim, err := prc.Process(newTestImage(), tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			changed := changedBounds(nim)
+			if tc.expectedChanged.Empty() {
+				if !changed.Empty() {
+					t.Fatalf("unexpected change: %s", changed)
+				}
+				return
+			}
+			if changed.Empty() {
+				t.Fatal("no change")
+			}
+			if !changed.In(tc.expectedChanged) {
+				t.Fatalf("unexpected changed bounds: got %s, want in %s", changed, tc.expectedChanged)
+			}
+		})
+	}
+}
+
+func changedBounds(nim image.Image) image.Rectangle {
+	var r image.Rectangle
+	bds := nim.Bounds()
+	for y := bds.Min.Y; y < bds.Max.Y; y++ {
+		for x := bds.Min.X; x < bds.Max.X; x++ {
+			if color.GrayModel.Convert(nim.At(x, y)).(color.Gray).Y != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestWrap(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 10, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := font.MeasureString(face, "aaaaa")
+	for _, tc := range []struct {
+		name     string
+		text     string
+		maxLines int
+		expected []string
+	}{
+		{
+			name:     "Short",
+			text:     "a a",
+			maxLines: 10,
+			expected: []string{"a a"},
+		},
+		{
+			name:     "Words",
+			text:     "aa aa aa",
+			maxLines: 10,
+			expected: []string{"aa aa", "aa"},
+		},
+		{
+			name:     "NewLine",
+			text:     "a\n\na",
+			maxLines: 10,
+			expected: []string{"a", "", "a"},
+		},
+		{
+			name:     "LongWord",
+			text:     "aaaaaaaaaaaa a",
+			maxLines: 10,
+			expected: []string{"aaaaa", "aaaaa", "aa a"},
+		},
+		{
+			name:     "MaxLines",
+			text:     strings.Repeat("aa ", 1000),
+			maxLines: 2,
+			expected: []string{"aa aa", "aa aa"},
+		},
+		{
+			name:     "MaxLinesLongWord",
+			text:     strings.Repeat("a", 1000),
+			maxLines: 2,
+			expected: []string{"aaaaa", "aaaaa"},
+		},
+		{
+			name:     "NoLines",
+			text:     "a",
+			maxLines: 0,
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := wrap(face, tc.text, width, tc.maxLines)
+			if strings.Join(lines, "|") != strings.Join(tc.expected, "|") || len(lines) != len(tc.expected) {
+				t.Fatalf("unexpected lines: got %q, want %q", lines, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBreakWordNarrow(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 10, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := breakWord(face, "éa", fixed.I(1))
+	if n != len("é") {
+		t.Fatalf("unexpected length: got %d, want %d", n, len("é"))
+	}
+}
+
+func TestChange(t *testing.T) {
+	prc := &Processor{}
+	if prc.Change(imageserver.Params{}) {
+		t.Fatal("not false")
+	}
+	if !prc.Change(imageserver.Params{param: imageserver.Params{}}) {
+		t.Fatal("not true")
+	}
+}
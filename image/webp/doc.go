@@ -0,0 +1,7 @@
+// Package webp provides a WebP imageserver/image.Encoder implementation.
+//
+// It also registers the WebP decoder for imageserver/image.Decode().
+//
+// It uses https://github.com/chai2010/webp (libwebp), so it requires cgo.
+// Without cgo, the package is empty and nothing is registered.
+package webp
@@ -0,0 +1,85 @@
+//go:build cgo
+
+package webp
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+// DefaultQuality is the default quality used by Encoder.
+const DefaultQuality = 75
+
+// Encoder is a WebP imageserver/image.Encoder implementation.
+//
+// It supports the params:
+//  - quality: 0 to 100, ignored if lossless is enabled
+//  - lossless: enables the lossless compression
+type Encoder struct {
+	DefaultQuality  int
+	DefaultLossless bool
+}
+
+// Encode implements imageserver/image.Encoder.
+func (enc *Encoder) Encode(w io.Writer, nim image.Image, params imageserver.Params) error {
+	opts, err := enc.getOptions(params)
+	if err != nil {
+		return err
+	}
+	return webp.Encode(w, nim, opts)
+}
+
+func (enc *Encoder) getOptions(params imageserver.Params) (*webp.Options, error) {
+	opts := &webp.Options{}
+	var err error
+	opts.Lossless, err = enc.getLossless(params)
+	if err != nil {
+		return nil, err
+	}
+	quality, err := enc.getQuality(params)
+	if err != nil {
+		return nil, err
+	}
+	opts.Quality = float32(quality)
+	return opts, nil
+}
+
+func (enc *Encoder) getQuality(params imageserver.Params) (int, error) {
+	if !params.Has("quality") {
+		if enc.DefaultQuality != 0 {
+			return enc.DefaultQuality, nil
+		}
+		return DefaultQuality, nil
+	}
+	quality, err := params.GetInt("quality")
+	if err != nil {
+		return 0, err
+	}
+	if quality < 0 {
+		return 0, &imageserver.ParamError{Param: "quality", Message: "must be greater than or equal to 0"}
+	}
+	if quality > 100 {
+		return 0, &imageserver.ParamError{Param: "quality", Message: "must be less than or equal to 100"}
+	}
+	return quality, nil
+}
+
+func (enc *Encoder) getLossless(params imageserver.Params) (bool, error) {
+	if !params.Has("lossless") {
+		return enc.DefaultLossless, nil
+	}
+	return params.GetBool("lossless")
+}
+
+// Change implements imageserver/image.Encoder.
+func (enc *Encoder) Change(params imageserver.Params) bool {
+	return params.Has("quality") || params.Has("lossless")
+}
+
+func init() {
+	imageserver_image.RegisterEncoder("webp", &Encoder{})
+}
@@ -0,0 +1,118 @@
+//go:build cgo
+
+package webp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	imageserver_image_test "github.com/pierrre/imageserver/image/_test"
+)
+
+var _ imageserver_image.Encoder = &Encoder{}
+
+func TestEncoder(t *testing.T) {
+	testEncoder(t, &Encoder{})
+}
+
+func TestEncoderDefaultQuality(t *testing.T) {
+	enc := &Encoder{
+		DefaultQuality: 90,
+	}
+	testEncoder(t, enc)
+}
+
+func TestEncoderDefaultLossless(t *testing.T) {
+	enc := &Encoder{
+		DefaultLossless: true,
+	}
+	testEncoder(t, enc)
+}
+
+func TestEncoderQuality(t *testing.T) {
+	params := imageserver.Params{
+		"quality": 90,
+	}
+	testEncoderParams(t, &Encoder{}, params)
+}
+
+func TestEncoderLossless(t *testing.T) {
+	params := imageserver.Params{
+		"lossless": true,
+	}
+	testEncoderParams(t, &Encoder{}, params)
+}
+
+func TestEncoderErrorQuality(t *testing.T) {
+	testEncoderError(t, "quality", []any{"foo", -1, 101})
+}
+
+func TestEncoderErrorLossless(t *testing.T) {
+	testEncoderError(t, "lossless", []any{"foo", 1})
+}
+
+func testEncoderError(t *testing.T, param string, values []any) {
+	im := imageserver_image_test.NewImage()
+	enc := &Encoder{}
+	for _, v := range values {
+		err := enc.Encode(io.Discard, im, imageserver.Params{param: v})
+		if err == nil {
+			t.Fatal("no error")
+		}
+		errParam, ok := err.(*imageserver.ParamError)
+		if !ok {
+			t.Fatalf("unexpected error type: %T", err)
+		}
+		if errParam.Param != param {
+			t.Fatalf("unexpected param: %s", errParam.Param)
+		}
+	}
+}
+
+func testEncoder(t *testing.T, enc *Encoder) {
+	imageserver_image_test.TestEncoder(t, enc, "webp")
+}
+
+func testEncoderParams(t *testing.T, enc *Encoder, params imageserver.Params) {
+	imageserver_image_test.TestEncoderParams(t, enc, params, "webp")
+}
+
+func TestEncoderChange(t *testing.T) {
+	c := (&Encoder{}).Change(imageserver.Params{})
+	if c {
+		t.Fatal("not false")
+	}
+}
+
+func TestEncoderChangeQuality(t *testing.T) {
+	c := (&Encoder{}).Change(imageserver.Params{"quality": 75})
+	if !c {
+		t.Fatal("not true")
+	}
+}
+
+func TestEncoderChangeLossless(t *testing.T) {
+	c := (&Encoder{}).Change(imageserver.Params{"lossless": true})
+	if !c {
+		t.Fatal("not true")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := (&Encoder{}).Encode(buf, imageserver_image_test.NewImage(), imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := &imageserver.Image{
+		Format: "webp",
+		Data:   buf.Bytes(),
+	}
+	_, err = imageserver_image.Decode(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
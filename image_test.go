@@ -1,11 +1,14 @@
 package imageserver_test
 
 import (
+	"bytes"
 	"encoding"
 	"encoding/binary"
+	"hash/crc32"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/pierrre/compare"
@@ -62,10 +65,7 @@ func TestImageMarshallErrorDataMaxLen(t *testing.T) {
 }
 
 func TestImageUnmarshalBinaryErrorEndOfData(t *testing.T) {
-	data, err := testdata.Medium.MarshalBinary()
-	if err != nil {
-		t.Fatal(err)
-	}
+	data := testMarshalV1(testdata.Medium)
 	index := -1 // Always truncate 1 byte
 	for _, offset := range []int{
 		4,
@@ -86,15 +86,29 @@ func TestImageUnmarshalBinaryErrorEndOfData(t *testing.T) {
 	}
 }
 
-func TestImageUnmarshalBinaryErrorFormatMaxLen(t *testing.T) {
-	data, err := testdata.Medium.MarshalBinary()
+func TestImageUnmarshalBinaryErrorEndOfDataV2(t *testing.T) {
+	data, err := testImageMetadata.MarshalBinary()
 	if err != nil {
 		t.Fatal(err)
 	}
+	for i := range len(data) {
+		im := new(Image)
+		err := im.UnmarshalBinary(data[:i])
+		if err == nil {
+			t.Fatalf("no error for length %d", i)
+		}
+		if _, ok := err.(*ImageError); !ok {
+			t.Fatalf("unexpected error type: %T", err)
+		}
+	}
+}
+
+func TestImageUnmarshalBinaryErrorFormatMaxLen(t *testing.T) {
+	data := testMarshalV1(testdata.Medium)
 	formatLenPosition := 0
 	binary.LittleEndian.PutUint32(data[formatLenPosition:formatLenPosition+4], uint32(ImageFormatMaxLen+1))
 	im := new(Image)
-	err = im.UnmarshalBinary(data)
+	err := im.UnmarshalBinary(data)
 	if err == nil {
 		t.Fatal("no error")
 	}
@@ -104,12 +118,98 @@ func TestImageUnmarshalBinaryErrorFormatMaxLen(t *testing.T) {
 }
 
 func TestImageUnmarshalBinaryErrorDataMaxLen(t *testing.T) {
-	data, err := testdata.Medium.MarshalBinary()
+	data := testMarshalV1(testdata.Medium)
+	dataLenPosition := 4 + len(testdata.Medium.Format)
+	binary.LittleEndian.PutUint32(data[dataLenPosition:dataLenPosition+4], uint32(ImageDataMaxLen+1))
+	im := new(Image)
+	err := im.UnmarshalBinary(data)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+}
+
+var testImageMetadata = &Image{
+	Format: testdata.Small.Format,
+	Data:   testdata.Small.Data,
+	Metadata: ImageMetadata{
+		Width:      100,
+		Height:     50,
+		SourceETag: "\"foo\"",
+		Created:    time.Unix(1500000000, 123),
+		Expires:    time.Unix(1500000060, 123),
+	},
+}
+
+func TestImageMarshalMetadata(t *testing.T) {
+	data, err := testImageMetadata.MarshalBinary()
 	if err != nil {
 		t.Fatal(err)
 	}
-	dataLenPosition := 4 + len(testdata.Medium.Format)
-	binary.LittleEndian.PutUint32(data[dataLenPosition:dataLenPosition+4], uint32(ImageDataMaxLen+1))
+	im := new(Image)
+	err = im.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != testImageMetadata.Format || !bytes.Equal(im.Data, testImageMetadata.Data) {
+		t.Fatal("images not equal")
+	}
+	if !im.Metadata.Created.Equal(testImageMetadata.Metadata.Created) {
+		t.Fatalf("unexpected Created: got %s, want %s", im.Metadata.Created, testImageMetadata.Metadata.Created)
+	}
+	if !im.Metadata.Expires.Equal(testImageMetadata.Metadata.Expires) {
+		t.Fatalf("unexpected Expires: got %s, want %s", im.Metadata.Expires, testImageMetadata.Metadata.Expires)
+	}
+	im.Metadata.Created = testImageMetadata.Metadata.Created
+	im.Metadata.Expires = testImageMetadata.Metadata.Expires
+	if im.Metadata != testImageMetadata.Metadata {
+		t.Fatalf("unexpected metadata: got %+v, want %+v", im.Metadata, testImageMetadata.Metadata)
+	}
+}
+
+func TestImageUnmarshalBinaryV1(t *testing.T) {
+	im := &Image{Metadata: ImageMetadata{Width: 1}}
+	err := im.UnmarshalBinary(testMarshalV1(testdata.Medium))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := compare.Compare(im, testdata.Medium)
+	if len(diff) != 0 {
+		t.Fatalf("images not equal, diff:\n%+v", diff)
+	}
+}
+
+func TestImageUnmarshalBinaryUnknownMetadata(t *testing.T) {
+	data, err := testdata.Small.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace the metadata fields count and the checksum by an unknown field.
+	data = data[:len(data)-6]
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 1000)
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	data = append(data, "foo"...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	im := new(Image)
+	err = im.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := compare.Compare(im, testdata.Small)
+	if len(diff) != 0 {
+		t.Fatalf("images not equal, diff:\n%+v", diff)
+	}
+}
+
+func TestImageUnmarshalBinaryErrorChecksum(t *testing.T) {
+	data, err := testdata.Small.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
 	im := new(Image)
 	err = im.UnmarshalBinary(data)
 	if err == nil {
@@ -120,6 +220,31 @@ func TestImageUnmarshalBinaryErrorDataMaxLen(t *testing.T) {
 	}
 }
 
+func TestImageUnmarshalBinaryErrorVersion(t *testing.T) {
+	data, err := testdata.Small.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[4] = 255
+	im := new(Image)
+	err = im.UnmarshalBinary(data)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+}
+
+// testMarshalV1 marshals the Image with the legacy encoding.
+func testMarshalV1(im *Image) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(im.Format)))
+	data = append(data, im.Format...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(im.Data)))
+	data = append(data, im.Data...)
+	return data
+}
+
 // TestImageMarshalBugBuffer is a test for a bug with a misused byte buffer pool.
 // Successive calls to Image.MarshalBinary() write to the same byte slice.
 func TestImageMarshalBugByteBufferPool(t *testing.T) {
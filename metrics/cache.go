@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+)
+
+// Cache results used in the "result" label.
+const (
+	CacheResultHit   = "hit"
+	CacheResultMiss  = "miss"
+	CacheResultOK    = "ok"
+	CacheResultError = "error"
+)
+
+// Cache is a imageserver/cache.Cache implementation that records metrics.
+//
+// It records the gets by result (hit, miss or error), the sets by result (ok or error), the duration and the Image size.
+//
+// It implements imageserver/cache.ContextCache.
+type Cache struct {
+	imageserver_cache.Cache
+
+	// Metrics records the metrics.
+	Metrics *Metrics
+
+	// Name is the value of the "name" label.
+	Name string
+}
+
+// Get implements imageserver/cache.Cache.
+func (c *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	return c.GetContext(context.Background(), key, params)
+}
+
+// GetContext implements imageserver/cache.ContextCache.
+func (c *Cache) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	start := time.Now()
+	im, err := imageserver_cache.GetContext(ctx, c.Cache, key, params)
+	c.Metrics.CacheDuration.Observe(time.Since(start).Seconds(), c.Name, "get")
+	switch {
+	case err != nil:
+		c.Metrics.CacheGets.Inc(c.Name, CacheResultError)
+	case im == nil:
+		c.Metrics.CacheGets.Inc(c.Name, CacheResultMiss)
+	default:
+		c.Metrics.CacheGets.Inc(c.Name, CacheResultHit)
+		c.Metrics.CacheBytesOut.Add(float64(len(im.Data)), c.Name)
+	}
+	return im, err
+}
+
+// Set implements imageserver/cache.Cache.
+func (c *Cache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
+	return c.SetContext(context.Background(), key, im, params)
+}
+
+// SetContext implements imageserver/cache.ContextCache.
+func (c *Cache) SetContext(ctx context.Context, key string, im *imageserver.Image, params imageserver.Params) error {
+	start := time.Now()
+	err := imageserver_cache.SetContext(ctx, c.Cache, key, im, params)
+	c.Metrics.CacheDuration.Observe(time.Since(start).Seconds(), c.Name, "set")
+	if err != nil {
+		c.Metrics.CacheSets.Inc(c.Name, CacheResultError)
+		return err
+	}
+	c.Metrics.CacheSets.Inc(c.Name, CacheResultOK)
+	c.Metrics.CacheBytesIn.Add(float64(len(im.Data)), c.Name)
+	return nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver_cache.ContextCache = &Cache{}
+
+func TestCache(t *testing.T) {
+	m := New("")
+	data := map[string]*imageserver.Image{}
+	c := &Cache{
+		Cache: &imageserver_cache.Func{
+			GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+				if key == "error" {
+					return nil, fmt.Errorf("error")
+				}
+				return data[key], nil
+			},
+			SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+				if key == "error" {
+					return fmt.Errorf("error")
+				}
+				data[key] = im
+				return nil
+			},
+		},
+		Metrics: m,
+		Name:    "memory",
+	}
+	_, _ = c.Get("foo", imageserver.Params{})
+	_ = c.Set("foo", testdata.Medium, imageserver.Params{})
+	_, _ = c.Get("foo", imageserver.Params{})
+	_, _ = c.Get("error", imageserver.Params{})
+	_ = c.Set("error", testdata.Medium, imageserver.Params{})
+	for _, tc := range []struct {
+		counter  *Counter
+		labels   []string
+		expected float64
+	}{
+		{counter: m.CacheGets, labels: []string{"memory", CacheResultHit}, expected: 1},
+		{counter: m.CacheGets, labels: []string{"memory", CacheResultMiss}, expected: 1},
+		{counter: m.CacheGets, labels: []string{"memory", CacheResultError}, expected: 1},
+		{counter: m.CacheSets, labels: []string{"memory", CacheResultOK}, expected: 1},
+		{counter: m.CacheSets, labels: []string{"memory", CacheResultError}, expected: 1},
+		{counter: m.CacheBytesIn, labels: []string{"memory"}, expected: float64(len(testdata.Medium.Data))},
+		{counter: m.CacheBytesOut, labels: []string{"memory"}, expected: float64(len(testdata.Medium.Data))},
+	} {
+		if v := tc.counter.Value(tc.labels...); v != tc.expected {
+			t.Fatalf("unexpected value for %s%q: got %v, want %v", tc.counter.name, tc.labels, v, tc.expected)
+		}
+	}
+	if c := m.CacheDuration.Count("memory", "get"); c != 3 {
+		t.Fatalf("unexpected duration count: got %d, want %d", c, 3)
+	}
+}
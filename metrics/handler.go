@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+// Handler is a imageserver.Handler implementation that records metrics.
+//
+// It records the requests count, the duration, the given and returned Image size and the errors by type.
+//
+// It implements imageserver.ContextHandler and imageserver.ChangeHandler.
+type Handler struct {
+	imageserver.Handler
+
+	// Metrics records the metrics.
+	Metrics *Metrics
+
+	// Name is the value of the "name" label.
+	Name string
+}
+
+// Handle implements imageserver.Handler.
+func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	hdr.Metrics.HandlerBytesIn.Add(float64(len(im.Data)), hdr.Name)
+	start := time.Now()
+	im, err := imageserver.HandleContext(ctx, hdr.Handler, im, params)
+	hdr.Metrics.HandlerDuration.Observe(time.Since(start).Seconds(), hdr.Name)
+	hdr.Metrics.HandlerRequests.Inc(hdr.Name)
+	if err != nil {
+		hdr.Metrics.HandlerErrors.Inc(hdr.Name, ErrorType(err))
+		return nil, err
+	}
+	hdr.Metrics.HandlerBytesOut.Add(float64(len(im.Data)), hdr.Name)
+	return im, nil
+}
+
+// Change implements imageserver.ChangeHandler.
+//
+// It returns true if the Handler doesn't implement imageserver.ChangeHandler.
+func (hdr *Handler) Change(format string, params imageserver.Params) bool {
+	ch, ok := hdr.Handler.(imageserver.ChangeHandler)
+	return !ok || ch.Change(format, params)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver.ContextHandler = &Handler{}
+
+var _ imageserver.ChangeHandler = &Handler{}
+
+func TestHandler(t *testing.T) {
+	m := New("")
+	hdr := &Handler{
+		Handler: imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+			if params.Has("error") {
+				return nil, &imageserver.ImageError{Message: "error"}
+			}
+			return testdata.Small, nil
+		}),
+		Metrics: m,
+		Name:    "image",
+	}
+	_, err := hdr.Handle(testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hdr.Handle(testdata.Medium, imageserver.Params{"error": true})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if v := m.HandlerRequests.Value("image"); v != 2 {
+		t.Fatalf("unexpected requests: got %v, want %v", v, 2)
+	}
+	if v := m.HandlerErrors.Value("image", ErrorTypeImage); v != 1 {
+		t.Fatalf("unexpected errors: got %v, want %v", v, 1)
+	}
+	if v := m.HandlerBytesIn.Value("image"); v != float64(2*len(testdata.Medium.Data)) {
+		t.Fatalf("unexpected bytes in: got %v, want %v", v, 2*len(testdata.Medium.Data))
+	}
+	if v := m.HandlerBytesOut.Value("image"); v != float64(len(testdata.Small.Data)) {
+		t.Fatalf("unexpected bytes out: got %v, want %v", v, len(testdata.Small.Data))
+	}
+}
+
+func TestHandlerChange(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		handler  imageserver.Handler
+		expected bool
+	}{
+		{
+			name: "NotChangeHandler",
+			handler: imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+				return im, nil
+			}),
+			expected: true,
+		},
+		{
+			name:     "Change",
+			handler:  &testChangeHandler{change: true},
+			expected: true,
+		},
+		{
+			name:     "NoChange",
+			handler:  &testChangeHandler{change: false},
+			expected: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hdr := &Handler{
+				Handler: tc.handler,
+				Metrics: New(""),
+			}
+			res := hdr.Change("jpeg", imageserver.Params{})
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", res, tc.expected)
+			}
+		})
+	}
+}
+
+type testChangeHandler struct {
+	imageserver.Handler
+	change bool
+}
+
+func (hdr *testChangeHandler) Change(format string, params imageserver.Params) bool {
+	return hdr.change
+}
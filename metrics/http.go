@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPHandler is a net/http.Handler implementation that records metrics.
+//
+// It records the requests count by method and status code, the duration and the response body size.
+// It is intended to wrap a imageserver/http.Handler.
+type HTTPHandler struct {
+	http.Handler
+
+	// Metrics records the metrics.
+	Metrics *Metrics
+
+	// Name is the value of the "name" label.
+	Name string
+}
+
+// ServeHTTP implements net/http.Handler.
+func (h *HTTPHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	mrw := &responseWriter{ResponseWriter: rw}
+	h.Handler.ServeHTTP(mrw, req)
+	if mrw.code == 0 {
+		mrw.code = http.StatusOK
+	}
+	h.Metrics.HTTPDuration.Observe(time.Since(start).Seconds(), h.Name)
+	h.Metrics.HTTPRequests.Inc(h.Name, req.Method, strconv.Itoa(mrw.code))
+	h.Metrics.HTTPBytesOut.Add(float64(mrw.size), h.Name)
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying net/http.ResponseWriter.
+// It is used by net/http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var _ http.Handler = &HTTPHandler{}
+
+func TestHTTPHandler(t *testing.T) {
+	m := New("")
+	h := &HTTPHandler{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Get("error") != "" {
+				http.Error(rw, "error", http.StatusBadRequest)
+				return
+			}
+			_, _ = rw.Write([]byte("foobar"))
+		}),
+		Metrics: m,
+		Name:    "image",
+	}
+	for _, u := range []string{"http://localhost", "http://localhost?error=1"} {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if v := m.HTTPRequests.Value("image", "GET", "200"); v != 1 {
+		t.Fatalf("unexpected requests: got %v, want %v", v, 1)
+	}
+	if v := m.HTTPRequests.Value("image", "GET", "400"); v != 1 {
+		t.Fatalf("unexpected requests: got %v, want %v", v, 1)
+	}
+	if v := m.HTTPBytesOut.Value("image"); v != 12 {
+		t.Fatalf("unexpected bytes: got %v, want %v", v, 12)
+	}
+}
+
+func TestHTTPHandlerResponseController(t *testing.T) {
+	h := &HTTPHandler{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			err := http.NewResponseController(rw).Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}),
+		Metrics: New(""),
+		Name:    "image",
+	}
+	req, err := http.NewRequest("GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !w.Flushed {
+		t.Fatal("not flushed")
+	}
+}
@@ -0,0 +1,361 @@
+// Package metrics provides instrumenting wrappers that record metrics, and exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pierrre/imageserver"
+)
+
+// DefaultBuckets are the default histogram buckets (in seconds).
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics holds the metrics recorded by the instrumenting wrappers.
+//
+// The metrics are labeled with the name of the wrapper, so a Metrics can be shared by several wrappers of the same type.
+//
+// It implements net/http.Handler and writes the metrics in the Prometheus text format.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/ .
+type Metrics struct {
+	ServerRequests *Counter
+	ServerErrors   *Counter
+	ServerDuration *Histogram
+	ServerBytesOut *Counter
+
+	HandlerRequests *Counter
+	HandlerErrors   *Counter
+	HandlerDuration *Histogram
+	HandlerBytesIn  *Counter
+	HandlerBytesOut *Counter
+
+	CacheGets     *Counter
+	CacheSets     *Counter
+	CacheDuration *Histogram
+	CacheBytesIn  *Counter
+	CacheBytesOut *Counter
+
+	HTTPRequests *Counter
+	HTTPDuration *Histogram
+	HTTPBytesOut *Counter
+
+	collectors []collector
+}
+
+// New returns a new Metrics.
+//
+// The metric names are prefixed with namespace and "_" if it is not empty.
+func New(namespace string) *Metrics {
+	m := &Metrics{}
+	name := func(n string) string {
+		if namespace != "" {
+			return namespace + "_" + n
+		}
+		return n
+	}
+	m.ServerRequests = m.counter(name("server_requests_total"), "Total number of Server requests.", "name")
+	m.ServerErrors = m.counter(name("server_errors_total"), "Total number of Server errors by type.", "name", "type")
+	m.ServerDuration = m.histogram(name("server_duration_seconds"), "Server request duration in seconds.", "name")
+	m.ServerBytesOut = m.counter(name("server_bytes_out_total"), "Total number of Image bytes returned by the Server.", "name")
+	m.HandlerRequests = m.counter(name("handler_requests_total"), "Total number of Handler requests.", "name")
+	m.HandlerErrors = m.counter(name("handler_errors_total"), "Total number of Handler errors by type.", "name", "type")
+	m.HandlerDuration = m.histogram(name("handler_duration_seconds"), "Handler request duration in seconds.", "name")
+	m.HandlerBytesIn = m.counter(name("handler_bytes_in_total"), "Total number of Image bytes given to the Handler.", "name")
+	m.HandlerBytesOut = m.counter(name("handler_bytes_out_total"), "Total number of Image bytes returned by the Handler.", "name")
+	m.CacheGets = m.counter(name("cache_gets_total"), "Total number of Cache gets by result (hit, miss or error).", "name", "result")
+	m.CacheSets = m.counter(name("cache_sets_total"), "Total number of Cache sets by result (ok or error).", "name", "result")
+	m.CacheDuration = m.histogram(name("cache_duration_seconds"), "Cache operation duration in seconds.", "name", "operation")
+	m.CacheBytesIn = m.counter(name("cache_bytes_in_total"), "Total number of Image bytes set to the Cache.", "name")
+	m.CacheBytesOut = m.counter(name("cache_bytes_out_total"), "Total number of Image bytes returned by the Cache.", "name")
+	m.HTTPRequests = m.counter(name("http_requests_total"), "Total number of HTTP requests by method and status code.", "name", "method", "code")
+	m.HTTPDuration = m.histogram(name("http_duration_seconds"), "HTTP request duration in seconds.", "name")
+	m.HTTPBytesOut = m.counter(name("http_bytes_out_total"), "Total number of HTTP response body bytes.", "name")
+	return m
+}
+
+func (m *Metrics) counter(name, help string, labels ...string) *Counter {
+	c := NewCounter(name, help, labels...)
+	m.collectors = append(m.collectors, c)
+	return c
+}
+
+func (m *Metrics) histogram(name, help string, labels ...string) *Histogram {
+	h := NewHistogram(name, help, DefaultBuckets, labels...)
+	m.collectors = append(m.collectors, h)
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(rw)
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (m *Metrics) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range m.collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type metric struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (m *metric) writeHeader(w *bufio.Writer, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, escapeHelp(m.help), m.name, typ)
+}
+
+func (m *metric) checkLabelValues(values []string) {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", m.name, len(values), len(m.labels)))
+	}
+}
+
+// Counter is a counter metric with labels.
+type Counter struct {
+	metric
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounter returns a new Counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		metric: metric{name: name, help: help, labels: labels},
+		values: make(map[string]*counterValue),
+	}
+}
+
+// Add adds v to the counter identified by the label values.
+//
+// The number of label values must match the number of labels, otherwise it panics.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.checkLabelValues(labelValues)
+	k := labelsKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.values[k]
+	if !ok {
+		cv = &counterValue{labels: slices.Clone(labelValues)}
+		c.values[k] = cv
+	}
+	cv.value += v
+}
+
+// Inc increments the counter identified by the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the value of the counter identified by the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.values[labelsKey(labelValues)]
+	if !ok {
+		return 0
+	}
+	return cv.value
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, k := range sortedKeys(c.values) {
+		cv := c.values[k]
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, cv.labels, "", ""), formatFloat(cv.value))
+	}
+}
+
+// Histogram is a histogram metric with labels.
+type Histogram struct {
+	metric
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a new Histogram.
+//
+// The buckets are the upper bounds, and must be sorted in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		metric:  metric{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe adds an observation to the histogram identified by the label values.
+//
+// The number of label values must match the number of labels, otherwise it panics.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.checkLabelValues(labelValues)
+	k := labelsKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &histogramValue{
+			labels: slices.Clone(labelValues),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[k] = hv
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of observations of the histogram identified by the label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[labelsKey(labelValues)]
+	if !ok {
+		return 0
+	}
+	return hv.count
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+		for i, b := range h.buckets {
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hv.labels, "le", formatFloat(b)), hv.counts[i])
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hv.labels, "le", "+Inf"), hv.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, hv.labels, "", ""), formatFloat(hv.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, hv.labels, "", ""), hv.count)
+	}
+}
+
+func labelsKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(n)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(values[i]))
+		sb.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Error types used in the "type" label.
+const (
+	ErrorTypeParam    = "param"
+	ErrorTypeImage    = "image"
+	ErrorTypeCanceled = "canceled"
+	ErrorTypeInternal = "internal"
+)
+
+// ErrorType returns the type of the error, used in the "type" label.
+//
+// The wrapped errors are supported.
+func ErrorType(err error) string {
+	var paramErr *imageserver.ParamError
+	if errors.As(err, &paramErr) {
+		return ErrorTypeParam
+	}
+	var imageErr *imageserver.ImageError
+	if errors.As(err, &imageErr) {
+		return ErrorTypeImage
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTypeCanceled
+	}
+	return ErrorTypeInternal
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+)
+
+var _ http.Handler = &Metrics{}
+
+func TestMetricsWrite(t *testing.T) {
+	m := New("test")
+	m.ServerRequests.Inc("foo")
+	m.ServerRequests.Add(2, "foo")
+	m.ServerErrors.Inc("foo", `a"b\c`)
+	m.ServerDuration.Observe(0.02, "foo")
+	m.ServerDuration.Observe(20, "foo")
+	buf := new(bytes.Buffer)
+	err := m.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		"# HELP test_server_requests_total Total number of Server requests.\n",
+		"# TYPE test_server_requests_total counter\n",
+		"test_server_requests_total{name=\"foo\"} 3\n",
+		"test_server_errors_total{name=\"foo\",type=\"a\\\"b\\\\c\"} 1\n",
+		"# TYPE test_server_duration_seconds histogram\n",
+		"test_server_duration_seconds_bucket{name=\"foo\",le=\"0.01\"} 0\n",
+		"test_server_duration_seconds_bucket{name=\"foo\",le=\"0.025\"} 1\n",
+		"test_server_duration_seconds_bucket{name=\"foo\",le=\"10\"} 1\n",
+		"test_server_duration_seconds_bucket{name=\"foo\",le=\"+Inf\"} 2\n",
+		"test_server_duration_seconds_sum{name=\"foo\"} 20.02\n",
+		"test_server_duration_seconds_count{name=\"foo\"} 2\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("output doesn't contain %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestMetricsServeHTTP(t *testing.T) {
+	m := New("")
+	m.HTTPRequests.Inc("foo", "GET", "200")
+	rw := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://localhost/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusOK)
+	}
+	if ct := rw.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("unexpected Content-Type: %q", ct)
+	}
+	want := "http_requests_total{name=\"foo\",method=\"GET\",code=\"200\"} 1\n"
+	if !strings.Contains(rw.Body.String(), want) {
+		t.Fatalf("output doesn't contain %q:\n%s", want, rw.Body.String())
+	}
+}
+
+func TestCounterNoLabels(t *testing.T) {
+	c := NewCounter("foo", "help")
+	c.Inc()
+	buf := new(bytes.Buffer)
+	m := &Metrics{collectors: []collector{c}}
+	err := m.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nfoo 1\n") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestCounterPanicLabelValues(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	NewCounter("foo", "help", "a").Inc()
+}
+
+func TestFormatFloat(t *testing.T) {
+	for _, tc := range []struct {
+		v        float64
+		expected string
+	}{
+		{v: 1, expected: "1"},
+		{v: 0.5, expected: "0.5"},
+		{v: math.Inf(1), expected: "+Inf"},
+		{v: math.Inf(-1), expected: "-Inf"},
+		{v: math.NaN(), expected: "NaN"},
+	} {
+		if s := formatFloat(tc.v); s != tc.expected {
+			t.Fatalf("unexpected result: got %q, want %q", s, tc.expected)
+		}
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{err: &imageserver.ParamError{}, expected: ErrorTypeParam},
+		{err: &imageserver.ImageError{}, expected: ErrorTypeImage},
+		{err: context.Canceled, expected: ErrorTypeCanceled},
+		{err: context.DeadlineExceeded, expected: ErrorTypeCanceled},
+		{err: fmt.Errorf("error"), expected: ErrorTypeInternal},
+		{err: fmt.Errorf("wrapped: %w", &imageserver.ParamError{}), expected: ErrorTypeParam},
+		{err: fmt.Errorf("wrapped: %w", &imageserver.ImageError{}), expected: ErrorTypeImage},
+		{err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), expected: ErrorTypeCanceled},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			if typ := ErrorType(tc.err); typ != tc.expected {
+				t.Fatalf("unexpected type: got %q, want %q", typ, tc.expected)
+			}
+		})
+	}
+}
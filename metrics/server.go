@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+// Server is a imageserver.Server implementation that records metrics.
+//
+// It records the requests count, the duration, the returned Image size and the errors by type.
+//
+// It implements imageserver.ContextServer and imageserver.StreamServer.
+// With GetStream(), the returned Image size is recorded while the Stream Body is read.
+type Server struct {
+	imageserver.Server
+
+	// Metrics records the metrics.
+	Metrics *Metrics
+
+	// Name is the value of the "name" label.
+	Name string
+}
+
+// Get implements imageserver.Server.
+func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	start := time.Now()
+	im, err := imageserver.GetContext(ctx, srv.Server, params)
+	srv.Metrics.ServerDuration.Observe(time.Since(start).Seconds(), srv.Name)
+	srv.Metrics.ServerRequests.Inc(srv.Name)
+	if err != nil {
+		srv.Metrics.ServerErrors.Inc(srv.Name, ErrorType(err))
+		return nil, err
+	}
+	srv.Metrics.ServerBytesOut.Add(float64(len(im.Data)), srv.Name)
+	return im, nil
+}
+
+// GetStream implements imageserver.StreamServer.
+func (srv *Server) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	start := time.Now()
+	st, err := imageserver.GetStream(ctx, srv.Server, params)
+	srv.Metrics.ServerDuration.Observe(time.Since(start).Seconds(), srv.Name)
+	srv.Metrics.ServerRequests.Inc(srv.Name)
+	if err != nil {
+		srv.Metrics.ServerErrors.Inc(srv.Name, ErrorType(err))
+		return nil, err
+	}
+	st.Body = &countReadCloser{
+		ReadCloser: st.Body,
+		counter:    srv.Metrics.ServerBytesOut,
+		name:       srv.Name,
+	}
+	return st, nil
+}
+
+// countReadCloser is a io.ReadCloser that adds the read bytes count to a Counter.
+type countReadCloser struct {
+	io.ReadCloser
+	counter *Counter
+	name    string
+}
+
+func (rc *countReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if n > 0 {
+		rc.counter.Add(float64(n), rc.name)
+	}
+	return n, err
+}
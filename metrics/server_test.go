@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver.ContextServer = &Server{}
+
+var _ imageserver.StreamServer = &Server{}
+
+func TestServer(t *testing.T) {
+	m := New("")
+	srv := &Server{
+		Server:  testdata.Server,
+		Metrics: m,
+		Name:    "source",
+	}
+	_, err := srv.Get(imageserver.Params{"source": testdata.MediumFileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = srv.Get(imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if v := m.ServerRequests.Value("source"); v != 2 {
+		t.Fatalf("unexpected requests: got %v, want %v", v, 2)
+	}
+	if v := m.ServerErrors.Value("source", ErrorTypeParam); v != 1 {
+		t.Fatalf("unexpected errors: got %v, want %v", v, 1)
+	}
+	if v := m.ServerBytesOut.Value("source"); v != float64(len(testdata.Medium.Data)) {
+		t.Fatalf("unexpected bytes: got %v, want %v", v, len(testdata.Medium.Data))
+	}
+	if c := m.ServerDuration.Count("source"); c != 2 {
+		t.Fatalf("unexpected duration count: got %d, want %d", c, 2)
+	}
+}
+
+func TestServerGetStream(t *testing.T) {
+	m := New("")
+	srv := &Server{
+		Server:  testdata.Server,
+		Metrics: m,
+		Name:    "source",
+	}
+	st, err := srv.GetStream(t.Context(), imageserver.Params{"source": testdata.MediumFileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(st.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(testdata.Medium.Data) {
+		t.Fatalf("unexpected data length: got %d, want %d", len(data), len(testdata.Medium.Data))
+	}
+	_, err = srv.GetStream(t.Context(), imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if v := m.ServerRequests.Value("source"); v != 2 {
+		t.Fatalf("unexpected requests: got %v, want %v", v, 2)
+	}
+	if v := m.ServerErrors.Value("source", ErrorTypeParam); v != 1 {
+		t.Fatalf("unexpected errors: got %v, want %v", v, 1)
+	}
+	if v := m.ServerBytesOut.Value("source"); v != float64(len(testdata.Medium.Data)) {
+		t.Fatalf("unexpected bytes: got %v, want %v", v, len(testdata.Medium.Data))
+	}
+	if c := m.ServerDuration.Count("source"); c != 2 {
+		t.Fatalf("unexpected duration count: got %d, want %d", c, 2)
+	}
+}
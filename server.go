@@ -1,6 +1,10 @@
 // Package imageserver provides an Image server toolkit.
 package imageserver
 
+import (
+	"context"
+)
+
 // Server serves an Image.
 type Server interface {
 	Get(Params) (*Image, error)
@@ -14,9 +18,48 @@ func (f ServerFunc) Get(params Params) (*Image, error) {
 	return f(params)
 }
 
+// ContextServer is a Server that supports a context.Context.
+//
+// The context can be used to cancel the execution, set a deadline or carry request scoped values.
+type ContextServer interface {
+	Server
+	GetContext(context.Context, Params) (*Image, error)
+}
+
+// ContextServerFunc is a ContextServer func.
+type ContextServerFunc func(context.Context, Params) (*Image, error)
+
+// Get implements Server.
+//
+// It uses context.Background().
+func (f ContextServerFunc) Get(params Params) (*Image, error) {
+	return f(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (f ContextServerFunc) GetContext(ctx context.Context, params Params) (*Image, error) {
+	return f(ctx, params)
+}
+
+// GetContext gets the Image from the Server with a context.Context.
+//
+// If the Server implements ContextServer, it calls GetContext().
+// Otherwise it returns the context error if the context is done, or calls Get().
+func GetContext(ctx context.Context, srv Server, params Params) (*Image, error) {
+	if srv, ok := srv.(ContextServer); ok {
+		return srv.GetContext(ctx, params)
+	}
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return srv.Get(params)
+}
+
 // NewLimitServer creates a new Server that limits the number of concurrent executions.
 //
 // It uses a buffered channel to limit the number of concurrent executions.
+// The returned Server implements ContextServer, and stops waiting if the context is done.
 func NewLimitServer(s Server, limit int) Server {
 	return &limitServer{
 		Server:  s,
@@ -30,9 +73,17 @@ type limitServer struct {
 }
 
 func (s *limitServer) Get(params Params) (*Image, error) {
-	s.limitCh <- struct{}{}
+	return s.GetContext(context.Background(), params)
+}
+
+func (s *limitServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	select {
+	case s.limitCh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	defer func() {
 		<-s.limitCh
 	}()
-	return s.Server.Get(params)
+	return GetContext(ctx, s.Server, params)
 }
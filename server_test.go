@@ -1,6 +1,9 @@
 package imageserver
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 var _ Server = ServerFunc(nil)
 
@@ -33,3 +36,60 @@ func TestNewLimitServerZero(t *testing.T) {
 		return &Image{}, nil
 	}), 0)
 }
+
+func TestNewLimitServerContextCanceled(t *testing.T) {
+	srv := NewLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		return &Image{}, nil
+	}), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := GetContext(ctx, srv, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+var _ ContextServer = ContextServerFunc(nil)
+
+func TestContextServerFunc(t *testing.T) {
+	called := false
+	srv := ContextServerFunc(func(ctx context.Context, params Params) (*Image, error) {
+		if ctx == nil {
+			t.Fatal("nil context")
+		}
+		called = true
+		return &Image{}, nil
+	})
+	_, _ = srv.Get(Params{})
+	if !called {
+		t.Fatal("not called")
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	called := false
+	srv := ServerFunc(func(params Params) (*Image, error) {
+		called = true
+		return &Image{}, nil
+	})
+	_, err := GetContext(context.Background(), srv, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("not called")
+	}
+}
+
+func TestGetContextCanceled(t *testing.T) {
+	srv := ServerFunc(func(params Params) (*Image, error) {
+		t.Fatal("called")
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := GetContext(ctx, srv, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -2,7 +2,9 @@
 package file
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"mime"
 	"os"
 	"path"
@@ -11,18 +13,22 @@ import (
 
 	"github.com/pierrre/imageserver"
 	imageserver_source "github.com/pierrre/imageserver/source"
+	imageserver_source_identify "github.com/pierrre/imageserver/source/identify"
 )
 
 // Server is a imageserver.Server implementation that get the Image from a file.
 //
 // It takes the "source" param and loads it from the Root directory.
 // It expects a slash separated path.
+//
+// It implements imageserver.StreamServer.
 type Server struct {
 	// Root is the directory where images are loaded from.
 	Root string
 
 	// Identify identifies the Image format.
-	// By default, it uses IdentifyMime().
+	// By default, it uses IdentifyMagic(), then IdentifyMime().
+	// With GetStream(), data contains only the first StreamIdentifySize bytes of the file.
 	Identify func(pth string, data []byte) (format string, err error)
 }
 
@@ -46,6 +52,41 @@ func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
 	}, nil
 }
 
+// StreamIdentifySize is the number of bytes given to Server.Identify by GetStream().
+const StreamIdentifySize = 512
+
+// GetStream implements imageserver.StreamServer.
+func (srv *Server) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	pth, err := srv.getPath(params)
+	if err != nil {
+		return nil, err
+	}
+	f, size, err := openFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, StreamIdentifySize)
+	n, err := io.ReadFull(f, data)
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, newSourceError(fmt.Sprintf("error while reading file: %s: %s", pth, err.Error()))
+	}
+	format, err := srv.identify(pth, data[:n])
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	// The file is returned as is, so the body is seekable and supports the range requests.
+	return &imageserver.Stream{
+		Format: format,
+		Body:   f,
+		Size:   size,
+	}, nil
+}
+
 func (srv *Server) getPath(params imageserver.Params) (string, error) {
 	src, err := params.GetString(imageserver_source.Param)
 	if err != nil {
@@ -64,10 +105,27 @@ func loadFile(pth string) ([]byte, error) {
 	return data, nil
 }
 
+func openFile(pth string) (*os.File, int64, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return nil, 0, newSourceError(fmt.Sprintf("error while opening file: %s: %s", pth, err.Error()))
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, newSourceError(fmt.Sprintf("error while reading file: %s: %s", pth, err.Error()))
+	}
+	if fi.IsDir() {
+		_ = f.Close()
+		return nil, 0, newSourceError(fmt.Sprintf("error while reading file: %s: is a directory", pth))
+	}
+	return f, fi.Size(), nil
+}
+
 func (srv *Server) identify(pth string, data []byte) (format string, err error) {
 	idf := srv.Identify
 	if idf == nil {
-		idf = IdentifyMime
+		idf = identifyDefault
 	}
 	format, err = idf(pth, data)
 	if err != nil {
@@ -83,6 +141,13 @@ func newSourceError(msg string) error {
 	}
 }
 
+var identifyDefault = imageserver_source_identify.Chain(IdentifyMagic, IdentifyMime)
+
+// IdentifyMagic identifies the Image format from the data, with imageserver/source/identify.Magic().
+func IdentifyMagic(pth string, data []byte) (format string, err error) {
+	return imageserver_source_identify.Magic(data)
+}
+
 // IdentifyMime identifies the Image format with the "mime" package.
 func IdentifyMime(pth string, data []byte) (format string, err error) {
 	ext := filepath.Ext(pth)
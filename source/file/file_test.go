@@ -2,6 +2,9 @@ package file
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -10,7 +13,7 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver.Server = &Server{}
+var _ imageserver.StreamServer = &Server{}
 
 func TestServerGet(t *testing.T) {
 	srv := &Server{
@@ -176,3 +179,110 @@ func TestIdentifyMime(t *testing.T) {
 		})
 	}
 }
+
+func TestServerGetStream(t *testing.T) {
+	srv := &Server{
+		Root: testdata.Dir,
+	}
+	for _, tc := range []struct {
+		name               string
+		params             imageserver.Params
+		expectedParamError string
+		expectedImage      *imageserver.Image
+	}{
+		{
+			name: "Normal",
+			params: imageserver.Params{
+				imageserver_source.Param: testdata.MediumFileName,
+			},
+			expectedImage: testdata.Medium,
+		},
+		{
+			name:               "ErrorNoParam",
+			params:             imageserver.Params{},
+			expectedParamError: imageserver_source.Param,
+		},
+		{
+			name: "ErrorNotFound",
+			params: imageserver.Params{
+				imageserver_source.Param: "invalid",
+			},
+			expectedParamError: imageserver_source.Param,
+		},
+		{
+			name: "ErrorDirectory",
+			params: imageserver.Params{
+				imageserver_source.Param: "/",
+			},
+			expectedParamError: imageserver_source.Param,
+		},
+		{
+			name: "ErrorIdentify",
+			params: imageserver.Params{
+				imageserver_source.Param: "testdata.go",
+			},
+			expectedParamError: imageserver_source.Param,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			st, err := srv.GetStream(context.Background(), tc.params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = st.Body.Close()
+			}()
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if st.Format != tc.expectedImage.Format {
+				t.Fatalf("unexpected format: got %s, want %s", st.Format, tc.expectedImage.Format)
+			}
+			if st.Size != int64(len(tc.expectedImage.Data)) {
+				t.Fatalf("unexpected size: got %d, want %d", st.Size, len(tc.expectedImage.Data))
+			}
+			data, err := io.ReadAll(st.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tc.expectedImage.Data) {
+				t.Fatal("data not equal")
+			}
+		})
+	}
+}
+
+func TestServerGetMisnamed(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "image.jpg"), testdata.Random.Data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Root: dir,
+	}
+	im, err := srv.Get(imageserver.Params{imageserver_source.Param: "image.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != testdata.Random.Format {
+		t.Fatalf("unexpected format: got %s, want %s", im.Format, testdata.Random.Format)
+	}
+}
+
+func TestIdentifyMagic(t *testing.T) {
+	format, err := IdentifyMagic("image.bin", testdata.Medium.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != testdata.Medium.Format {
+		t.Fatalf("unexpected format: got %s, want %s", format, testdata.Medium.Format)
+	}
+	_, err = IdentifyMagic("image.jpg", []byte("invalid"))
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
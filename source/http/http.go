@@ -2,39 +2,63 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/pierrre/imageserver"
 	imageserver_source "github.com/pierrre/imageserver/source"
+	imageserver_source_identify "github.com/pierrre/imageserver/source/identify"
 )
 
 // Server is a imageserver.Server implementation that gets the Image from an HTTP URL.
 //
 // It parses the "source" param as URL, then do a GET request.
 // It returns an error if the HTTP status code is not 200 (OK).
+//
+// It implements imageserver.ContextServer, and the request is canceled if the context is done.
+// It implements imageserver.StreamServer, and the Stream size is the response "Content-Length".
+//
+// The requests are not restricted by default, see Policy.
 type Server struct {
 	// Client is an optional HTTP client.
 	// http.DefaultClient is used by default.
 	Client *http.Client
 
+	// Policy is an optional Policy that restricts the requests.
+	// If it is set, the HTTP client is created with Policy.NewClient(Client), and its error is returned by the requests.
+	Policy *Policy
+
 	// Identify identifies the Image format.
-	// By default, it uses IdentifyHeader().
+	// By default, it uses IdentifyMagic(), then IdentifyHeader().
+	// With GetStream(), data contains only the first StreamIdentifySize bytes of the body.
 	Identify func(resp *http.Response, data []byte) (format string, err error)
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
 }
 
 // Get implements imageserver.Server.
 func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
-	resp, err := srv.doRequest(params)
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	resp, err := srv.doRequest(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
-	data, err := loadData(resp)
+	data, err := srv.loadData(ctx, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -45,49 +69,157 @@ func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
 	return &imageserver.Image{
 		Format: format,
 		Data:   data,
+		Metadata: imageserver.ImageMetadata{
+			SourceETag: resp.Header.Get("ETag"),
+		},
+	}, nil
+}
+
+// StreamIdentifySize is the number of bytes given to Server.Identify by GetStream().
+const StreamIdentifySize = 512
+
+// GetStream implements imageserver.StreamServer.
+func (srv *Server) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
+	resp, err := srv.doRequest(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	st, err := srv.newStream(ctx, resp)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (srv *Server) newStream(ctx context.Context, resp *http.Response) (*imageserver.Stream, error) {
+	err := srv.checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	body := srv.limitBody(resp.Body)
+	br := bufio.NewReaderSize(body, StreamIdentifySize)
+	data, err := br.Peek(StreamIdentifySize)
+	if err != nil && err != io.EOF {
+		return nil, newDownloadError(ctx, err)
+	}
+	format, err := srv.identify(resp, data)
+	if err != nil {
+		return nil, err
+	}
+	return &imageserver.Stream{
+		Format: format,
+		Body: &readCloser{
+			Reader: br,
+			Closer: body,
+		},
+		Size: resp.ContentLength,
 	}, nil
 }
 
-func (srv *Server) doRequest(params imageserver.Params) (*http.Response, error) {
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (srv *Server) doRequest(ctx context.Context, params imageserver.Params) (*http.Response, error) {
 	src, err := params.GetString(imageserver_source.Param)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("GET", src, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
 	if err != nil {
 		return nil, newSourceError(err.Error())
 	}
-	c := srv.Client
-	if c == nil {
-		c = http.DefaultClient
+	if srv.Policy != nil {
+		err = srv.Policy.CheckURL(req.URL)
+		if err != nil {
+			return nil, newSourceError(err.Error())
+		}
+	}
+	client, err := srv.getClient()
+	if err != nil {
+		return nil, err
 	}
-	response, err := c.Do(req)
+	response, err := client.Do(req)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, newSourceError(err.Error())
 	}
 	return response, nil
 }
 
-func loadData(resp *http.Response) ([]byte, error) {
+func (srv *Server) getClient() (*http.Client, error) {
+	srv.clientOnce.Do(func() {
+		srv.client = srv.Client
+		if srv.Policy != nil {
+			srv.client, srv.clientErr = srv.Policy.NewClient(srv.Client)
+		}
+		if srv.client == nil {
+			srv.client = http.DefaultClient
+		}
+	})
+	return srv.client, srv.clientErr
+}
+
+func (srv *Server) checkResponse(resp *http.Response) error {
 	if resp.StatusCode != http.StatusOK {
-		return nil, newSourceError(fmt.Sprintf("HTTP status code %d while downloading", resp.StatusCode))
+		return newSourceError(fmt.Sprintf("HTTP status code %d while downloading", resp.StatusCode))
+	}
+	if srv.Policy != nil && srv.Policy.MaxBodySize > 0 && resp.ContentLength > srv.Policy.MaxBodySize {
+		return newSourceError(fmt.Sprintf("response body size %d exceeds the maximum %d", resp.ContentLength, srv.Policy.MaxBodySize))
+	}
+	return nil
+}
+
+// limitBody limits the size of the body to Policy.MaxBodySize.
+func (srv *Server) limitBody(body io.ReadCloser) io.ReadCloser {
+	if srv.Policy == nil || srv.Policy.MaxBodySize <= 0 {
+		return body
 	}
-	data, err := io.ReadAll(resp.Body)
+	return http.MaxBytesReader(nil, body, srv.Policy.MaxBodySize)
+}
+
+func (srv *Server) loadData(ctx context.Context, resp *http.Response) ([]byte, error) {
+	err := srv.checkResponse(resp)
 	if err != nil {
-		return nil, newSourceError(fmt.Sprintf("error while downloading: %s", err))
+		return nil, err
+	}
+	data, err := io.ReadAll(srv.limitBody(resp.Body))
+	if err != nil {
+		return nil, newDownloadError(ctx, err)
 	}
 	return data, nil
 }
 
+func newDownloadError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return newSourceError(fmt.Sprintf("response body exceeds the maximum size %d", maxErr.Limit))
+	}
+	return newSourceError(fmt.Sprintf("error while downloading: %s", err))
+}
+
 func (srv *Server) identify(resp *http.Response, data []byte) (format string, err error) {
 	idf := srv.Identify
 	if idf == nil {
-		idf = IdentifyHeader
+		idf = identifyDefault
 	}
 	format, err = idf(resp, data)
 	if err != nil {
 		return "", newSourceError(fmt.Sprintf("unable to identify image format: %s", err.Error()))
 	}
+	if srv.Policy != nil && srv.Policy.SniffContent {
+		err = checkSniff(data, format)
+		if err != nil {
+			return "", newSourceError(err.Error())
+		}
+	}
 	return format, nil
 }
 
@@ -98,6 +230,13 @@ func newSourceError(msg string) error {
 	}
 }
 
+var identifyDefault = imageserver_source_identify.Chain(IdentifyMagic, IdentifyHeader)
+
+// IdentifyMagic identifies the Image format from the data, with imageserver/source/identify.Magic().
+func IdentifyMagic(resp *http.Response, data []byte) (format string, err error) {
+	return imageserver_source_identify.Magic(data)
+}
+
 // IdentifyHeader identifies the Image format with the "Content-Type" header.
 func IdentifyHeader(resp *http.Response, data []byte) (format string, err error) {
 	ct := resp.Header.Get("Content-Type")
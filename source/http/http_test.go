@@ -2,7 +2,9 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,7 +14,9 @@ import (
 	"github.com/pierrre/imageserver/testdata"
 )
 
-var _ imageserver.Server = &Server{}
+var _ imageserver.ContextServer = &Server{}
+
+var _ imageserver.StreamServer = &Server{}
 
 func TestServerGet(t *testing.T) {
 	srv := &Server{}
@@ -104,7 +108,8 @@ func TestLoadDataError(t *testing.T) {
 		StatusCode: http.StatusOK,
 		Body:       &errorReadCloser{},
 	}
-	_, err := loadData(resp)
+	srv := &Server{}
+	_, err := srv.loadData(context.Background(), resp)
 	if err == nil {
 		t.Fatal("no error")
 	}
@@ -202,3 +207,103 @@ func TestIdentifyHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestServerGetContextCanceled(t *testing.T) {
+	srv := &Server{}
+	httpSrv := createTestHTTPServer()
+	defer httpSrv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := srv.GetContext(ctx, imageserver.Params{
+		imageserver_source.Param: createTestSource(httpSrv, testdata.MediumFileName),
+	})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestServerGetStream(t *testing.T) {
+	srv := &Server{}
+	httpSrv := createTestHTTPServer()
+	defer httpSrv.Close()
+	st, err := srv.GetStream(context.Background(), imageserver.Params{
+		imageserver_source.Param: createTestSource(httpSrv, testdata.MediumFileName),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = st.Body.Close()
+	}()
+	if st.Format != testdata.Medium.Format {
+		t.Fatalf("unexpected format: got %s, want %s", st.Format, testdata.Medium.Format)
+	}
+	if st.Size != int64(len(testdata.Medium.Data)) {
+		t.Fatalf("unexpected size: got %d, want %d", st.Size, len(testdata.Medium.Data))
+	}
+	data, err := io.ReadAll(st.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata.Medium.Data) {
+		t.Fatal("data not equal")
+	}
+}
+
+func TestServerGetStreamErrorNotFound(t *testing.T) {
+	srv := &Server{}
+	httpSrv := createTestHTTPServer()
+	defer httpSrv.Close()
+	_, err := srv.GetStream(context.Background(), imageserver.Params{
+		imageserver_source.Param: createTestSource(httpSrv, testdata.MediumFileName) + "foobar",
+	})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestServerGetOctetStream(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(testdata.Random.Data)
+	}))
+	defer httpSrv.Close()
+	srv := &Server{}
+	im, err := srv.Get(imageserver.Params{imageserver_source.Param: httpSrv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != testdata.Random.Format {
+		t.Fatalf("unexpected format: got %s, want %s", im.Format, testdata.Random.Format)
+	}
+}
+
+func TestServerGetSourceETag(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"foo"`)
+		_, _ = w.Write(testdata.Medium.Data)
+	}))
+	defer httpSrv.Close()
+	srv := &Server{}
+	im, err := srv.Get(imageserver.Params{imageserver_source.Param: httpSrv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Metadata.SourceETag != `"foo"` {
+		t.Fatalf("unexpected source ETag: got %q, want %q", im.Metadata.SourceETag, `"foo"`)
+	}
+}
+
+func TestIdentifyMagic(t *testing.T) {
+	format, err := IdentifyMagic(&http.Response{}, testdata.Medium.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != testdata.Medium.Format {
+		t.Fatalf("unexpected format: got %s, want %s", format, testdata.Medium.Format)
+	}
+	_, err = IdentifyMagic(&http.Response{}, []byte("invalid"))
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
@@ -0,0 +1,229 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Policy restricts the requests done by Server, to protect against SSRF (Server-Side Request Forgery).
+//
+// The URL (and the URL of each redirect) is checked against the allow-lists.
+// The IP address is checked in the dialer, after DNS resolution, so a host name that resolves to a private address is blocked.
+// The HTTP proxy from the environment is not used, because the IP address of the proxy would be checked.
+type Policy struct {
+	// AllowedSchemes is the list of allowed URL schemes (DefaultAllowedSchemes if empty).
+	AllowedSchemes []string
+
+	// AllowedHosts is the optional list of allowed host names.
+	// An entry beginning with "*." allows the subdomains (e.g. "*.example.com" allows "img.example.com", but not "example.com").
+	AllowedHosts []string
+
+	// AllowedPorts is the optional list of allowed ports.
+	// The default port of the scheme is used if the URL doesn't contain a port.
+	AllowedPorts []int
+
+	// AllowPrivate allows the private, loopback, link-local and other non-public IP addresses.
+	AllowPrivate bool
+
+	// MaxBodySize is the optional maximum size of the response body.
+	MaxBodySize int64
+
+	// MaxRedirects is the maximum number of redirects.
+	// 0 means DefaultMaxRedirects, and a negative value disables the redirects.
+	MaxRedirects int
+
+	// SniffContent checks the response body with http.DetectContentType.
+	// It must be detected as an image, with the identified format.
+	// Only the formats detected by http.DetectContentType are accepted (e.g. jpeg, png, gif, webp, bmp).
+	SniffContent bool
+}
+
+// DefaultAllowedSchemes is the default value for Policy.AllowedSchemes.
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// DefaultMaxRedirects is the default value for Policy.MaxRedirects.
+const DefaultMaxRedirects = 10
+
+// NewClient returns a new HTTP client that applies the Policy.
+//
+// The Transport of c is cloned (http.DefaultTransport if it is nil).
+// It returns an error if the Transport is not a *http.Transport, or if it has a custom dial function,
+// because the IP address can't be checked.
+// c is optional.
+func (p *Policy) NewClient(c *http.Client) (*http.Client, error) {
+	if c == nil {
+		c = &http.Client{}
+	}
+	tr, err := getPolicyTransport(c.Transport)
+	if err != nil {
+		return nil, err
+	}
+	tr.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	tr.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport:     tr,
+		CheckRedirect: p.checkRedirect,
+		Jar:           c.Jar,
+		Timeout:       c.Timeout,
+	}, nil
+}
+
+func getPolicyTransport(rt http.RoundTripper) (*http.Transport, error) {
+	if rt == nil || rt == http.DefaultTransport {
+		// Its dial function is replaced.
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("policy: unsupported Transport type %T, it must be a *http.Transport", rt)
+	}
+	if t.DialContext != nil || t.Dial != nil || t.DialTLSContext != nil || t.DialTLS != nil {
+		return nil, errors.New("policy: the Transport must not have a custom dial function")
+	}
+	return t.Clone(), nil
+}
+
+// CheckURL checks the scheme, host and port of the URL.
+func (p *Policy) CheckURL(u *url.URL) error {
+	schemes := p.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = DefaultAllowedSchemes
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("no host")
+	}
+	if len(p.AllowedHosts) > 0 && !p.hostAllowed(host) {
+		return fmt.Errorf("host %q is not allowed", host)
+	}
+	if len(p.AllowedPorts) > 0 {
+		port, err := getPort(u)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(p.AllowedPorts, port) {
+			return fmt.Errorf("port %d is not allowed", port)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) hostAllowed(host string) bool {
+	for _, h := range p.AllowedHosts {
+		h = strings.ToLower(h)
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+func getPort(u *url.URL) (int, error) {
+	s := u.Port()
+	if s == "" {
+		switch u.Scheme {
+		case "http":
+			return 80, nil
+		case "https":
+			return 443, nil
+		}
+		return 0, fmt.Errorf("no port for scheme %q", u.Scheme)
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+func (p *Policy) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := max(p.MaxRedirects, 0)
+	if p.MaxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return p.CheckURL(req.URL)
+}
+
+// control is a net.Dialer.Control function that checks the IP address.
+func (p *Policy) control(network, address string, c syscall.RawConn) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	addr := addrPort.Addr().Unmap()
+	if !IsPublicAddr(addr) {
+		return fmt.Errorf("address %s is not allowed", addr)
+	}
+	return nil
+}
+
+// Non-public ranges that are not covered by the netip.Addr methods.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network.
+	netip.MustParsePrefix("100.64.0.0/10"), // Shared address space (carrier-grade NAT).
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments.
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking.
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved.
+	netip.MustParsePrefix("64:ff9b::/96"),  // IPv4/IPv6 translation.
+}
+
+// IsPublicAddr returns true if the IP address is a public unicast address.
+//
+// It returns false for the private, loopback, link-local (e.g. cloud metadata endpoints), multicast and reserved addresses.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsUnspecified() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSniff checks that the data is detected as an image with the format.
+func checkSniff(data []byte, format string) error {
+	ct := http.DetectContentType(data)
+	if ct != "image/"+format {
+		return fmt.Errorf("detected content type %q does not match image format %q", ct, format)
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package http
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_source "github.com/pierrre/imageserver/source"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestPolicyCheckURL(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		policy        *Policy
+		url           string
+		expectedError bool
+	}{
+		{
+			name:   "Default",
+			policy: &Policy{},
+			url:    "https://example.com/image.jpg",
+		},
+		{
+			name:          "ErrorScheme",
+			policy:        &Policy{},
+			url:           "file:///etc/passwd",
+			expectedError: true,
+		},
+		{
+			name:   "AllowedSchemes",
+			policy: &Policy{AllowedSchemes: []string{"https"}},
+			url:    "https://example.com/image.jpg",
+		},
+		{
+			name:          "ErrorAllowedSchemes",
+			policy:        &Policy{AllowedSchemes: []string{"https"}},
+			url:           "http://example.com/image.jpg",
+			expectedError: true,
+		},
+		{
+			name:          "ErrorNoHost",
+			policy:        &Policy{},
+			url:           "http:///image.jpg",
+			expectedError: true,
+		},
+		{
+			name:   "AllowedHosts",
+			policy: &Policy{AllowedHosts: []string{"example.com"}},
+			url:    "https://EXAMPLE.com/image.jpg",
+		},
+		{
+			name:          "ErrorAllowedHosts",
+			policy:        &Policy{AllowedHosts: []string{"example.com"}},
+			url:           "https://img.example.com/image.jpg",
+			expectedError: true,
+		},
+		{
+			name:   "AllowedHostsWildcard",
+			policy: &Policy{AllowedHosts: []string{"*.example.com"}},
+			url:    "https://img.example.com/image.jpg",
+		},
+		{
+			name:          "ErrorAllowedHostsWildcardDomain",
+			policy:        &Policy{AllowedHosts: []string{"*.example.com"}},
+			url:           "https://example.com/image.jpg",
+			expectedError: true,
+		},
+		{
+			name:          "ErrorAllowedHostsWildcardSuffix",
+			policy:        &Policy{AllowedHosts: []string{"*.example.com"}},
+			url:           "https://evilexample.com/image.jpg",
+			expectedError: true,
+		},
+		{
+			name:   "AllowedPortsDefault",
+			policy: &Policy{AllowedPorts: []int{443}},
+			url:    "https://example.com/image.jpg",
+		},
+		{
+			name:   "AllowedPorts",
+			policy: &Policy{AllowedPorts: []int{8080}},
+			url:    "http://example.com:8080/image.jpg",
+		},
+		{
+			name:          "ErrorAllowedPorts",
+			policy:        &Policy{AllowedPorts: []int{80, 443}},
+			url:           "http://example.com:8080/image.jpg",
+			expectedError: true,
+		},
+		{
+			name:          "ErrorAllowedPortsNoDefault",
+			policy:        &Policy{AllowedSchemes: []string{"ftp"}, AllowedPorts: []int{21}},
+			url:           "ftp://example.com/image.jpg",
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tc.policy.CheckURL(u)
+			if err != nil {
+				if tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr     string
+		expected bool
+	}{
+		{addr: "93.184.216.34", expected: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", expected: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "0.0.0.0"},
+		{addr: "::"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "fd00::1"},
+		{addr: "100.64.0.1"},
+		{addr: "224.0.0.1"},
+		{addr: "ff02::1"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "::ffff:169.254.169.254"},
+		{addr: "64:ff9b::a9fe:a9fe"},
+	} {
+		t.Run(tc.addr, func(t *testing.T) {
+			res := IsPublicAddr(netip.MustParseAddr(tc.addr))
+			if res != tc.expected {
+				t.Fatalf("unexpected result: got %t, want %t", res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestServerPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(testdata.Dir)))
+	mux.HandleFunc("/redirect/1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/"+testdata.MediumFileName, http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect/1", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/scheme", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/image.jpg", http.StatusFound)
+	})
+	mux.HandleFunc("/fake.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+	httpSrv := httptest.NewServer(mux)
+	defer httpSrv.Close()
+	for _, tc := range []struct {
+		name          string
+		policy        *Policy
+		path          string
+		expectedError bool
+	}{
+		{
+			name:   "AllowPrivate",
+			policy: &Policy{AllowPrivate: true},
+			path:   testdata.MediumFileName,
+		},
+		{
+			name:          "ErrorPrivate",
+			policy:        &Policy{},
+			path:          testdata.MediumFileName,
+			expectedError: true,
+		},
+		{
+			name:          "ErrorURL",
+			policy:        &Policy{AllowPrivate: true, AllowedHosts: []string{"example.com"}},
+			path:          testdata.MediumFileName,
+			expectedError: true,
+		},
+		{
+			name:   "MaxBodySize",
+			policy: &Policy{AllowPrivate: true, MaxBodySize: int64(len(testdata.Medium.Data))},
+			path:   testdata.MediumFileName,
+		},
+		{
+			name:          "ErrorMaxBodySize",
+			policy:        &Policy{AllowPrivate: true, MaxBodySize: 1000},
+			path:          testdata.MediumFileName,
+			expectedError: true,
+		},
+		{
+			name:   "MaxRedirects",
+			policy: &Policy{AllowPrivate: true, MaxRedirects: 2},
+			path:   "redirect/2",
+		},
+		{
+			name:          "ErrorMaxRedirects",
+			policy:        &Policy{AllowPrivate: true, MaxRedirects: 1},
+			path:          "redirect/2",
+			expectedError: true,
+		},
+		{
+			name:   "MaxRedirectsDefault",
+			policy: &Policy{AllowPrivate: true},
+			path:   "redirect/2",
+		},
+		{
+			name:          "ErrorMaxRedirectsDisabled",
+			policy:        &Policy{AllowPrivate: true, MaxRedirects: -1},
+			path:          "redirect/1",
+			expectedError: true,
+		},
+		{
+			name:          "ErrorRedirectURL",
+			policy:        &Policy{AllowPrivate: true, MaxRedirects: 1},
+			path:          "redirect/scheme",
+			expectedError: true,
+		},
+		{
+			name:   "SniffContent",
+			policy: &Policy{AllowPrivate: true, SniffContent: true},
+			path:   testdata.MediumFileName,
+		},
+		{
+			name:          "ErrorSniffContent",
+			policy:        &Policy{AllowPrivate: true, SniffContent: true},
+			path:          "fake.png",
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params := imageserver.Params{
+				imageserver_source.Param: httpSrv.URL + "/" + tc.path,
+			}
+			for _, get := range []struct {
+				name string
+				f    func(srv *Server) error
+			}{
+				{
+					name: "Get",
+					f: func(srv *Server) error {
+						_, err := srv.Get(params)
+						return err
+					},
+				},
+				{
+					name: "GetStream",
+					f: func(srv *Server) error {
+						st, err := srv.GetStream(t.Context(), params)
+						if err != nil {
+							return err
+						}
+						defer func() {
+							_ = st.Body.Close()
+						}()
+						_, err = io.ReadAll(st.Body)
+						if err != nil {
+							return newDownloadError(t.Context(), err)
+						}
+						return nil
+					},
+				},
+			} {
+				t.Run(get.name, func(t *testing.T) {
+					srv := &Server{Policy: tc.policy}
+					err := get.f(srv)
+					if err != nil {
+						if err, ok := err.(*imageserver.ParamError); ok && err.Param == imageserver_source.Param && tc.expectedError {
+							return
+						}
+						t.Fatal(err)
+					}
+					if tc.expectedError {
+						t.Fatal("no error")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestServerPolicyMaxBodySizeStream(t *testing.T) {
+	// No "Content-Length" header, the limit is checked while reading.
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		for i := 0; i < len(testdata.Medium.Data); i += 1000 {
+			_, _ = w.Write(testdata.Medium.Data[i:min(i+1000, len(testdata.Medium.Data))])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer httpSrv.Close()
+	srv := &Server{Policy: &Policy{AllowPrivate: true, MaxBodySize: 10000}}
+	_, err := srv.Get(imageserver.Params{imageserver_source.Param: httpSrv.URL})
+	if err, ok := err.(*imageserver.ParamError); !ok || err.Param != imageserver_source.Param {
+		t.Fatalf("unexpected error: got %v, want %T", err, &imageserver.ParamError{})
+	}
+}
+
+func TestPolicyNewClient(t *testing.T) {
+	p := &Policy{}
+	c, err := p.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CheckRedirect == nil {
+		t.Fatal("no CheckRedirect")
+	}
+	tr := &http.Transport{MaxIdleConns: 42}
+	c, err = p.NewClient(&http.Client{Transport: tr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctr, ok := c.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("unexpected transport type: %T", c.Transport)
+	}
+	if ctr == tr {
+		t.Fatal("transport not cloned")
+	}
+	if ctr.MaxIdleConns != 42 {
+		t.Fatalf("unexpected MaxIdleConns: got %d, want %d", ctr.MaxIdleConns, 42)
+	}
+	if ctr.Proxy != nil {
+		t.Fatal("proxy not disabled")
+	}
+	if ctr.DialContext == nil {
+		t.Fatal("no DialContext")
+	}
+}
+
+func TestPolicyNewClientError(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transport http.RoundTripper
+	}{
+		{
+			name:      "Type",
+			transport: roundTripperFunc(http.DefaultTransport.RoundTrip),
+		},
+		{
+			name: "DialContext",
+			transport: &http.Transport{
+				DialContext: (&net.Dialer{}).DialContext,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := (&Policy{}).NewClient(&http.Client{Transport: tc.transport})
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestServerPolicyNewClientError(t *testing.T) {
+	srv := &Server{
+		Client: &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)},
+		Policy: &Policy{},
+	}
+	_, err := srv.Get(imageserver.Params{imageserver_source.Param: "http://example.com"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
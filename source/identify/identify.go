@@ -0,0 +1,149 @@
+// Package identify provides Image format identification from the data ("magic bytes").
+//
+// It can be used by the Identify func of imageserver/source/file.Server and imageserver/source/http.Server.
+package identify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Magic identifies the Image format from the beginning of the data.
+//
+// The supported formats are: jpeg, png, gif, bmp, tiff, webp, avif, heic and svg+xml.
+// The returned format is the MIME subtype, so "image/"+format is a valid content type.
+// It only needs the first bytes of the data (512 bytes are enough).
+func Magic(data []byte) (format string, err error) {
+	for _, d := range detectors {
+		if d.detect(data) {
+			return d.format, nil
+		}
+	}
+	return "", errors.New("unknown image format")
+}
+
+var detectors = []struct {
+	format string
+	detect func(data []byte) bool
+}{
+	{"jpeg", isJPEG},
+	{"png", isPNG},
+	{"gif", isGIF},
+	{"webp", isWEBP},
+	{"tiff", isTIFF},
+	{"bmp", isBMP},
+	{"avif", isAVIF},
+	{"heic", isHEIC},
+	{"svg+xml", isSVG},
+}
+
+func isJPEG(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("\xff\xd8\xff"))
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n"))
+}
+
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+func isWEBP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+func isTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+func isBMP(data []byte) bool {
+	// "BM" is too short to be reliable, so the DIB header size is checked too.
+	if len(data) < 18 || string(data[0:2]) != "BM" {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data[14:18]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+var (
+	avifBrands = []string{"avif", "avis"}
+	heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis"}
+)
+
+func isAVIF(data []byte) bool {
+	return hasFtypBrand(data, avifBrands)
+}
+
+func isHEIC(data []byte) bool {
+	return hasFtypBrand(data, heicBrands)
+}
+
+// hasFtypBrand returns true if the ISO base media file type box ("ftyp") contains one of the brands (major or compatible).
+func hasFtypBrand(data []byte, brands []string) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := min(int(binary.BigEndian.Uint32(data[0:4])), len(data))
+	for i := 8; i+4 <= size; i += 4 {
+		if i == 12 {
+			continue // Minor version.
+		}
+		for _, b := range brands {
+			if string(data[i:i+4]) == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSVG(data []byte) bool {
+	s := strings.TrimPrefix(string(data), "\xef\xbb\xbf") // UTF-8 BOM.
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		var end string
+		switch {
+		case strings.HasPrefix(s, "<?"): // XML declaration or processing instruction.
+			end = "?>"
+		case strings.HasPrefix(s, "<!--"):
+			end = "-->"
+		case strings.HasPrefix(s, "<!"): // Doctype.
+			end = ">"
+		default:
+			s, ok := strings.CutPrefix(s, "<svg")
+			return ok && (s == "" || strings.ContainsAny(s[:1], " \t\r\n>/"))
+		}
+		i := strings.Index(s, end)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(end):]
+	}
+}
+
+// Chain returns an Identify func that tries the given funcs in order, and returns the first identified format.
+//
+// T is the type of the first argument of the Identify func (e.g. the file path or the *http.Response).
+// If all funcs fail, the returned error contains all the errors.
+func Chain[T any](idfs ...func(v T, data []byte) (format string, err error)) func(v T, data []byte) (format string, err error) {
+	return func(v T, data []byte) (format string, err error) {
+		if len(idfs) == 0 {
+			return "", errors.New("no identify func")
+		}
+		msgs := make([]string, 0, len(idfs))
+		for _, idf := range idfs {
+			format, err = idf(v, data)
+			if err == nil {
+				return format, nil
+			}
+			msgs = append(msgs, err.Error())
+		}
+		return "", errors.New(strings.Join(msgs, "; "))
+	}
+}
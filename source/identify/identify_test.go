@@ -0,0 +1,192 @@
+package identify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestMagic(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		data           []byte
+		expectedFormat string
+		expectedError  bool
+	}{
+		{
+			name:           "JPEG",
+			data:           testdata.Medium.Data,
+			expectedFormat: "jpeg",
+		},
+		{
+			name:           "PNG",
+			data:           testdata.Random.Data,
+			expectedFormat: "png",
+		},
+		{
+			name:           "GIF",
+			data:           testdata.Animated.Data,
+			expectedFormat: "gif",
+		},
+		{
+			name:           "GIF87a",
+			data:           []byte("GIF87a\x01\x00\x01\x00"),
+			expectedFormat: "gif",
+		},
+		{
+			name:           "BMP",
+			data:           []byte("BM\x3a\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x28\x00\x00\x00"),
+			expectedFormat: "bmp",
+		},
+		{
+			name:           "TIFFLittleEndian",
+			data:           []byte("II*\x00\x08\x00\x00\x00"),
+			expectedFormat: "tiff",
+		},
+		{
+			name:           "TIFFBigEndian",
+			data:           []byte("MM\x00*\x00\x00\x00\x08"),
+			expectedFormat: "tiff",
+		},
+		{
+			name:           "WEBP",
+			data:           []byte("RIFF\x24\x00\x00\x00WEBPVP8 "),
+			expectedFormat: "webp",
+		},
+		{
+			name:           "AVIF",
+			data:           []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"),
+			expectedFormat: "avif",
+		},
+		{
+			name:           "AVIFCompatibleBrand",
+			data:           []byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avif"),
+			expectedFormat: "avif",
+		},
+		{
+			name:           "HEIC",
+			data:           []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"),
+			expectedFormat: "heic",
+		},
+		{
+			name:          "ErrorFtypMinorVersion",
+			data:          []byte("\x00\x00\x00\x14ftypmp42avif\x00\x00\x00\x00"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorFtypOtherBrand",
+			data:          []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2"),
+			expectedError: true,
+		},
+		{
+			name:           "SVG",
+			data:           []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+			expectedFormat: "svg+xml",
+		},
+		{
+			name: "SVGPreamble",
+			data: []byte("\xef\xbb\xbf<?xml version=\"1.0\"?>\n" +
+				"<!-- comment -->\n" +
+				"<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n" +
+				"<svg>"),
+			expectedFormat: "svg+xml",
+		},
+		{
+			name:          "ErrorSVGUnterminatedComment",
+			data:          []byte("<!-- <svg>"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorHTML",
+			data:          []byte("<!DOCTYPE html><html><svg></svg></html>"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorSVGPrefix",
+			data:          []byte("<svgfoo>"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorBMPShort",
+			data:          []byte("BMP image"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorText",
+			data:          []byte("hello"),
+			expectedError: true,
+		},
+		{
+			name:          "ErrorEmpty",
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := Magic(tc.data)
+			if err != nil {
+				if tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError {
+				t.Fatal("no error")
+			}
+			if format != tc.expectedFormat {
+				t.Fatalf("unexpected format: got %s, want %s", format, tc.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	fail := func(v string, data []byte) (string, error) {
+		return "", errors.New("fail " + v)
+	}
+	ok := func(v string, data []byte) (string, error) {
+		return v, nil
+	}
+	for _, tc := range []struct {
+		name           string
+		idfs           []func(string, []byte) (string, error)
+		expectedFormat string
+		expectedError  string
+	}{
+		{
+			name:           "First",
+			idfs:           []func(string, []byte) (string, error){ok, fail},
+			expectedFormat: "test",
+		},
+		{
+			name:           "Fallback",
+			idfs:           []func(string, []byte) (string, error){fail, ok},
+			expectedFormat: "test",
+		},
+		{
+			name:          "ErrorAll",
+			idfs:          []func(string, []byte) (string, error){fail, fail},
+			expectedError: "fail test; fail test",
+		},
+		{
+			name:          "ErrorEmpty",
+			expectedError: "no identify func",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := Chain(tc.idfs...)("test", nil)
+			if err != nil {
+				if tc.expectedError != "" && err.Error() == tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError != "" {
+				t.Fatal("no error")
+			}
+			if format != tc.expectedFormat {
+				t.Fatalf("unexpected format: got %s, want %s", format, tc.expectedFormat)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@
 package source
 
 import (
+	"context"
+
 	"github.com/pierrre/imageserver"
 )
 
@@ -11,16 +13,32 @@ const Param = "source"
 // Server is a imageserver.Server implementation that forwards calls to the underlying Server with only the "source" param.
 //
 // It should be used to cache the source Image.
+// It implements imageserver.ContextServer and imageserver.StreamServer.
 type Server struct {
 	imageserver.Server
 }
 
 // Get implements imageserver.Server.
 func (s *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (s *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	src, err := params.Get(Param)
+	if err != nil {
+		return nil, err
+	}
+	params = imageserver.Params{Param: src}
+	return imageserver.GetContext(ctx, s.Server, params)
+}
+
+// GetStream implements imageserver.StreamServer.
+func (s *Server) GetStream(ctx context.Context, params imageserver.Params) (*imageserver.Stream, error) {
 	src, err := params.Get(Param)
 	if err != nil {
 		return nil, err
 	}
 	params = imageserver.Params{Param: src}
-	return s.Server.Get(params)
+	return imageserver.GetStream(ctx, s.Server, params)
 }
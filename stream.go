@@ -0,0 +1,77 @@
+package imageserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Stream is a raw image whose data is read from a io.ReadCloser.
+//
+// It allows to send an Image without loading all its data in memory.
+type Stream struct {
+	// Format is the format used to encode the image.
+	Format string
+
+	// Body contains the raw data of the encoded image.
+	// It must be closed by the caller.
+	Body io.ReadCloser
+
+	// Size is the length of Body, or -1 if it is unknown.
+	Size int64
+}
+
+// NewImageStream returns a Stream that reads the Image data.
+func NewImageStream(im *Image) *Stream {
+	return &Stream{
+		Format: im.Format,
+		Body:   io.NopCloser(bytes.NewReader(im.Data)),
+		Size:   int64(len(im.Data)),
+	}
+}
+
+// ReadImage reads all the data, closes the Body and returns an Image.
+//
+// It returns an *ImageError if the data length is greater than ImageDataMaxLen.
+func (st *Stream) ReadImage() (*Image, error) {
+	defer func() {
+		_ = st.Body.Close()
+	}()
+	buf := new(bytes.Buffer)
+	if st.Size > 0 && st.Size <= ImageDataMaxLen {
+		buf.Grow(int(st.Size))
+	}
+	n, err := buf.ReadFrom(io.LimitReader(st.Body, ImageDataMaxLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > ImageDataMaxLen {
+		return nil, &ImageError{Message: fmt.Sprintf("stream: data length is greater than the maximum value %d", ImageDataMaxLen)}
+	}
+	return &Image{
+		Format: st.Format,
+		Data:   buf.Bytes(),
+	}, nil
+}
+
+// StreamServer is a Server that can return a Stream.
+type StreamServer interface {
+	Server
+	GetStream(context.Context, Params) (*Stream, error)
+}
+
+// GetStream gets a Stream from the Server.
+//
+// If the Server implements StreamServer, it calls GetStream().
+// Otherwise it calls GetContext() and returns a Stream that reads the Image data.
+func GetStream(ctx context.Context, srv Server, params Params) (*Stream, error) {
+	if srv, ok := srv.(StreamServer); ok {
+		return srv.GetStream(ctx, params)
+	}
+	im, err := GetContext(ctx, srv, params)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageStream(im), nil
+}
@@ -0,0 +1,144 @@
+package imageserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestNewImageStream(t *testing.T) {
+	im := &Image{Format: "jpeg", Data: []byte("foobar")}
+	st := NewImageStream(im)
+	if st.Format != im.Format {
+		t.Fatalf("unexpected format: got %s, want %s", st.Format, im.Format)
+	}
+	if st.Size != int64(len(im.Data)) {
+		t.Fatalf("unexpected size: got %d, want %d", st.Size, len(im.Data))
+	}
+	res, err := st.ReadImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != im.Format || !bytes.Equal(res.Data, im.Data) {
+		t.Fatal("not equal")
+	}
+}
+
+func TestStreamReadImageError(t *testing.T) {
+	st := &Stream{
+		Body: io.NopCloser(&testErrorReader{}),
+		Size: -1,
+	}
+	_, err := st.ReadImage()
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type testErrorReader struct{}
+
+func (r *testErrorReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("error")
+}
+
+func TestGetStreamServer(t *testing.T) {
+	srv := ServerFunc(func(params Params) (*Image, error) {
+		return &Image{Format: "jpeg", Data: []byte("foobar")}, nil
+	})
+	st, err := GetStream(context.Background(), srv, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size != 6 {
+		t.Fatalf("unexpected size: %d", st.Size)
+	}
+}
+
+func TestGetStreamServerError(t *testing.T) {
+	srv := ServerFunc(func(params Params) (*Image, error) {
+		return nil, fmt.Errorf("error")
+	})
+	_, err := GetStream(context.Background(), srv, Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+var _ StreamServer = &HandlerServer{}
+
+func TestHandlerServerGetStream(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		change        bool
+		expectedData  string
+		expectHandled bool
+	}{
+		{
+			name:         "Unchanged",
+			change:       false,
+			expectedData: "source",
+		},
+		{
+			name:          "Changed",
+			change:        true,
+			expectedData:  "handled",
+			expectHandled: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srcStream := &Stream{
+				Format: "jpeg",
+				Body:   io.NopCloser(bytes.NewReader([]byte("source"))),
+				Size:   -1,
+			}
+			handled := false
+			srv := &HandlerServer{
+				Server: &testStreamServer{stream: srcStream},
+				Handler: &testChangeHandler{
+					change: tc.change,
+					Handler: HandlerFunc(func(im *Image, params Params) (*Image, error) {
+						handled = true
+						if string(im.Data) != "source" {
+							t.Fatalf("unexpected data: %s", im.Data)
+						}
+						return &Image{Format: "jpeg", Data: []byte("handled")}, nil
+					}),
+				},
+			}
+			st, err := srv.GetStream(context.Background(), Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(st.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.expectedData {
+				t.Fatalf("unexpected data: got %s, want %s", data, tc.expectedData)
+			}
+			if handled != tc.expectHandled {
+				t.Fatalf("unexpected handled: got %t, want %t", handled, tc.expectHandled)
+			}
+		})
+	}
+}
+
+type testStreamServer struct {
+	Server
+	stream *Stream
+}
+
+func (srv *testStreamServer) GetStream(ctx context.Context, params Params) (*Stream, error) {
+	return srv.stream, nil
+}
+
+type testChangeHandler struct {
+	Handler
+	change bool
+}
+
+func (hdr *testChangeHandler) Change(format string, params Params) bool {
+	return hdr.change
+}